@@ -0,0 +1,477 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func (app *application) createCityHandler(w http.ResponseWriter, r *http.Request) {
+	err := validateAllowedQueryParams(r.URL.Query(), newIncludeSet())
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name        string   `json:"city"`
+		StateCode   *string  `json:"state_code"`
+		CountryCode string   `json:"country_code"`
+		Population  *int64   `json:"population"`
+		Latitude    *float64 `json:"latitude"`
+		Longitude   *float64 `json:"longitude"`
+		Timezone    string   `json:"timezone"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Latitude != nil, "latitude", "must be provided")
+	v.Check(input.Longitude != nil, "longitude", "must be provided")
+
+	city := &data.CityRecord{
+		GeonameID:   id,
+		Name:        input.Name,
+		StateCode:   input.StateCode,
+		CountryCode: input.CountryCode,
+		Population:  input.Population,
+		Timezone:    input.Timezone,
+	}
+	if input.Latitude != nil {
+		city.Latitude = *input.Latitude
+	}
+	if input.Longitude != nil {
+		city.Longitude = *input.Longitude
+	}
+
+	if data.ValidateCityRecord(v, city); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.resolveCityCountry(w, r, city, v) {
+		return
+	}
+
+	err = app.models.Cities.InsertCity(city, app.contextGetUser(r).Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCity):
+			v.AddError("geoname_id", "a city with this geoname id already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.cityWriteErrorResponse(w, r, err, v)
+		}
+		return
+	}
+
+	app.refreshCityFeatures()
+
+	headers := make(http.Header)
+	headers.Set("Location", "/cities/"+strconv.FormatInt(city.GeonameID, 10))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"city": city}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateCityHandler(w http.ResponseWriter, r *http.Request) {
+	err := validateAllowedQueryParams(r.URL.Query(), newIncludeSet())
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	city, err := app.models.Cities.GetCityRecord(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name        *string  `json:"city"`
+		StateCode   *string  `json:"state_code"`
+		CountryCode *string  `json:"country_code"`
+		Population  *int64   `json:"population"`
+		Latitude    *float64 `json:"latitude"`
+		Longitude   *float64 `json:"longitude"`
+		Timezone    *string  `json:"timezone"`
+		Version     *int     `json:"version"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Version == nil {
+		app.failedValidationResponse(w, r, map[string]string{"version": "must be provided"})
+		return
+	}
+	if *input.Version != city.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	if input.Name != nil {
+		city.Name = *input.Name
+	}
+	if input.StateCode != nil {
+		city.StateCode = input.StateCode
+	}
+	if input.CountryCode != nil {
+		city.CountryCode = *input.CountryCode
+	}
+	if input.Population != nil {
+		city.Population = input.Population
+	}
+	if input.Latitude != nil {
+		city.Latitude = *input.Latitude
+	}
+	if input.Longitude != nil {
+		city.Longitude = *input.Longitude
+	}
+	if input.Timezone != nil {
+		city.Timezone = *input.Timezone
+	}
+
+	v := validator.New()
+	if data.ValidateCityRecord(v, city); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.resolveCityCountry(w, r, city, v) {
+		return
+	}
+
+	err = app.models.Cities.UpdateCity(city, app.contextGetUser(r).Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.cityWriteErrorResponse(w, r, err, v)
+		}
+		return
+	}
+
+	app.refreshCityFeatures()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"city": city}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCityHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("version"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !qs.Has("version") {
+		app.failedValidationResponse(w, r, map[string]string{"version": "must be provided"})
+		return
+	}
+	version, err := parseInt(qs, "version", 0, 1, math.MaxInt32)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"version": err.Error()})
+		return
+	}
+
+	err = app.models.Cities.DeleteCity(id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.refreshCityFeatures()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "city successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) upsertCityIndicesHandler(w http.ResponseWriter, r *http.Request) {
+	err := validateAllowedQueryParams(r.URL.Query(), newIncludeSet())
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Indices map[string]*float64 `json:"indices"`
+		Version int                 `json:"version"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	record := &data.CityIndicesRecord{GeonameID: id, Indices: input.Indices, Version: input.Version}
+
+	v := validator.New()
+	if data.ValidateCityIndicesRecord(v, record); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.cityExists(w, r, id) {
+		return
+	}
+
+	created, err := app.models.Cities.UpsertCityIndices(record, app.contextGetUser(r).Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.refreshCityFeatures()
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	err = app.writeJSON(w, status, envelope{"numbeo_indices": record}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) upsertClimateMonthHandler(w http.ResponseWriter, r *http.Request) {
+	err := validateAllowedQueryParams(r.URL.Query(), newIncludeSet())
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	month, err := strconv.Atoi(chi.URLParam(r, "month"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Metrics map[string]*float64 `json:"metrics"`
+		Version int                 `json:"version"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	record := &data.ClimateMonthRecord{GeonameID: id, Month: month, Metrics: input.Metrics, Version: input.Version}
+
+	v := validator.New()
+	if data.ValidateClimateMonthRecord(v, record); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.cityExists(w, r, id) {
+		return
+	}
+
+	created, err := app.models.Cities.UpsertClimateMonth(record, app.contextGetUser(r).Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrIncompleteClimate):
+			app.failedValidationResponse(w, r, map[string]string{"month": "can only be added when the city has climate data for the other 11 months"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.refreshCityFeatures()
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	err = app.writeJSON(w, status, envelope{"avg_climate": record}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resolveCityCountry replaces the country code of city with its alpha-3 form.
+// It writes the error response and returns false when that fails.
+func (app *application) resolveCityCountry(w http.ResponseWriter, r *http.Request, city *data.CityRecord, v *validator.Validator) bool {
+	code, err := app.models.Countries.ResolveCode(city.CountryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("country_code", "must be a known ISO 3166-1 alpha-2, alpha-3 or numeric code")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	city.CountryCode = code
+	return true
+}
+
+// cityExists writes a not found response and returns false for unknown cities.
+func (app *application) cityExists(w http.ResponseWriter, r *http.Request, id int64) bool {
+	_, err := app.models.Cities.GetCityRecord(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	return true
+}
+
+func (app *application) cityWriteErrorResponse(w http.ResponseWriter, r *http.Request, err error, v *validator.Validator) {
+	switch {
+	case errors.Is(err, data.ErrUnknownState):
+		v.AddError("state_code", "must be a known state code")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrRecordNotFound):
+		v.AddError("country_code", "must be a known ISO 3166-1 alpha-2, alpha-3 or numeric code")
+		app.failedValidationResponse(w, r, v.Errors)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// featureRefreshDelay is how long a city_features refresh waits for further
+// admin writes, so that a burst of them, such as the twelve climate months of
+// a city, is covered by a single refresh.
+const featureRefreshDelay = 2 * time.Second
+
+// featureRefresher coalesces city_features refreshes. Writes made while a
+// refresh is scheduled share it; writes made while one runs schedule exactly
+// one more.
+type featureRefresher struct {
+	mu        sync.Mutex
+	scheduled bool
+	running   bool
+	pending   bool
+}
+
+// refreshCityFeatures schedules a background refresh of city_features so that
+// similar-city results pick up admin edits.
+func (app *application) refreshCityFeatures() {
+	f := &app.featureRefresh
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case f.scheduled:
+		return
+	case f.running:
+		f.pending = true
+		return
+	}
+
+	f.scheduled = true
+	app.background(app.runFeatureRefreshes)
+}
+
+func (app *application) runFeatureRefreshes() {
+	f := &app.featureRefresh
+	for {
+		time.Sleep(featureRefreshDelay)
+
+		f.mu.Lock()
+		f.scheduled, f.running = false, true
+		f.mu.Unlock()
+
+		err := app.models.Cities.RefreshFeatures()
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+
+		f.mu.Lock()
+		f.running = false
+		if !f.pending {
+			f.mu.Unlock()
+			return
+		}
+		f.pending, f.scheduled = false, true
+		f.mu.Unlock()
+	}
+}
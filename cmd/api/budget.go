@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/exchangerates"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func (app *application) budgetHandler(w http.ResponseWriter, r *http.Request) {
+	err := validateAllowedQueryParams(r.URL.Query(), newIncludeSet())
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	var input data.InputBudget
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	input.Preset = strings.ToLower(strings.TrimSpace(input.Preset))
+	input.Currency = strings.ToUpper(strings.TrimSpace(input.Currency))
+
+	v := validator.New()
+	if input.Currency != "" {
+		v.Check(exchangerates.IsSupported(input.Currency), "currency", fmt.Sprintf("must be one of %s", strings.Join(exchangerates.SupportedCurrencies(), ", ")))
+	}
+	if data.ValidateInputBudget(v, input, app.config.batch.maxDetailedIDs); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items := input.Items
+	if input.Preset != "" {
+		items = data.BudgetPresets[input.Preset]
+	} else {
+		known, err := app.models.Cities.CostParams(items)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if data.ValidateBudgetItemParams(v, items, known); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	cities, err := app.models.Cities.GetCitiesByIDs(input.CityIDs, data.NewIncludeSet("numbeo_cost"), nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Currency != "" {
+		err = app.convertNumbeoCosts(r.Context(), input.Currency, cities...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	budgets := make([]*data.CityBudget, 0, len(cities))
+	for _, city := range cities {
+		budgets = append(budgets, data.NewCityBudget(city, items))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"budgets": budgets}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/denis-k2/relohelper-go/internal/data"
 	"github.com/denis-k2/relohelper-go/internal/validator"
@@ -14,29 +18,52 @@ func (app *application) listCitiesHandler(w http.ResponseWriter, r *http.Request
 	v := validator.New()
 	qs := r.URL.Query()
 
-	err := validateAllowedQueryParams(qs, newIncludeSet("country_code", "include", "ids"))
+	err := validateAllowedQueryParams(qs, newIncludeSet(slices.Concat([]string{"include", "ids", "fields", "currency", "cost_param"}, cityListFilterParams, paginationParams)...))
 	if err != nil {
 		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
 		return
 	}
 
-	include, err := parseInclude(qs, newIncludeSet("country", "numbeo_cost", "numbeo_indices", "avg_climate"))
+	include, err := parseInclude(qs, newIncludeSet("country", "state", "numbeo_cost", "numbeo_indices", "avg_climate", "time"))
 	if err != nil {
 		app.failedValidationResponse(w, r, map[string]string{"include": err.Error()})
 		return
 	}
 
+	currency, err := parseCurrency(qs)
+	if err == nil && currency != "" && !include.Has("numbeo_cost") {
+		err = fmt.Errorf("currency requires include=numbeo_cost")
+	}
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"currency": err.Error()})
+		return
+	}
+
+	costParams, err := parseCostParams(qs, include)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"cost_param": err.Error()})
+		return
+	}
+
+	fields, include, err := parseFields(qs, cityFieldCatalog, include)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"fields": err.Error()})
+		return
+	}
+
 	ids, idsPresent, err := parseIDsInt64(qs, "ids", app.config.batch.maxIDs)
 	if err != nil {
 		app.failedValidationResponse(w, r, map[string]string{"ids": err.Error()})
 		return
 	}
 	if idsPresent {
-		if qs.Has("country_code") {
-			app.failedValidationResponse(w, r, map[string]string{
-				"query": "country_code cannot be used together with ids",
-			})
-			return
+		for _, param := range slices.Concat(cityListFilterParams, paginationParams) {
+			if qs.Has(param) {
+				app.failedValidationResponse(w, r, map[string]string{
+					"query": param + " cannot be used together with ids",
+				})
+				return
+			}
 		}
 
 		if hasDetailedCityInclude(include) && len(ids) > app.config.batch.maxDetailedIDs {
@@ -46,7 +73,21 @@ func (app *application) listCitiesHandler(w http.ResponseWriter, r *http.Request
 			return
 		}
 
-		cities, err := app.models.Cities.GetCitiesByIDs(ids, include)
+		if costParams != nil {
+			unknown, err := app.unknownCostParams(costParams)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if len(unknown) > 0 {
+				app.failedValidationResponse(w, r, map[string]string{
+					"cost_param": fmt.Sprintf("unknown cost params: %s", strings.Join(unknown, "; ")),
+				})
+				return
+			}
+		}
+
+		cities, err := app.models.Cities.GetCitiesByIDs(ids, include, costParams)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -57,12 +98,29 @@ func (app *application) listCitiesHandler(w http.ResponseWriter, r *http.Request
 			return
 		}
 
+		if currency != "" {
+			err = app.convertNumbeoCosts(r.Context(), currency, cities...)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		if include.Has("time") {
+			data.AttachLocalTimes(cities, time.Now())
+		}
+
 		resp := make([]cityResponse, 0, len(cities))
 		for _, city := range cities {
 			resp = append(resp, newCityResponse(city, include))
 		}
 
-		err = app.writeJSON(w, http.StatusOK, envelope{"cities": resp}, nil)
+		projected, err := projectEach(fields, resp)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"cities": projected}, nil)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 		}
@@ -76,26 +134,63 @@ func (app *application) listCitiesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	err = parsePagination(qs, &input, "geoname_id", data.CitySortSafelist)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"page_size": err.Error()})
+		return
+	}
+
+	if app.readCityFilters(qs, &input, v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	if qs.Has("country_code") {
-		input.CountryCode = app.readString(qs, "country_code", "")
-		if data.ValidateFilters(v, input); !v.Valid() {
-			app.failedValidationResponse(w, r, v.Errors)
+		data.ValidateFilters(v, input)
+	}
+	data.ValidateCityFilters(v, input)
+	if data.ValidatePagination(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.CountryCode != "" {
+		input.CountryCode, err = app.models.Countries.ResolveCode(input.CountryCode)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
 			return
 		}
 	}
 
-	cities, err := app.models.Cities.ListCities(input.CountryCode, include)
+	cities, metadata, err := app.models.Cities.ListCities(input, include)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.failedValidationResponse(w, r, map[string]string{"cursor": "must be a cursor returned for the same sort"})
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	env := envelope{"cities": cities}
+	if include.Has("time") {
+		data.AttachLocalTimes(cities, time.Now())
+	}
+
+	projected, err := projectEach(fields, cities)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"cities": projected, "metadata": metadata}
 
 	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
@@ -103,6 +198,75 @@ func (app *application) listCitiesHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+var cityListFilterParams = []string{"country_code", "state_code", "timezone", "min_population", "max_population", "bbox"}
+
+func (app *application) readCityFilters(qs url.Values, f *data.Filters, v *validator.Validator) {
+	var err error
+
+	f.CountryCode = app.readString(qs, "country_code", "")
+	f.StateCode = strings.TrimSpace(qs.Get("state_code"))
+	f.Timezone = strings.TrimSpace(qs.Get("timezone"))
+
+	if f.MinPopulation, err = parseOptionalInt64(qs, "min_population"); err != nil {
+		v.AddError("min_population", err.Error())
+	}
+	if f.MaxPopulation, err = parseOptionalInt64(qs, "max_population"); err != nil {
+		v.AddError("max_population", err.Error())
+	}
+	if f.BBox, err = parseBoundingBox(qs, "bbox"); err != nil {
+		v.AddError("bbox", err.Error())
+	}
+}
+
+// maxCostParams caps the repeated cost_param values of a request.
+const maxCostParams = 100
+
+// parseCostParams reads cost_param, which narrows numbeo_cost to the prices of
+// the named params. Numbeo param names contain commas, so the parameter is
+// repeated instead of holding a comma-separated list. Values are matched
+// ignoring case; nil means that every price is kept.
+func parseCostParams(qs url.Values, include data.IncludeSet) ([]string, error) {
+	if !qs.Has("cost_param") {
+		return nil, nil
+	}
+	if !include.Has("numbeo_cost") {
+		return nil, fmt.Errorf("cost_param requires include=numbeo_cost")
+	}
+
+	values := qs["cost_param"]
+	if len(values) > maxCostParams {
+		return nil, fmt.Errorf("cost_param cannot be repeated more than %d times", maxCostParams)
+	}
+
+	params := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, fmt.Errorf("cost_param must not be empty")
+		}
+		if !slices.ContainsFunc(params, func(param string) bool { return strings.EqualFold(param, value) }) {
+			params = append(params, value)
+		}
+	}
+
+	return params, nil
+}
+
+// unknownCostParams returns the cost_param values that name no Numbeo cost
+// param.
+func (app *application) unknownCostParams(params []string) ([]string, error) {
+	items := make([]data.BudgetItem, 0, len(params))
+	for _, param := range params {
+		items = append(items, data.BudgetItem{Param: param})
+	}
+
+	known, err := app.models.Cities.CostParams(items)
+	if err != nil {
+		return nil, err
+	}
+	return data.UnknownCostParams(items, known), nil
+}
+
 func hasDetailedCityInclude(include data.IncludeSet) bool {
 	return include.Has("numbeo_cost") || include.Has("numbeo_indices") || include.Has("avg_climate")
 }
@@ -115,20 +279,55 @@ func (app *application) showCityHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	qs := r.URL.Query()
-	err = validateAllowedQueryParams(qs, newIncludeSet("include"))
+	err = validateAllowedQueryParams(qs, newIncludeSet("include", "fields", "currency", "cost_param"))
 	if err != nil {
 		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
 		return
 	}
 
-	include, err := parseInclude(qs, newIncludeSet("country", "numbeo_cost", "numbeo_indices", "avg_climate"))
+	include, err := parseInclude(qs, newIncludeSet("country", "state", "numbeo_cost", "numbeo_indices", "avg_climate", "time"))
 	if err != nil {
 		app.failedValidationResponse(w, r, map[string]string{"include": err.Error()})
 		return
 	}
+
+	currency, err := parseCurrency(qs)
+	if err == nil && currency != "" && !include.Has("numbeo_cost") {
+		err = fmt.Errorf("currency requires include=numbeo_cost")
+	}
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"currency": err.Error()})
+		return
+	}
+
+	costParams, err := parseCostParams(qs, include)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"cost_param": err.Error()})
+		return
+	}
+
+	fields, include, err := parseFields(qs, cityFieldCatalog, include)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"fields": err.Error()})
+		return
+	}
 	include["country"] = struct{}{}
 
-	city, err := app.models.Cities.GetCity(id, include)
+	if costParams != nil {
+		unknown, err := app.unknownCostParams(costParams)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(unknown) > 0 {
+			app.failedValidationResponse(w, r, map[string]string{
+				"cost_param": fmt.Sprintf("unknown cost params: %s", strings.Join(unknown, "; ")),
+			})
+			return
+		}
+	}
+
+	city, err := app.models.Cities.GetCity(id, include, costParams)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -139,10 +338,121 @@ func (app *application) showCityHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	env := envelope{"city": newCityResponse(city, include)}
+	if currency != "" {
+		err = app.convertNumbeoCosts(r.Context(), currency, city)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if include.Has("time") {
+		data.AttachLocalTimes([]*data.City{city}, time.Now())
+	}
+
+	resp, err := fields.project(newCityResponse(city, include))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"city": resp}
 
 	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *application) nearbyCitiesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("lat", "lon", "radius_km", "limit"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	v := validator.New()
+	lat, lon := app.readCoordinates(qs, v)
+
+	radiusKm, err := parseFloat(qs, "radius_km", 50, 0.1, 500)
+	if err != nil {
+		v.AddError("radius_km", err.Error())
+	}
+
+	limit, err := parseInt(qs, "limit", 20, 1, 100)
+	if err != nil {
+		v.AddError("limit", err.Error())
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	cities, err := app.models.Cities.NearbyCities(lat, lon, radiusKm, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	resp := make([]nearbyCityResponse, 0, len(cities))
+	for _, city := range cities {
+		resp = append(resp, newNearbyCityResponse(city))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"cities": resp}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) locateCityHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("lat", "lon"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	v := validator.New()
+	lat, lon := app.readCoordinates(qs, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	city, err := app.models.Cities.NearestCity(lat, lon)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"city": newNearbyCityResponse(city)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) readCoordinates(qs url.Values, v *validator.Validator) (float64, float64) {
+	v.Check(qs.Has("lat"), "lat", "must be provided")
+	v.Check(qs.Has("lon"), "lon", "must be provided")
+
+	lat, err := parseFloat(qs, "lat", 0, -90, 90)
+	if err != nil {
+		v.AddError("lat", err.Error())
+	}
+
+	lon, err := parseFloat(qs, "lon", 0, -180, 180)
+	if err != nil {
+		v.AddError("lon", err.Error())
+	}
+
+	return lat, lon
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func (app *application) showCityClimateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	err = validateAllowedQueryParams(qs, newIncludeSet("months", "metrics"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	months, metrics, errs := readClimateSelection(qs)
+	if errs != nil {
+		app.failedValidationResponse(w, r, errs)
+		return
+	}
+
+	city, err := app.models.Cities.GetCity(id, newIncludeSet("avg_climate"), nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if city.AvgClimate == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"climate": data.NewCityClimate(city, months, metrics)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listCitiesClimateHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("ids", "months", "metrics"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	ids, idsPresent, err := parseIDsInt64(qs, "ids", app.config.batch.maxIDs)
+	if err == nil && !idsPresent {
+		err = errors.New("ids must be provided")
+	}
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"ids": err.Error()})
+		return
+	}
+
+	months, metrics, errs := readClimateSelection(qs)
+	if errs != nil {
+		app.failedValidationResponse(w, r, errs)
+		return
+	}
+
+	cities, err := app.models.Cities.GetCitiesByIDs(ids, newIncludeSet("avg_climate"), nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	climates := make([]*data.CityClimate, 0, len(cities))
+	for _, city := range cities {
+		if city.AvgClimate != nil {
+			climates = append(climates, data.NewCityClimate(city, months, metrics))
+		}
+	}
+	if len(climates) == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"climates": climates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func readClimateSelection(qs url.Values) ([]int, data.IncludeSet, map[string]string) {
+	errs := map[string]string{}
+
+	months, err := parseMonths(qs, "months")
+	if err != nil {
+		errs["months"] = err.Error()
+	}
+
+	metrics, err := parseValueSet(qs, "metrics", newIncludeSet(data.ClimateMetrics...))
+	if err != nil {
+		errs["metrics"] = err.Error()
+	}
+	if len(metrics) == 0 {
+		metrics = newIncludeSet(data.ClimateMetrics...)
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return months, metrics, nil
+}
+
+func (app *application) climateSearchHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("where", "limit"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	constraints, err := parseClimateConstraints(qs, "where")
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"where": err.Error()})
+		return
+	}
+
+	limit, err := parseInt(qs, "limit", 20, 1, 100)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"limit": err.Error()})
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateClimateConstraints(v, constraints); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	matches, err := app.models.Cities.SearchByClimate(constraints, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"cities": matches}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+)
+
+func (app *application) compareCitiesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("base", "ids", "currency"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	baseID, err := parseRequiredID(qs, "base")
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"base": err.Error()})
+		return
+	}
+
+	ids, _, err := parseIDsInt64(qs, "ids", app.config.batch.maxDetailedIDs-1)
+	if err == nil && len(ids) == 0 {
+		err = fmt.Errorf("ids must be provided")
+	}
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"ids": err.Error()})
+		return
+	}
+
+	currency, err := parseCurrency(qs)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"currency": err.Error()})
+		return
+	}
+
+	cities, err := app.models.Cities.GetCitiesByIDs(append([]int64{baseID}, ids...), data.NewIncludeSet("numbeo_cost", "numbeo_indices"), nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	baseIndex := slices.IndexFunc(cities, func(c *data.City) bool { return c.GeonameID == baseID })
+	if baseIndex == -1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if currency != "" {
+		err = app.convertNumbeoCosts(r.Context(), currency, cities...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Keep the requested order of ids; the base city is compared only if listed.
+	byID := make(map[int64]*data.City, len(cities))
+	for _, city := range cities {
+		byID[city.GeonameID] = city
+	}
+	compared := make([]*data.City, 0, len(ids))
+	for _, id := range ids {
+		if city, ok := byID[id]; ok {
+			compared = append(compared, city)
+		}
+	}
+
+	comparison := data.NewCityComparison(cities[baseIndex], compared, currency)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"comparison": comparison}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,8 +2,9 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
-	"strings"
+	"net/url"
 
 	"github.com/go-chi/chi/v5"
 
@@ -14,7 +15,7 @@ import (
 func (app *application) listCountriesHandler(w http.ResponseWriter, r *http.Request) {
 	qs := r.URL.Query()
 
-	err := validateAllowedQueryParams(qs, newIncludeSet("country_codes", "include"))
+	err := validateAllowedQueryParams(qs, newIncludeSet("country_codes", "include", "fields", "cities_limit", "page_size", "cursor", "sort"))
 	if err != nil {
 		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
 		return
@@ -26,13 +27,40 @@ func (app *application) listCountriesHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	include, err := parseInclude(qs, newIncludeSet("numbeo_indices", "legatum_indices"))
+	include, err := parseInclude(qs, newIncludeSet("numbeo_indices", "legatum_indices", "city_aggregates", "cities", "cities_summary"))
 	if err != nil {
 		app.failedValidationResponse(w, r, map[string]string{"include": err.Error()})
 		return
 	}
 
+	citiesLimit, err := parseCitiesLimit(qs, include)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"cities_limit": err.Error()})
+		return
+	}
+
+	fields, include, err := parseFields(qs, countryFieldCatalog, include)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"fields": err.Error()})
+		return
+	}
+
 	if countryCodesPresent {
+		for _, param := range paginationParams {
+			if qs.Has(param) {
+				app.failedValidationResponse(w, r, map[string]string{
+					"query": param + " cannot be used together with country_codes",
+				})
+				return
+			}
+		}
+
+		codes, err = app.models.Countries.ResolveCodes(codes)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
 		countries, err := app.models.Countries.GetCountriesByCodes(codes, include)
 		if err != nil {
 			switch {
@@ -44,12 +72,24 @@ func (app *application) listCountriesHandler(w http.ResponseWriter, r *http.Requ
 			return
 		}
 
+		err = app.attachCountryCities(countries, include, citiesLimit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
 		resp := make([]countryResponse, 0, len(countries))
 		for _, country := range countries {
 			resp = append(resp, newCountryResponse(country, include))
 		}
 
-		err = app.writeJSON(w, http.StatusOK, envelope{"countries": resp}, nil)
+		projected, err := projectEach(fields, resp)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"countries": projected}, nil)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 		}
@@ -61,13 +101,37 @@ func (app *application) listCountriesHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	countries, err := app.models.Countries.ListCountries()
+	var input data.Filters
+	err = parsePagination(qs, &input, "country_code", data.CountrySortSafelist)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"page_size": err.Error()})
+		return
+	}
+
+	v := validator.New()
+	if data.ValidatePagination(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	countries, metadata, err := app.models.Countries.ListCountries(input)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.failedValidationResponse(w, r, map[string]string{"cursor": "must be a cursor returned for the same sort"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	projected, err := projectEach(fields, countries)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	env := envelope{"countries": countries}
+	env := envelope{"countries": projected, "metadata": metadata}
 
 	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
@@ -81,24 +145,47 @@ func (app *application) showCountryHandler(w http.ResponseWriter, r *http.Reques
 	}
 	v := validator.New()
 	qs := r.URL.Query()
-	err := validateAllowedQueryParams(qs, newIncludeSet("include"))
+	err := validateAllowedQueryParams(qs, newIncludeSet("include", "fields", "cities_limit"))
 	if err != nil {
 		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
 		return
 	}
 
-	input.CountryCode = strings.ToUpper(chi.URLParam(r, "alpha3"))
-	include, err := parseInclude(qs, newIncludeSet("numbeo_indices", "legatum_indices"))
+	input.CountryCode = chi.URLParam(r, "code")
+	include, err := parseInclude(qs, newIncludeSet("numbeo_indices", "legatum_indices", "city_aggregates", "cities", "cities_summary"))
 	if err != nil {
 		app.failedValidationResponse(w, r, map[string]string{"include": err.Error()})
 		return
 	}
 
+	citiesLimit, err := parseCitiesLimit(qs, include)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"cities_limit": err.Error()})
+		return
+	}
+
+	fields, include, err := parseFields(qs, countryFieldCatalog, include)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"fields": err.Error()})
+		return
+	}
+
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	input.CountryCode, err = app.models.Countries.ResolveCode(input.CountryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	country, err := app.models.Countries.GetCountry(input.CountryCode, include)
 	if err != nil {
 		switch {
@@ -110,10 +197,68 @@ func (app *application) showCountryHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	env := envelope{"country": newCountryResponse(country, include)}
+	err = app.attachCountryCities([]*data.Country{country}, include, citiesLimit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	resp, err := fields.project(newCountryResponse(country, include))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"country": resp}
 
 	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func parseCitiesLimit(qs url.Values, include data.IncludeSet) (int, error) {
+	limit, err := parseInt(qs, "cities_limit", data.DefaultCountryCitiesLimit, 1, data.MaxCountryCitiesLimit)
+	if err == nil && qs.Has("cities_limit") && !include.Has("cities") {
+		err = fmt.Errorf("cities_limit requires include=cities")
+	}
+	return limit, err
+}
+
+// attachCountryCities sets the cities and cities_summary blocks requested by
+// include. Countries without cities get an empty list and a zero summary.
+func (app *application) attachCountryCities(countries []*data.Country, include data.IncludeSet, limit int) error {
+	if !include.Has("cities") && !include.Has("cities_summary") {
+		return nil
+	}
+
+	codes := make([]string, 0, len(countries))
+	for _, country := range countries {
+		codes = append(codes, country.Code)
+	}
+
+	if include.Has("cities") {
+		citiesByCode, err := app.models.Cities.ListCitiesByCountries(codes, limit)
+		if err != nil {
+			return err
+		}
+		for _, country := range countries {
+			country.Cities = citiesByCode[country.Code]
+		}
+	}
+
+	if include.Has("cities_summary") {
+		summaries, err := app.models.Cities.SummarizeCitiesByCountries(codes)
+		if err != nil {
+			return err
+		}
+		for _, country := range countries {
+			country.CitiesSummary = summaries[country.Code]
+			if country.CitiesSummary == nil {
+				country.CitiesSummary = &data.CitiesSummary{}
+			}
+		}
+	}
+
+	return nil
+}
@@ -2,8 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/exchangerates"
 )
 
 func (app *application) exchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
@@ -26,3 +32,41 @@ func (app *application) exchangeRatesHandler(w http.ResponseWriter, r *http.Requ
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func parseCurrency(qs url.Values) (string, error) {
+	currency := strings.ToUpper(strings.TrimSpace(qs.Get("currency")))
+	if qs.Has("currency") && !exchangerates.IsSupported(currency) {
+		return "", fmt.Errorf("currency must be one of %s", strings.Join(exchangerates.SupportedCurrencies(), ", "))
+	}
+	return currency, nil
+}
+
+// convertNumbeoCosts converts the numbeo_cost blocks of cities from USD to
+// currency using the current exchange rates.
+func (app *application) convertNumbeoCosts(ctx context.Context, currency string, cities ...*data.City) error {
+	ctx, cancel := context.WithTimeout(ctx, 6*time.Second)
+	defer cancel()
+
+	rates, err := app.exchangeRates.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	rate, err := rates.Rate(currency)
+	if err != nil {
+		return err
+	}
+
+	for _, city := range cities {
+		if city.NumbeoCost != nil {
+			city.NumbeoCost.ConvertCurrency(currency, data.ExchangeRate{
+				Base:      rates.Base,
+				Rate:      rate,
+				Timestamp: rates.Timestamp,
+				Stale:     rates.Stale,
+			})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+)
+
+// fieldSet is a parsed fields= parameter. Keys are top-level response fields and
+// values are the selected sub-fields; an empty value selects the whole field.
+// A nil fieldSet selects everything.
+type fieldSet map[string]data.IncludeSet
+
+// fieldCatalog lists the top-level fields of a response. Fields backed by an
+// include block also list their sub-fields.
+type fieldCatalog map[string][]string
+
+func newFieldCatalog(response any, blocks map[string]any) fieldCatalog {
+	catalog := fieldCatalog{}
+	for _, name := range jsonFieldNames(response) {
+		catalog[name] = nil
+	}
+	for name, block := range blocks {
+		catalog[name] = jsonFieldNames(block)
+	}
+	return catalog
+}
+
+func jsonFieldNames(v any) []string {
+	t := reflect.TypeOf(v)
+	names := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+var cityFieldCatalog = newFieldCatalog(cityResponse{}, map[string]any{
+	"state":          data.State{},
+	"numbeo_cost":    data.NumbeoCost{},
+	"numbeo_indices": data.NumbeoCityIndices{},
+	"avg_climate":    data.AvgClimate{},
+	"time":           data.LocalTime{},
+})
+
+var countryFieldCatalog = newFieldCatalog(countryResponse{}, map[string]any{
+	"numbeo_indices":  data.NumbeoCountryIndices{},
+	"legatum_indices": data.LegatumCountryIndices{},
+	"city_aggregates": data.CityAggregates{},
+	"cities":          cityResponse{},
+	"cities_summary":  data.CitiesSummary{},
+})
+
+// parseFields reads the fields parameter and returns it together with include
+// narrowed to the blocks that fields selects, so that queries skip the work for
+// blocks that would be projected away.
+func parseFields(qs url.Values, catalog fieldCatalog, include data.IncludeSet) (fieldSet, data.IncludeSet, error) {
+	if !qs.Has("fields") {
+		return nil, include, nil
+	}
+
+	raw := strings.TrimSpace(qs.Get("fields"))
+	if raw == "" {
+		return nil, nil, fmt.Errorf("fields must not be empty")
+	}
+
+	fields := fieldSet{}
+	for _, token := range strings.Split(raw, ",") {
+		item := strings.ToLower(strings.TrimSpace(token))
+		if item == "" {
+			return nil, nil, fmt.Errorf("fields contains an empty value")
+		}
+
+		name, sub, nested := strings.Cut(item, ".")
+		allowed, ok := catalog[name]
+		if !ok || (nested && !data.NewIncludeSet(allowed...).Has(sub)) {
+			return nil, nil, fmt.Errorf("fields contains unsupported value %q", item)
+		}
+
+		selected, seen := fields[name]
+		switch {
+		case !nested:
+			fields[name] = data.NewIncludeSet()
+		case !seen:
+			fields[name] = data.NewIncludeSet(sub)
+		case len(selected) > 0:
+			selected[sub] = struct{}{}
+		}
+	}
+
+	narrowed := data.NewIncludeSet()
+	for value := range include {
+		if catalog[value] == nil || fields.has(value) {
+			narrowed[value] = struct{}{}
+		}
+	}
+
+	for name, subFields := range catalog {
+		if subFields != nil && fields.has(name) && !include.Has(name) {
+			return nil, nil, fmt.Errorf("fields contains %q, which requires include=%s", name, name)
+		}
+	}
+
+	return fields, narrowed, nil
+}
+
+func (f fieldSet) has(name string) bool {
+	_, ok := f[name]
+	return ok
+}
+
+// project reduces v, a JSON object, to the selected fields. Sub-fields apply to
+// a nested object or to every object of a nested array. Fields that v omits stay
+// omitted.
+func (f fieldSet) project(v any) (any, error) {
+	if f == nil {
+		return v, nil
+	}
+
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(js, &object); err != nil {
+		return nil, err
+	}
+
+	projected := make(map[string]json.RawMessage, len(f))
+	for name, subFields := range f {
+		value, ok := object[name]
+		if !ok {
+			continue
+		}
+
+		if len(subFields) == 0 {
+			projected[name] = value
+			continue
+		}
+
+		var (
+			nested     map[string]json.RawMessage
+			nestedList []map[string]json.RawMessage
+		)
+		switch {
+		case json.Unmarshal(value, &nested) == nil && nested != nil:
+			keepFields(nested, subFields)
+			projected[name], err = json.Marshal(nested)
+		case json.Unmarshal(value, &nestedList) == nil && nestedList != nil:
+			for _, item := range nestedList {
+				keepFields(item, subFields)
+			}
+			projected[name], err = json.Marshal(nestedList)
+		default:
+			projected[name] = value
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return projected, nil
+}
+
+func keepFields(object map[string]json.RawMessage, fields data.IncludeSet) {
+	for key := range object {
+		if !fields.Has(key) {
+			delete(object, key)
+		}
+	}
+}
+
+func projectEach[T any](f fieldSet, items []T) (any, error) {
+	if f == nil {
+		return items, nil
+	}
+
+	projected := make([]any, 0, len(items))
+	for _, item := range items {
+		value, err := f.project(item)
+		if err != nil {
+			return nil, err
+		}
+		projected = append(projected, value)
+	}
+
+	return projected, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+)
+
+// TestParseFields tests parsing and validation for the fields query parameter.
+func TestParseFields(t *testing.T) {
+	t.Run("absent keeps include", func(t *testing.T) {
+		fields, include, err := parseFields(url.Values{}, cityFieldCatalog, newIncludeSet("avg_climate"))
+		if err != nil || fields != nil || !include.Has("avg_climate") {
+			t.Fatalf("got %v, %v, %v", fields, include, err)
+		}
+	})
+
+	t.Run("narrows include to selected blocks", func(t *testing.T) {
+		qs := url.Values{"fields": []string{"geoname_id, avg_climate.high_temp"}}
+		fields, include, err := parseFields(qs, cityFieldCatalog, newIncludeSet("country", "numbeo_cost", "avg_climate"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !include.Has("country") || !include.Has("avg_climate") || include.Has("numbeo_cost") {
+			t.Fatalf("unexpected include: %v", include)
+		}
+		if !fields["avg_climate"].Has("high_temp") || len(fields["geoname_id"]) != 0 {
+			t.Fatalf("unexpected fields: %v", fields)
+		}
+	})
+
+	t.Run("whole field wins over sub-fields", func(t *testing.T) {
+		qs := url.Values{"fields": []string{"numbeo_indices.safety,numbeo_indices"}}
+		fields, _, err := parseFields(qs, countryFieldCatalog, newIncludeSet("numbeo_indices"))
+		if err != nil || len(fields["numbeo_indices"]) != 0 {
+			t.Fatalf("got %v, %v", fields, err)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{name: "empty", raw: "", wantErr: "fields must not be empty"},
+		{name: "empty token", raw: "city,,country", wantErr: "fields contains an empty value"},
+		{name: "unknown field", raw: "city,mayor", wantErr: `fields contains unsupported value "mayor"`},
+		{name: "unknown sub-field", raw: "avg_climate.tides", wantErr: `fields contains unsupported value "avg_climate.tides"`},
+		{name: "sub-field of scalar", raw: "city.name", wantErr: `fields contains unsupported value "city.name"`},
+		{name: "block without include", raw: "numbeo_cost", wantErr: `fields contains "numbeo_cost", which requires include=numbeo_cost`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qs := url.Values{"fields": []string{tt.raw}}
+			_, _, err := parseFields(qs, cityFieldCatalog, newIncludeSet("avg_climate"))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestFieldSetProject tests response projection with top-level and dotted fields.
+func TestFieldSetProject(t *testing.T) {
+	safety := 61.8
+	res := newCountryResponse(&data.Country{
+		Code:                 "RUS",
+		Name:                 "Russian Federation",
+		NumbeoCountryIndices: &data.NumbeoCountryIndices{Safety: &safety, LastUpdate: "2026-03-12"},
+	}, newIncludeSet("numbeo_indices"))
+
+	fields := fieldSet{"country_code": newIncludeSet(), "numbeo_indices": newIncludeSet("safety"), "legatum_indices": newIncludeSet()}
+	projected, err := fields.project(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := json.Marshal(projected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"country_code":"RUS","numbeo_indices":{"safety":61.8}}`; string(js) != want {
+		t.Fatalf("got %s, want %s", js, want)
+	}
+}
+
+// TestFieldSetProjectArray tests that dotted fields apply to every object of a
+// nested array.
+func TestFieldSetProjectArray(t *testing.T) {
+	res := newCountryResponse(&data.Country{
+		Code: "RUS",
+		Cities: []*data.City{
+			{GeonameID: 524901, Name: "Moscow", CountryCode: "RUS"},
+			{GeonameID: 498817, Name: "Saint Petersburg", CountryCode: "RUS"},
+		},
+	}, newIncludeSet("cities"))
+
+	fields := fieldSet{"cities": newIncludeSet("city")}
+	projected, err := fields.project(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := json.Marshal(projected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"cities":[{"city":"Moscow"},{"city":"Saint Petersburg"}]}`; string(js) != want {
+		t.Fatalf("got %s, want %s", js, want)
+	}
+}
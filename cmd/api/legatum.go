@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+// maxLegatumYear only bounds the from and to parameters; editions are not tied
+// to a fixed range.
+const maxLegatumYear = 2100
+
+func (app *application) countryLegatumHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("pillars", "from", "to"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	var input data.Filters
+	input.CountryCode = chi.URLParam(r, "code")
+
+	v := validator.New()
+	if data.ValidateFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	input.CountryCode, err = app.models.Countries.ResolveCode(input.CountryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	pillars, err := parseValueSet(qs, "pillars", newIncludeSet(data.LegatumPillarKeys()...))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"pillars": err.Error()})
+		return
+	}
+
+	filters := data.LegatumFilters{Pillars: pillars}
+
+	if filters.From, err = parseInt(qs, "from", 0, data.LegatumFirstYear, maxLegatumYear); err != nil {
+		v.AddError("from", err.Error())
+	}
+	if filters.To, err = parseInt(qs, "to", 0, data.LegatumFirstYear, maxLegatumYear); err != nil {
+		v.AddError("to", err.Error())
+	}
+	v.Check(filters.From == 0 || filters.To == 0 || filters.From <= filters.To, "to", "to must not be before from")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	series, err := app.models.Countries.GetLegatumSeries(input.CountryCode, filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"legatum": series}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) legatumTrendsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("pillar", "from", "to", "limit"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	v := validator.New()
+	input := data.LegatumTrendQuery{Pillar: strings.ToLower(strings.TrimSpace(qs.Get("pillar")))}
+	v.Check(input.Pillar != "", "pillar", "must be provided")
+
+	if input.From, err = parseInt(qs, "from", 0, data.LegatumFirstYear, maxLegatumYear); err != nil {
+		v.AddError("from", err.Error())
+	}
+	if input.To, err = parseInt(qs, "to", 0, data.LegatumFirstYear, maxLegatumYear); err != nil {
+		v.AddError("to", err.Error())
+	}
+	if input.Limit, err = parseInt(qs, "limit", 10, 1, data.MaxLegatumTrendLimit); err != nil {
+		v.AddError("limit", err.Error())
+	}
+
+	if data.ValidateLegatumTrendQuery(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	trends, err := app.models.Countries.LegatumTrends(input)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrLegatumYearRange):
+			app.failedValidationResponse(w, r, map[string]string{"to": err.Error()})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"trends": trends}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -41,7 +42,8 @@ type config struct {
 		enabled bool
 	}
 	auth struct {
-		enabled bool
+		enabled     bool
+		adminEmails []string
 	}
 	metrics struct {
 		port int
@@ -63,13 +65,14 @@ type config struct {
 }
 
 type application struct {
-	config        config
-	logger        *slog.Logger
-	db            *sql.DB
-	models        data.Models
-	mailer        mailer.Mailer
-	exchangeRates *exchangerates.Service
-	wg            sync.WaitGroup
+	config         config
+	logger         *slog.Logger
+	db             *sql.DB
+	models         data.Models
+	mailer         mailer.Mailer
+	exchangeRates  *exchangerates.Service
+	featureRefresh featureRefresher
+	wg             sync.WaitGroup
 }
 
 func main() {
@@ -133,6 +136,11 @@ func parseFlags() (config, error) {
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 20, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
 	flag.BoolVar(&cfg.auth.enabled, "auth-enabled", true, "Enable authentication and activated-user checks")
+	cfg.auth.adminEmails = parseAdminEmails(os.Getenv("RELOHELPER_ADMIN_EMAILS"))
+	flag.Func("admin-emails", "Comma-separated emails of users allowed to use the admin API", func(value string) error {
+		cfg.auth.adminEmails = parseAdminEmails(value)
+		return nil
+	})
 	flag.IntVar(&cfg.metrics.port, "metrics-port", 0, "Dedicated internal Prometheus metrics port; 0 serves /metrics on the main API port")
 	flag.IntVar(&cfg.batch.maxIDs, "batch-max-ids", 100, "Maximum number of unique IDs in batch query parameters")
 	flag.IntVar(&cfg.batch.maxDetailedIDs, "batch-max-detailed-ids", 20, "Maximum number of unique city IDs in batch query when detailed include blocks are requested")
@@ -156,6 +164,16 @@ func parseFlags() (config, error) {
 	return cfg, nil
 }
 
+func parseAdminEmails(value string) []string {
+	var emails []string
+	for email := range strings.SplitSeq(value, ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
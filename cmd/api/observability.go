@@ -224,6 +224,13 @@ func (app *application) collectPrometheusMetrics(next http.Handler) http.Handler
 	})
 }
 
+// legacyRouteLabels maps route patterns whose URL parameter was renamed to the
+// label they were recorded under before, so their metric series stay continuous.
+var legacyRouteLabels = map[string]string{
+	"/countries/{code}":         "/countries/{alpha3}",
+	"/countries/{code}/legatum": "/countries/{alpha3}/legatum",
+}
+
 func requestRoute(r *http.Request) string {
 	routeContext := chi.RouteContext(r.Context())
 	if routeContext == nil {
@@ -232,6 +239,9 @@ func requestRoute(r *http.Request) string {
 
 	routePattern := routeContext.RoutePattern()
 	if routePattern != "" {
+		if label, ok := legacyRouteLabels[routePattern]; ok {
+			routePattern = label
+		}
 		return requestRouteMode(routePattern, r)
 	}
 
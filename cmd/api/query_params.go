@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/url"
 	"sort"
 	"strconv"
@@ -33,25 +34,75 @@ func validateAllowedQueryParams(qs url.Values, allowed data.IncludeSet) error {
 }
 
 func parseInclude(qs url.Values, allowed data.IncludeSet) (data.IncludeSet, error) {
-	raw := strings.TrimSpace(qs.Get("include"))
+	return parseValueSet(qs, "include", allowed)
+}
+
+func parseValueSet(qs url.Values, key string, allowed data.IncludeSet) (data.IncludeSet, error) {
+	raw := strings.TrimSpace(qs.Get(key))
 	if raw == "" {
 		return newIncludeSet(), nil
 	}
 
-	include := newIncludeSet()
+	set := newIncludeSet()
 	for _, token := range strings.Split(raw, ",") {
 		item := strings.ToLower(strings.TrimSpace(token))
 		if item == "" {
-			return nil, fmt.Errorf("include contains an empty value")
+			return nil, fmt.Errorf("%s contains an empty value", key)
 		}
 		if !allowed.Has(item) {
-			return nil, fmt.Errorf("include contains unsupported value %q", item)
+			return nil, fmt.Errorf("%s contains unsupported value %q", key, item)
 		}
 
-		include[item] = struct{}{}
+		set[item] = struct{}{}
+	}
+
+	return set, nil
+}
+
+func parseInt(qs url.Values, key string, defaultValue, min, max int) (int, error) {
+	if !qs.Has(key) {
+		return defaultValue, nil
+	}
+
+	raw := strings.TrimSpace(qs.Get(key))
+	if raw == "" {
+		return 0, fmt.Errorf("%s must not be empty", key)
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", key)
+	}
+	if value < min || value > max {
+		return 0, fmt.Errorf("%s must be between %d and %d", key, min, max)
+	}
+
+	return value, nil
+}
+
+func parseFloat(qs url.Values, key string, defaultValue, min, max float64) (float64, error) {
+	if !qs.Has(key) {
+		return defaultValue, nil
 	}
 
-	return include, nil
+	raw := strings.TrimSpace(qs.Get(key))
+	if raw == "" {
+		return 0, fmt.Errorf("%s must not be empty", key)
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("%s must be a number", key)
+	}
+	if value < min || value > max {
+		return 0, fmt.Errorf("%s must be between %s and %s", key, formatFloat(min), formatFloat(max))
+	}
+
+	return value, nil
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
 }
 
 func parseIDsInt64(qs url.Values, key string, max int) ([]int64, bool, error) {
@@ -137,3 +188,214 @@ func parseIDsString(qs url.Values, key string, max int) ([]string, bool, error)
 
 	return ids, true, nil
 }
+
+var paginationParams = []string{"page_size", "cursor", "sort"}
+
+// parsePagination reads page_size, cursor and sort into f. List endpoints are
+// always paginated; page_size defaults to data.DefaultPageSize.
+func parsePagination(qs url.Values, f *data.Filters, defaultSort string, safelist []string) error {
+	pageSize, err := parseInt(qs, "page_size", data.DefaultPageSize, 1, data.MaxPageSize)
+	if err != nil {
+		return err
+	}
+
+	f.Cursor = strings.TrimSpace(qs.Get("cursor"))
+	f.PageSize = pageSize
+
+	f.Sort = strings.TrimSpace(qs.Get("sort"))
+	if f.Sort == "" {
+		f.Sort = defaultSort
+	}
+	f.SortSafelist = safelist
+
+	return nil
+}
+
+func parseOptionalInt64(qs url.Values, key string) (*int64, error) {
+	if !qs.Has(key) {
+		return nil, nil
+	}
+
+	raw := strings.TrimSpace(qs.Get(key))
+	if raw == "" {
+		return nil, fmt.Errorf("%s must not be empty", key)
+	}
+
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", key)
+	}
+
+	return &value, nil
+}
+
+// parseRequiredID reads a single positive identifier.
+func parseRequiredID(qs url.Values, key string) (int64, error) {
+	id, err := parseOptionalInt64(qs, key)
+	switch {
+	case err != nil:
+		return 0, err
+	case id == nil:
+		return 0, fmt.Errorf("%s must be provided", key)
+	case *id <= 0:
+		return 0, fmt.Errorf("%s must be a positive integer", key)
+	}
+
+	return *id, nil
+}
+
+func parseBoundingBox(qs url.Values, key string) (*data.BoundingBox, error) {
+	if !qs.Has(key) {
+		return nil, nil
+	}
+
+	parts := strings.Split(qs.Get(key), ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("%s must be minLon,minLat,maxLon,maxLat", key)
+	}
+
+	values := make([]float64, 0, 4)
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, fmt.Errorf("%s must contain only numbers", key)
+		}
+		values = append(values, value)
+	}
+
+	return &data.BoundingBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}, nil
+}
+
+// parseMonths reads a comma-separated list of months (1-12). Requested order is
+// kept and duplicates are dropped; when the key is absent all months are returned.
+func parseMonths(qs url.Values, key string) ([]int, error) {
+	if !qs.Has(key) {
+		return []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, nil
+	}
+
+	values, _, err := parseIDsInt64(qs, key, 12)
+	if err != nil {
+		return nil, err
+	}
+
+	months := make([]int, 0, len(values))
+	for _, value := range values {
+		if value > 12 {
+			return nil, fmt.Errorf("%s must contain only values between 1 and 12", key)
+		}
+		months = append(months, int(value))
+	}
+
+	return months, nil
+}
+
+// parseClimateConstraints reads repeated key values of the form
+// metric:months:min..max, for example high_temp:7:22..27 or rainfall_days:6-8:..8.
+// Months are a single month or an inclusive range that may wrap past December.
+func parseClimateConstraints(qs url.Values, key string) ([]data.ClimateConstraint, error) {
+	constraints := make([]data.ClimateConstraint, 0, len(qs[key]))
+
+	for _, raw := range qs[key] {
+		parts := strings.Split(strings.TrimSpace(raw), ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%s value %q must have the form metric:months:min..max", key, raw)
+		}
+
+		months, err := parseMonthRange(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s value %q has invalid months", key, raw)
+		}
+
+		lower, upper, found := strings.Cut(parts[2], "..")
+		if !found {
+			return nil, fmt.Errorf("%s value %q must have a min..max range", key, raw)
+		}
+		minValue, err := parseOptionalBound(lower)
+		if err != nil {
+			return nil, fmt.Errorf("%s value %q has a non-numeric bound", key, raw)
+		}
+		maxValue, err := parseOptionalBound(upper)
+		if err != nil {
+			return nil, fmt.Errorf("%s value %q has a non-numeric bound", key, raw)
+		}
+
+		constraints = append(constraints, data.ClimateConstraint{
+			Metric: strings.ToLower(strings.TrimSpace(parts[0])),
+			Months: months,
+			Min:    minValue,
+			Max:    maxValue,
+		})
+	}
+
+	return constraints, nil
+}
+
+func parseMonthRange(raw string) ([]int, error) {
+	first, last, isRange := strings.Cut(strings.TrimSpace(raw), "-")
+	if !isRange {
+		last = first
+	}
+
+	from, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return nil, err
+	}
+	to, err := strconv.Atoi(strings.TrimSpace(last))
+	if err != nil {
+		return nil, err
+	}
+	if from < 1 || from > 12 || to < 1 || to > 12 {
+		return nil, fmt.Errorf("months must be between 1 and 12")
+	}
+
+	months := []int{from}
+	for month := from; month != to; {
+		month = month%12 + 1
+		months = append(months, month)
+	}
+
+	return months, nil
+}
+
+func parseOptionalBound(raw string) (*float64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("bound must be a number")
+	}
+
+	return &value, nil
+}
+
+// parseScoreWeights reads a comma-separated list of index:weight pairs, for
+// example safety:0.4,cost_of_living:-0.3.
+func parseScoreWeights(qs url.Values, key string) ([]data.ScoreWeight, error) {
+	raw := strings.TrimSpace(qs.Get(key))
+	if raw == "" {
+		return nil, nil
+	}
+
+	weights := []data.ScoreWeight{}
+	for _, token := range strings.Split(raw, ",") {
+		index, rawWeight, found := strings.Cut(strings.TrimSpace(token), ":")
+		if !found {
+			return nil, fmt.Errorf("%s value %q must have the form index:weight", key, token)
+		}
+
+		weight, err := strconv.ParseFloat(strings.TrimSpace(rawWeight), 64)
+		if err != nil || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("%s value %q has a non-numeric weight", key, token)
+		}
+
+		weights = append(weights, data.ScoreWeight{
+			Index:  strings.ToLower(strings.TrimSpace(index)),
+			Weight: weight,
+		})
+	}
+
+	return weights, nil
+}
@@ -4,6 +4,8 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
 )
 
 // TestParseInclude tests the include query parameter parser.
@@ -191,3 +193,251 @@ func TestParseIDsString(t *testing.T) {
 		}
 	})
 }
+
+// TestParseValueSet tests the generic comma-separated value set parser.
+func TestParseValueSet(t *testing.T) {
+	t.Run("uses key in error", func(t *testing.T) {
+		qs := url.Values{"types": []string{"city,planet"}}
+		_, err := parseValueSet(qs, "types", newIncludeSet("city", "country"))
+		if err == nil || err.Error() != `types contains unsupported value "planet"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("normalize and dedupe", func(t *testing.T) {
+		qs := url.Values{"types": []string{"City, country,city"}}
+		got, err := parseValueSet(qs, "types", newIncludeSet("city", "country"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !got.Has("city") || !got.Has("country") || len(got) != 2 {
+			t.Fatalf("unexpected set: %v", got)
+		}
+	})
+}
+
+// TestParseInt tests parsing and bounds checking for integer query parameters.
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		qs      url.Values
+		want    int
+		wantErr string
+	}{
+		{name: "default when absent", qs: url.Values{}, want: 10},
+		{name: "valid value", qs: url.Values{"limit": []string{" 25 "}}, want: 25},
+		{name: "empty value", qs: url.Values{"limit": []string{""}}, wantErr: "limit must not be empty"},
+		{name: "non integer", qs: url.Values{"limit": []string{"ten"}}, wantErr: "limit must be an integer"},
+		{name: "below min", qs: url.Values{"limit": []string{"0"}}, wantErr: "limit must be between 1 and 50"},
+		{name: "above max", qs: url.Values{"limit": []string{"51"}}, wantErr: "limit must be between 1 and 50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseInt(tt.qs, "limit", 10, 1, 50)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseFloat tests parsing and bounds checking for float query parameters.
+func TestParseFloat(t *testing.T) {
+	t.Run("default when absent", func(t *testing.T) {
+		got, err := parseFloat(url.Values{}, "radius_km", 50, 0.1, 500)
+		if err != nil || got != 50 {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	})
+
+	t.Run("valid value", func(t *testing.T) {
+		got, err := parseFloat(url.Values{"lat": []string{"-33.86785"}}, "lat", 0, -90, 90)
+		if err != nil || got != -33.86785 {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	})
+
+	t.Run("reject nan", func(t *testing.T) {
+		_, err := parseFloat(url.Values{"lat": []string{"NaN"}}, "lat", 0, -90, 90)
+		if err == nil || err.Error() != "lat must be a number" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("reject out of range", func(t *testing.T) {
+		_, err := parseFloat(url.Values{"radius_km": []string{"0"}}, "radius_km", 50, 0.1, 500)
+		if err == nil || err.Error() != "radius_km must be between 0.1 and 500" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// TestParseOptionalInt64 tests parsing for optional int64 query parameters.
+func TestParseOptionalInt64(t *testing.T) {
+	t.Run("nil when absent", func(t *testing.T) {
+		got, err := parseOptionalInt64(url.Values{}, "min_population")
+		if err != nil || got != nil {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	})
+
+	t.Run("valid value", func(t *testing.T) {
+		got, err := parseOptionalInt64(url.Values{"min_population": []string{"500000"}}, "min_population")
+		if err != nil || got == nil || *got != 500000 {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	})
+
+	t.Run("reject non integer", func(t *testing.T) {
+		_, err := parseOptionalInt64(url.Values{"min_population": []string{"1e6"}}, "min_population")
+		if err == nil || err.Error() != "min_population must be an integer" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// TestParseBoundingBox tests parsing for the bbox query parameter.
+func TestParseBoundingBox(t *testing.T) {
+	t.Run("nil when absent", func(t *testing.T) {
+		got, err := parseBoundingBox(url.Values{}, "bbox")
+		if err != nil || got != nil {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	})
+
+	t.Run("valid value", func(t *testing.T) {
+		got, err := parseBoundingBox(url.Values{"bbox": []string{"-10.5, 35,40,71"}}, "bbox")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := data.BoundingBox{MinLon: -10.5, MinLat: 35, MaxLon: 40, MaxLat: 71}
+		if *got != want {
+			t.Fatalf("got %+v, want %+v", *got, want)
+		}
+	})
+
+	t.Run("reject wrong arity", func(t *testing.T) {
+		_, err := parseBoundingBox(url.Values{"bbox": []string{"1,2,3"}}, "bbox")
+		if err == nil || err.Error() != "bbox must be minLon,minLat,maxLon,maxLat" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("reject non numeric", func(t *testing.T) {
+		_, err := parseBoundingBox(url.Values{"bbox": []string{"1,2,3,north"}}, "bbox")
+		if err == nil || err.Error() != "bbox must contain only numbers" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// TestParseMonths tests parsing and validation for the months query parameter.
+func TestParseMonths(t *testing.T) {
+	t.Run("all months when absent", func(t *testing.T) {
+		got, err := parseMonths(url.Values{}, "months")
+		if err != nil || len(got) != 12 || got[0] != 1 || got[11] != 12 {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	})
+
+	t.Run("keep order and dedupe", func(t *testing.T) {
+		got, err := parseMonths(url.Values{"months": []string{"12,1,2,1"}}, "months")
+		if err != nil || !reflect.DeepEqual(got, []int{12, 1, 2}) {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	})
+
+	t.Run("reject out of range", func(t *testing.T) {
+		_, err := parseMonths(url.Values{"months": []string{"6,13"}}, "months")
+		if err == nil || err.Error() != "months must contain only values between 1 and 12" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// TestParseClimateConstraints tests parsing for the climate search where parameter.
+func TestParseClimateConstraints(t *testing.T) {
+	qs := url.Values{"where": []string{"High_Temp:7:22..27", "rainfall_days:11-2:..8", "sea_temp:6:-1.5.."}}
+	got, err := parseClimateConstraints(qs, "where")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d constraints, want 3", len(got))
+	}
+	if got[0].Metric != "high_temp" || *got[0].Min != 22 || *got[0].Max != 27 || !reflect.DeepEqual(got[0].Months, []int{7}) {
+		t.Fatalf("unexpected first constraint: %+v", got[0])
+	}
+	if got[1].Min != nil || *got[1].Max != 8 || !reflect.DeepEqual(got[1].Months, []int{11, 12, 1, 2}) {
+		t.Fatalf("unexpected second constraint: %+v", got[1])
+	}
+	if *got[2].Min != -1.5 || got[2].Max != nil {
+		t.Fatalf("unexpected third constraint: %+v", got[2])
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{name: "missing part", raw: "high_temp:22..27", wantErr: `where value "high_temp:22..27" must have the form metric:months:min..max`},
+		{name: "bad month", raw: "high_temp:13:22..27", wantErr: `where value "high_temp:13:22..27" has invalid months`},
+		{name: "missing range", raw: "high_temp:7:22", wantErr: `where value "high_temp:7:22" must have a min..max range`},
+		{name: "bad bound", raw: "high_temp:7:warm..27", wantErr: `where value "high_temp:7:warm..27" has a non-numeric bound`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseClimateConstraints(url.Values{"where": []string{tt.raw}}, "where")
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestParseScoreWeights tests parsing for the score weights query parameter.
+func TestParseScoreWeights(t *testing.T) {
+	got, err := parseScoreWeights(url.Values{"weights": []string{"Safety:0.4, cost_of_living:-0.3"}}, "weights")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []data.ScoreWeight{{Index: "safety", Weight: 0.4}, {Index: "cost_of_living", Weight: -0.3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	got, err = parseScoreWeights(url.Values{}, "weights")
+	if err != nil || got != nil {
+		t.Fatalf("got %+v, %v for missing weights", got, err)
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{name: "missing weight", raw: "safety", wantErr: `weights value "safety" must have the form index:weight`},
+		{name: "bad weight", raw: "safety:high", wantErr: `weights value "safety:high" has a non-numeric weight`},
+		{name: "infinite weight", raw: "safety:Inf", wantErr: `weights value "safety:Inf" has a non-numeric weight`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseScoreWeights(url.Values{"weights": []string{tt.raw}}, "weights")
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func (app *application) cityRankingsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("index", "order", "limit", "country_code", "min_population", "max_population"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	v := validator.New()
+	input := app.readRankingQuery(qs, v)
+	input.Filters.CountryCode = app.readString(qs, "country_code", "")
+
+	if input.Filters.CountryCode != "" {
+		data.ValidateFilters(v, input.Filters)
+	}
+	data.ValidateCityFilters(v, input.Filters)
+	if data.ValidateRankingQuery(v, input, data.CityRankingIndices); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Filters.CountryCode != "" {
+		input.Filters.CountryCode, err = app.models.Countries.ResolveCode(input.Filters.CountryCode)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	rankings, metadata, err := app.models.Cities.RankCities(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"rankings": rankings, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) countryRankingsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("index", "order", "limit", "min_population", "max_population"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	v := validator.New()
+	input := app.readRankingQuery(qs, v)
+
+	data.ValidateCityFilters(v, input.Filters)
+	if data.ValidateRankingQuery(v, input, data.CountryRankingIndices); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rankings, metadata, err := app.models.Countries.RankCountries(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"rankings": rankings, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readRankingQuery reads the parameters shared by the ranking endpoints. Errors
+// are added to v; range checks are left to data.ValidateRankingQuery.
+func (app *application) readRankingQuery(qs url.Values, v *validator.Validator) data.RankingQuery {
+	var (
+		q   data.RankingQuery
+		err error
+	)
+
+	q.Index = strings.ToLower(strings.TrimSpace(qs.Get("index")))
+	v.Check(q.Index != "", "index", "must be provided")
+	q.Order = strings.ToLower(app.readString(qs, "order", "desc"))
+
+	if q.Limit, err = parseInt(qs, "limit", 20, 1, data.MaxRankingLimit); err != nil {
+		v.AddError("limit", err.Error())
+	}
+	if q.Filters.MinPopulation, err = parseOptionalInt64(qs, "min_population"); err != nil {
+		v.AddError("min_population", err.Error())
+	}
+	if q.Filters.MaxPopulation, err = parseOptionalInt64(qs, "max_population"); err != nil {
+		v.AddError("max_population", err.Error())
+	}
+
+	return q
+}
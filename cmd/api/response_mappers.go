@@ -1,11 +1,16 @@
 package main
 
-import "github.com/denis-k2/relohelper-go/internal/data"
+import (
+	"math"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+)
 
 type cityResponse struct {
 	CityID        int64   `json:"geoname_id"`
 	City          string  `json:"city"`
 	StateCode     *string `json:"state_code,omitzero"`
+	State         any     `json:"state,omitzero"`
 	CountryCode   string  `json:"country_code"`
 	Country       string  `json:"country"`
 	Population    *int64  `json:"population"`
@@ -16,6 +21,7 @@ type cityResponse struct {
 	NumbeoCost    any     `json:"numbeo_cost,omitzero"`
 	NumbeoIndices any     `json:"numbeo_indices,omitzero"`
 	AvgClimate    any     `json:"avg_climate,omitzero"`
+	Time          any     `json:"time,omitzero"`
 }
 
 func newCityResponse(city *data.City, include data.IncludeSet) cityResponse {
@@ -32,6 +38,9 @@ func newCityResponse(city *data.City, include data.IncludeSet) cityResponse {
 		LastUpdate:  city.LastUpdate,
 	}
 
+	if include.Has("state") && city.State != nil {
+		res.State = city.State
+	}
 	if include.Has("numbeo_cost") {
 		res.NumbeoCost = city.NumbeoCost
 	}
@@ -41,27 +50,49 @@ func newCityResponse(city *data.City, include data.IncludeSet) cityResponse {
 	if include.Has("avg_climate") {
 		res.AvgClimate = city.AvgClimate
 	}
+	if include.Has("time") && city.Time != nil {
+		res.Time = city.Time
+	}
 
 	return res
 }
 
+type nearbyCityResponse struct {
+	cityResponse
+	DistanceKm float64 `json:"distance_km"`
+}
+
+func newNearbyCityResponse(city *data.NearbyCity) nearbyCityResponse {
+	return nearbyCityResponse{
+		cityResponse: newCityResponse(city.City, newIncludeSet()),
+		DistanceKm:   math.Round(city.DistanceKm*100) / 100,
+	}
+}
+
 type countryResponse struct {
-	Code           string `json:"country_code"`
-	Name           string `json:"country"`
-	Population     *int64 `json:"population"`
-	Area           *int64 `json:"area"`
-	LastUpdate     string `json:"last_update"`
-	NumbeoIndices  any    `json:"numbeo_indices,omitzero"`
-	LegatumIndices any    `json:"legatum_indices,omitzero"`
+	Code           string  `json:"country_code"`
+	Alpha2Code     *string `json:"alpha2_code"`
+	NumericCode    *string `json:"numeric_code"`
+	Name           string  `json:"country"`
+	Population     *int64  `json:"population"`
+	Area           *int64  `json:"area"`
+	LastUpdate     string  `json:"last_update"`
+	NumbeoIndices  any     `json:"numbeo_indices,omitzero"`
+	LegatumIndices any     `json:"legatum_indices,omitzero"`
+	CityAggregates any     `json:"city_aggregates,omitzero"`
+	Cities         any     `json:"cities,omitzero"`
+	CitiesSummary  any     `json:"cities_summary,omitzero"`
 }
 
 func newCountryResponse(country *data.Country, include data.IncludeSet) countryResponse {
 	res := countryResponse{
-		Code:       country.Code,
-		Name:       country.Name,
-		Population: country.Population,
-		Area:       country.Area,
-		LastUpdate: country.LastUpdate,
+		Code:        country.Code,
+		Alpha2Code:  country.Alpha2Code,
+		NumericCode: country.NumericCode,
+		Name:        country.Name,
+		Population:  country.Population,
+		Area:        country.Area,
+		LastUpdate:  country.LastUpdate,
 	}
 
 	if include.Has("numbeo_indices") {
@@ -70,6 +101,19 @@ func newCountryResponse(country *data.Country, include data.IncludeSet) countryR
 	if include.Has("legatum_indices") {
 		res.LegatumIndices = country.LegatumCountryIndices
 	}
+	if include.Has("city_aggregates") {
+		res.CityAggregates = country.CityAggregates
+	}
+	if include.Has("cities") {
+		cities := make([]cityResponse, 0, len(country.Cities))
+		for _, city := range country.Cities {
+			cities = append(cities, newCityResponse(city, newIncludeSet()))
+		}
+		res.Cities = cities
+	}
+	if include.Has("cities_summary") {
+		res.CitiesSummary = country.CitiesSummary
+	}
 
 	return res
 }
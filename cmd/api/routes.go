@@ -38,15 +38,48 @@ func (app *application) routes() http.Handler {
 	}
 
 	router.Get("/cities", app.listCitiesHandler)
+	router.Get("/cities/nearby", app.nearbyCitiesHandler)
+	router.Get("/cities/locate", app.locateCityHandler)
+	router.Get("/cities/climate", app.listCitiesClimateHandler)
+	router.Get("/cities/climate-search", app.climateSearchHandler)
+	router.Get("/cities/score", app.cityScoresHandler)
 	router.Get("/countries", app.listCountriesHandler)
+	router.Get("/countries/score", app.countryScoresHandler)
+	router.Get("/states", app.listStatesHandler)
+	router.Get("/states/{code}", app.showStateHandler)
+	router.Get("/compare/cities", app.compareCitiesHandler)
+	router.Get("/salary-equivalence", app.salaryEquivalenceHandler)
+	router.Get("/rankings/cities", app.cityRankingsHandler)
+	router.Get("/rankings/countries", app.countryRankingsHandler)
+	router.Get("/legatum/trends", app.legatumTrendsHandler)
+	router.Get("/timezones/overlap", app.timezoneOverlapHandler)
+	router.Get("/search", app.searchHandler)
 	if app.config.auth.enabled {
 		router.With(app.requireActivatedUser).Get("/cities/{id}", app.showCityHandler)
-		router.With(app.requireActivatedUser).Get("/countries/{alpha3}", app.showCountryHandler)
+		router.With(app.requireActivatedUser).Get("/cities/{id}/climate", app.showCityClimateHandler)
+		router.With(app.requireActivatedUser).Get("/cities/{id}/similar", app.similarCitiesHandler)
+		router.With(app.requireActivatedUser).Get("/countries/{code}", app.showCountryHandler)
+		router.With(app.requireActivatedUser).Get("/countries/{code}/legatum", app.countryLegatumHandler)
 	} else {
 		router.Get("/cities/{id}", app.showCityHandler)
-		router.Get("/countries/{alpha3}", app.showCountryHandler)
+		router.Get("/cities/{id}/climate", app.showCityClimateHandler)
+		router.Get("/cities/{id}/similar", app.similarCitiesHandler)
+		router.Get("/countries/{code}", app.showCountryHandler)
+		router.Get("/countries/{code}/legatum", app.countryLegatumHandler)
 	}
 
+	if app.config.auth.enabled {
+		router.Route("/admin", func(r chi.Router) {
+			r.Use(app.requireAdminUser)
+			r.Post("/cities/{id}", app.createCityHandler)
+			r.Patch("/cities/{id}", app.updateCityHandler)
+			r.Delete("/cities/{id}", app.deleteCityHandler)
+			r.Put("/cities/{id}/indices", app.upsertCityIndicesHandler)
+			r.Put("/cities/{id}/climate/{month}", app.upsertClimateMonthHandler)
+		})
+	}
+
+	router.Post("/budget", app.budgetHandler)
 	router.Post("/users", app.registerUserHandler)
 	router.Put("/users/activated", app.activateUserHandler)
 	router.Post("/tokens/authentication", app.createAuthenticationTokenHandler)
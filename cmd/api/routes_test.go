@@ -1,11 +1,13 @@
 package main
 
 import (
+	"cmp"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"strings"
@@ -298,12 +300,27 @@ func TestCities(t *testing.T) {
 	assert.Equal(t, statusCode, http.StatusOK)
 	assert.Equal(t, header.Get("content-type"), "application/json")
 
-	var got gotResponse
+	var got struct {
+		Cities   []data.City   `json:"cities"`
+		Metadata data.Metadata `json:"metadata"`
+	}
 	unmarshalJSON(t, body, &got)
-	assert.Equal(t, len(got.Cities) > 0, true)
+	assert.Equal(t, len(got.Cities), data.DefaultPageSize)
+	assert.Equal(t, got.Metadata.PageSize, data.DefaultPageSize)
+	assert.Equal(t, got.Metadata.NextCursor != "", true)
+
+	cities := got.Cities
+	for got.Metadata.NextCursor != "" {
+		statusCode, _, body = ts.get(t, "/cities?cursor="+got.Metadata.NextCursor)
+		assert.Equal(t, statusCode, http.StatusOK)
+		got.Cities = nil
+		unmarshalJSON(t, body, &got)
+		cities = append(cities, got.Cities...)
+	}
+	assert.Equal(t, len(cities), got.Metadata.TotalCount)
 
 	for _, geonameID := range []int64{5128581, 6167865, 524901} {
-		gotCity := findCityByID(t, got.Cities, geonameID)
+		gotCity := findCityByID(t, cities, geonameID)
 		wantCity := fetchExpectedCity(t, geonameID)
 		assert.DeepEqual(t, gotCity, wantCity)
 	}
@@ -356,10 +373,12 @@ func fetchExpectedCountry(t *testing.T, code string) data.Country {
 
 	var country data.Country
 	err := testDB.QueryRow(`
-		SELECT country_code, country, population, area, last_update::text
+		SELECT country_code, alpha2_code, LPAD(numeric_code::text, 3, '0'), country, population, area, last_update::text
 		FROM countries
 		WHERE country_code = UPPER($1);`, code).Scan(
 		&country.Code,
+		&country.Alpha2Code,
+		&country.NumericCode,
 		&country.Name,
 		&country.Population,
 		&country.Area,
@@ -380,6 +399,7 @@ func TestCitiesByCountry(t *testing.T) {
 	tests := []struct {
 		name        string
 		countryCode string
+		alpha3      string
 		statusCode  int
 	}{
 		{
@@ -403,8 +423,25 @@ func TestCitiesByCountry(t *testing.T) {
 			statusCode:  http.StatusNotFound,
 		},
 		{
-			name:        "Non-alphabetic code (123)",
-			countryCode: "123",
+			name:        "Alpha-2 code (us)",
+			countryCode: "us",
+			alpha3:      "USA",
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Numeric code (840)",
+			countryCode: "840",
+			alpha3:      "USA",
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Nonexistent numeric code (999)",
+			countryCode: "999",
+			statusCode:  http.StatusNotFound,
+		},
+		{
+			name:        "Mixed letters and digits (u5)",
+			countryCode: "u5",
 			statusCode:  http.StatusUnprocessableEntity,
 		},
 		{
@@ -451,22 +488,23 @@ func TestCitiesByCountry(t *testing.T) {
 
 			switch tt.statusCode {
 			case http.StatusOK:
+				alpha3 := cmp.Or(tt.alpha3, tt.countryCode)
 				var expectedCount int
 				err := testDB.QueryRow(`
 					SELECT COUNT(*)
 					FROM cities
-					WHERE LOWER(country_code) = LOWER($1);`, tt.countryCode).Scan(&expectedCount)
+					WHERE LOWER(country_code) = LOWER($1);`, alpha3).Scan(&expectedCount)
 				if err != nil {
 					t.Fatal(err)
 				}
 
 				assert.Equal(t, len(got.Cities), expectedCount)
 				for _, city := range got.Cities {
-					assert.Equal(t, strings.EqualFold(city.CountryCode, tt.countryCode), true)
+					assert.Equal(t, strings.EqualFold(city.CountryCode, alpha3), true)
 				}
 			case http.StatusUnprocessableEntity:
 				wantError := map[string]any{
-					"country_code": "must be exactly three English letters",
+					"country_code": "must be an ISO 3166-1 alpha-2, alpha-3 or numeric code",
 				}
 				assert.DeepEqual(t, got.Error, wantError)
 			case http.StatusNotFound:
@@ -476,6 +514,90 @@ func TestCitiesByCountry(t *testing.T) {
 	}
 }
 
+// TestCitiesPagination tests cursor pagination and sorting for "/cities".
+func TestCitiesPagination(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Cities   []data.City   `json:"cities"`
+		Metadata data.Metadata `json:"metadata"`
+	}
+
+	statusCode, header, body := ts.get(t, "/cities?country_code=USA&page_size=5&sort=-population")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Cities), 5)
+	assert.Equal(t, got.Cities[0].CountryCode, "USA")
+	assert.Equal(t, *got.Cities[0].Population >= *got.Cities[4].Population, true)
+	assert.Equal(t, got.Metadata.PageSize, 5)
+	assert.Equal(t, got.Metadata.NextCursor != "", true)
+
+	statusCode, _, body = ts.get(t, "/cities?sort=name&cursor="+got.Metadata.NextCursor)
+	assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+	assert.Equal(t, jsonHasKey(body, "error", "cursor"), true)
+
+	// {"s":"population","k":"1","i":"abc"}: the id is not a geoname_id.
+	statusCode, _, body = ts.get(t, "/cities?sort=population&cursor=eyJzIjoicG9wdWxhdGlvbiIsImsiOiIxIiwiaSI6ImFiYyJ9")
+	assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+	assert.Equal(t, jsonHasKey(body, "error", "cursor"), true)
+
+	statusCode, _, body = ts.get(t, "/cities?ids=5128581&sort=name")
+	assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+	var gotErr gotResponse
+	unmarshalJSON(t, body, &gotErr)
+	assert.DeepEqual(t, gotErr.Error, map[string]any{"query": "sort cannot be used together with ids"})
+}
+
+// TestCitiesAttributeFilters tests population, timezone, state and bbox filters for "/cities".
+func TestCitiesAttributeFilters(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	statusCode, header, body := ts.get(t, "/cities?min_population=500000&timezone=Europe/")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+
+	var got gotResponse
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Cities) > 0, true)
+	for _, city := range got.Cities {
+		assert.Equal(t, strings.HasPrefix(city.Timezone, "Europe/"), true)
+		assert.Equal(t, *city.Population >= 500000, true)
+	}
+
+	statusCode, _, body = ts.get(t, "/cities?state_code=ny&bbox=-75,40,-73,41")
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &got)
+	findCityByID(t, got.Cities, 5128581)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "population not integer", urlPath: "/cities?min_population=big", wantError: map[string]any{"min_population": "min_population must be an integer"}},
+		{name: "population range inverted", urlPath: "/cities?min_population=10&max_population=5", wantError: map[string]any{"max_population": "must not be less than min_population"}},
+		{name: "bbox arity", urlPath: "/cities?bbox=1,2,3", wantError: map[string]any{"bbox": "bbox must be minLon,minLat,maxLon,maxLat"}},
+		{name: "bbox latitude range", urlPath: "/cities?bbox=0,-95,10,10", wantError: map[string]any{"bbox": "latitudes must be between -90 and 90"}},
+		{name: "timezone wildcard", urlPath: "/cities?timezone=" + url.QueryEscape("Europe/%"), wantError: map[string]any{"timezone": "must be an IANA timezone name or prefix, such as Europe/"}},
+		{name: "combined with ids", urlPath: "/cities?ids=5128581&timezone=America/", wantError: map[string]any{"query": "timezone cannot be used together with ids"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
 // TestCitiesBatchByIDs tests batch retrieval for "/cities?ids=...".
 func TestCitiesBatchByIDs(t *testing.T) {
 	ts := newTestServer(testApp.routes())
@@ -760,6 +882,14 @@ func TestCityIncludeFieldPresence(t *testing.T) {
 		statusCode, _, body := ts.sendRequest(t, "GET", "/cities/3069011", mocks.Headers, nil)
 		assert.Equal(t, statusCode, http.StatusOK)
 		assert.Equal(t, jsonHasKey(body, "city", "avg_climate"), false)
+		assert.Equal(t, jsonHasKey(body, "city", "time"), false)
+	})
+
+	t.Run("time requested => local time block", func(t *testing.T) {
+		statusCode, _, body := ts.sendRequest(t, "GET", "/cities/3069011?include=time", mocks.Headers, nil)
+		assert.Equal(t, statusCode, http.StatusOK)
+		assert.Equal(t, jsonHasKey(body, "city", "time"), true)
+		assert.Equal(t, jsonIsNull(body, "city", "time"), false)
 	})
 
 	t.Run("numbeo_cost requested and absent => explicit null", func(t *testing.T) {
@@ -785,7 +915,7 @@ func TestCityIncludeFieldPresence(t *testing.T) {
 	})
 }
 
-// TestCountryIncludeFieldPresence tests include-driven field presence/omission for "/countries/:alpha3".
+// TestCountryIncludeFieldPresence tests include-driven field presence/omission for "/countries/:code".
 func TestCountryIncludeFieldPresence(t *testing.T) {
 	ts := newTestServerWithMockUser(testApp.routes())
 	defer ts.Close()
@@ -818,7 +948,7 @@ func TestCountryIncludeFieldPresence(t *testing.T) {
 			SELECT ctr.country_code
 			FROM countries ctr
 			LEFT JOIN numbeo_country_indices ni ON ni.country_code = ctr.country_code
-			JOIN legatum_country_indices li ON li.country_code = ctr.country_code
+			JOIN legatum_country_scores li ON li.country_code = ctr.country_code
 			WHERE ni.country_code IS NULL
 			LIMIT 1;`
 
@@ -851,12 +981,61 @@ func TestCountryIncludeFieldPresence(t *testing.T) {
 		assert.Equal(t, statusCode, http.StatusOK)
 		assert.Equal(t, jsonHasKey(body, "country", "numbeo_indices"), false)
 		assert.Equal(t, jsonHasKey(body, "country", "legatum_indices"), false)
+		assert.Equal(t, jsonHasKey(body, "country", "city_aggregates"), false)
+	})
+
+	t.Run("city_aggregates requested => aggregates block", func(t *testing.T) {
+		statusCode, _, body := ts.sendRequest(t, "GET", "/countries/usa?include=city_aggregates", mocks.Headers, nil)
+		assert.Equal(t, statusCode, http.StatusOK)
+		assert.Equal(t, jsonHasKey(body, "country", "city_aggregates"), true)
+		assert.Equal(t, jsonIsNull(body, "country", "city_aggregates"), false)
+	})
+
+	t.Run("cities requested => limited cities list", func(t *testing.T) {
+		statusCode, _, body := ts.sendRequest(t, "GET", "/countries/usa?include=cities&cities_limit=2", mocks.Headers, nil)
+		assert.Equal(t, statusCode, http.StatusOK)
+
+		var got struct {
+			Country struct {
+				Cities []struct {
+					CountryCode string `json:"country_code"`
+					Population  *int64 `json:"population"`
+				} `json:"cities"`
+			} `json:"country"`
+		}
+		err := json.Unmarshal(body, &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(got.Country.Cities) <= 2, true)
+		for _, city := range got.Country.Cities {
+			assert.Equal(t, city.CountryCode, "USA")
+		}
+	})
+
+	t.Run("cities_summary requested => summary block", func(t *testing.T) {
+		statusCode, _, body := ts.sendRequest(t, "GET", "/countries/usa?include=cities_summary", mocks.Headers, nil)
+		assert.Equal(t, statusCode, http.StatusOK)
+		assert.Equal(t, jsonHasKey(body, "country", "cities_summary"), true)
+		assert.Equal(t, jsonIsNull(body, "country", "cities_summary"), false)
+		assert.Equal(t, jsonHasKey(body, "country", "cities"), false)
+	})
+
+	t.Run("cities_limit without include=cities => 422", func(t *testing.T) {
+		statusCode, _, body := ts.sendRequest(t, "GET", "/countries/usa?cities_limit=5", mocks.Headers, nil)
+		assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+		assert.Equal(t, strings.Contains(string(body), "cities_limit requires include=cities"), true)
+	})
+
+	t.Run("cities_limit out of range => 422", func(t *testing.T) {
+		statusCode, _, _ := ts.sendRequest(t, "GET", "/countries/usa?include=cities&cities_limit=101", mocks.Headers, nil)
+		assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
 	})
 
 	t.Run("legatum_indices requested and absent => explicit null", func(t *testing.T) {
-		countryCode, ok := findCountryCodeWithoutData(t, "legatum_country_indices", "country_code")
+		countryCode, ok := findCountryCodeWithoutData(t, "legatum_country_scores", "country_code")
 		if !ok {
-			t.Skip("no country without legatum_country_indices in test dataset")
+			t.Skip("no country without legatum_country_scores in test dataset")
 		}
 		statusCode, _, body := ts.sendRequest(t, "GET", fmt.Sprintf("/countries/%s?include=legatum_indices", countryCode), mocks.Headers, nil)
 		assert.Equal(t, statusCode, http.StatusOK)
@@ -1023,13 +1202,27 @@ func TestCountries(t *testing.T) {
 	assert.Equal(t, statusCode, http.StatusOK)
 	assert.Equal(t, header.Get("content-type"), "application/json")
 
-	var got gotResponse
+	var got struct {
+		Countries []data.Country `json:"countries"`
+		Metadata  data.Metadata  `json:"metadata"`
+	}
 	unmarshalJSON(t, body, &got)
-	assert.Equal(t, len(got.Countries), 249)
+	assert.Equal(t, len(got.Countries), data.DefaultPageSize)
+	assert.Equal(t, got.Metadata.TotalCount, 249)
+
+	countries := got.Countries
+	for got.Metadata.NextCursor != "" {
+		statusCode, _, body = ts.get(t, "/countries?cursor="+got.Metadata.NextCursor)
+		assert.Equal(t, statusCode, http.StatusOK)
+		got.Countries = nil
+		unmarshalJSON(t, body, &got)
+		countries = append(countries, got.Countries...)
+	}
+	assert.Equal(t, len(countries), 249)
 
 	for _, code := range []string{"AUS", "ITA", "THA"} {
 		t.Run(fmt.Sprintf("Check country code=%s", code), func(t *testing.T) {
-			assert.DeepEqual(t, findCountryByCode(t, got.Countries, code), fetchExpectedCountry(t, code))
+			assert.DeepEqual(t, findCountryByCode(t, countries, code), fetchExpectedCountry(t, code))
 		})
 	}
 }
@@ -1047,6 +1240,56 @@ func findCountryByCode(t *testing.T, countries []data.Country, code string) data
 	return data.Country{}
 }
 
+// TestCountriesPagination tests cursor pagination and sorting for "/countries".
+func TestCountriesPagination(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Countries []data.Country `json:"countries"`
+		Metadata  data.Metadata  `json:"metadata"`
+	}
+
+	statusCode, header, body := ts.get(t, "/countries?page_size=2&sort=-population")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Countries), 2)
+	assert.Equal(t, *got.Countries[0].Population >= *got.Countries[1].Population, true)
+	assert.Equal(t, got.Metadata.PageSize, 2)
+	assert.Equal(t, got.Metadata.TotalCount, 249)
+	assert.Equal(t, got.Metadata.PrevCursor, "")
+
+	statusCode, _, body = ts.get(t, "/countries?sort=-population&cursor="+got.Metadata.NextCursor)
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.Metadata.PageSize, data.DefaultPageSize)
+	assert.Equal(t, got.Metadata.PrevCursor != "", true)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "page size out of range", urlPath: "/countries?page_size=501", wantError: map[string]any{"page_size": "page_size must be between 1 and 500"}},
+		{name: "unsupported sort", urlPath: "/countries?sort=area", wantError: map[string]any{"sort": "invalid sort value"}},
+		{name: "malformed cursor", urlPath: "/countries?cursor=abc", wantError: map[string]any{"cursor": "must be a cursor returned for the same sort"}},
+		{name: "tampered cursor key", urlPath: "/countries?sort=population&cursor=eyJzIjoicG9wdWxhdGlvbiIsImsiOiJhYmMiLCJpIjoiVVNBIn0", wantError: map[string]any{"cursor": "must be a cursor returned for the same sort"}},
+		{name: "combined with country_codes", urlPath: "/countries?country_codes=USA&page_size=5", wantError: map[string]any{"query": "page_size cannot be used together with country_codes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
 // TestCountriesBatchByCodes tests batch retrieval for "/countries?country_codes=...".
 func TestCountriesBatchByCodes(t *testing.T) {
 	ts := newTestServer(testApp.routes())
@@ -1079,6 +1322,11 @@ func TestCountriesBatchByCodesWithInclude(t *testing.T) {
 	assert.Equal(t, header.Get("content-type"), "application/json")
 	assert.Equal(t, jsonArrayObjectHasKeyByStringID(body, "countries", "country_code", "USA", "legatum_indices"), true)
 	assert.Equal(t, jsonArrayObjectHasKeyByStringID(body, "countries", "country_code", "CAN", "legatum_indices"), true)
+
+	statusCode, _, body = ts.get(t, "/countries?country_codes=USA,CAN&include=cities,cities_summary&cities_limit=3")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, jsonArrayObjectHasKeyByStringID(body, "countries", "country_code", "USA", "cities"), true)
+	assert.Equal(t, jsonArrayObjectHasKeyByStringID(body, "countries", "country_code", "CAN", "cities_summary"), true)
 }
 
 // TestCountriesBatchByCodesLimit tests batch country_codes limit.
@@ -1103,7 +1351,7 @@ func TestCountriesBatchByCodesLimit(t *testing.T) {
 	})
 }
 
-// TestCountry tests the “/countries/:alpha3" endpoint.
+// TestCountry tests the “/countries/:code" endpoint.
 func TestCountry(t *testing.T) {
 	ts := newTestServerWithMockUser(testApp.routes())
 	defer ts.Close()
@@ -1132,14 +1380,37 @@ func TestCountry(t *testing.T) {
 			statusCode: http.StatusOK,
 			code:       "THA",
 		},
+		{
+			name:       "Alpha-2 code (jp)",
+			urlPath:    "/countries/jp",
+			statusCode: http.StatusOK,
+			code:       "JPN",
+		},
+		{
+			name:       "Numeric code (036)",
+			urlPath:    "/countries/036",
+			statusCode: http.StatusOK,
+			code:       "AUS",
+		},
+		{
+			name:       "Numeric code without leading zeros (36)",
+			urlPath:    "/countries/36",
+			statusCode: http.StatusOK,
+			code:       "AUS",
+		},
 		{
 			name:       "Nonexistent country code (XXX)",
 			urlPath:    "/countries/XXX",
 			statusCode: http.StatusNotFound,
 		},
 		{
-			name:       "Non-alphabetic code (123)",
-			urlPath:    "/countries/123",
+			name:       "Nonexistent numeric code (999)",
+			urlPath:    "/countries/999",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Mixed letters and digits (u5)",
+			urlPath:    "/countries/u5",
 			statusCode: http.StatusUnprocessableEntity,
 		},
 		{
@@ -1189,7 +1460,7 @@ func TestCountry(t *testing.T) {
 			switch tt.statusCode {
 			case http.StatusUnprocessableEntity:
 				wantError := map[string]any{
-					"country_code": "must be exactly three English letters",
+					"country_code": "must be an ISO 3166-1 alpha-2, alpha-3 or numeric code",
 				}
 				assert.DeepEqual(t, got.Error, wantError)
 			case http.StatusNotFound:
@@ -1199,7 +1470,7 @@ func TestCountry(t *testing.T) {
 	}
 }
 
-// TestCountryandQuery tests the “/countries/:alpha3” endpoint with query parameters.
+// TestCountryandQuery tests the “/countries/:code” endpoint with query parameters.
 func TestCountryandQuery(t *testing.T) {
 	ts := newTestServerWithMockUser(testApp.routes())
 	defer ts.Close()
@@ -1211,7 +1482,7 @@ func TestCountryandQuery(t *testing.T) {
 			SELECT ctr.country_code
 			FROM countries ctr
 			LEFT JOIN numbeo_country_indices ni ON ni.country_code = ctr.country_code
-			JOIN legatum_country_indices li ON li.country_code = ctr.country_code
+			JOIN legatum_country_scores li ON li.country_code = ctr.country_code
 			WHERE ni.country_code IS NULL
 			LIMIT 1;`
 
@@ -1350,57 +1621,1095 @@ func TestCountryandQuery(t *testing.T) {
 	}
 }
 
-// TestUnknownQueryParams tests that all endpoints reject unknown query parameters.
-func TestUnknownQueryParams(t *testing.T) {
+// TestStates tests the "/states" endpoint.
+func TestStates(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		States []data.State `json:"states"`
+	}
+
+	statusCode, header, body := ts.get(t, "/states?country_code=usa")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.States) > 0, true)
+	for _, state := range got.States {
+		assert.Equal(t, *state.CountryCode, "USA")
+	}
+
+	statusCode, _, _ = ts.get(t, "/states?country_code=XXX")
+	assert.Equal(t, statusCode, http.StatusNotFound)
+
+	statusCode, _, body = ts.get(t, "/states?country_code=US")
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &got)
+	for _, state := range got.States {
+		assert.Equal(t, *state.CountryCode, "USA")
+	}
+
+	statusCode, _, body = ts.get(t, "/states?country_code=U5")
+	assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+	var gotErr gotResponse
+	unmarshalJSON(t, body, &gotErr)
+	assert.DeepEqual(t, gotErr.Error, map[string]any{"country_code": "must be an ISO 3166-1 alpha-2, alpha-3 or numeric code"})
+}
+
+// TestState tests the "/states/:code" endpoint.
+func TestState(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		State data.State `json:"state"`
+	}
+
+	statusCode, header, body := ts.get(t, "/states/ny")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.State.Code, "NY")
+	findCityByID(t, dereferenceCities(got.State.Cities), 5128581)
+
+	statusCode, _, _ = ts.get(t, "/states/ZZZ")
+	assert.Equal(t, statusCode, http.StatusNotFound)
+
+	statusCode, _, _ = ts.get(t, "/states/"+url.PathEscape("N Y"))
+	assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+}
+
+func dereferenceCities(cities []*data.City) []data.City {
+	out := make([]data.City, 0, len(cities))
+	for _, city := range cities {
+		out = append(out, *city)
+	}
+	return out
+}
+
+// TestCityStateInclude tests include=state on city endpoints.
+func TestCityStateInclude(t *testing.T) {
+	ts := newTestServerWithMockUser(testApp.routes())
+	defer ts.Close()
+
+	for _, urlPath := range []string{"/cities/5128581?include=state", "/cities?ids=5128581&include=state"} {
+		statusCode, _, body := ts.get(t, urlPath)
+		assert.Equal(t, statusCode, http.StatusOK)
+		assert.StringContains(t, string(body), `"state_name"`)
+	}
+
+	statusCode, _, body := ts.get(t, "/cities/5128581")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, jsonHasKey(body, "city", "state"), false)
+
+	statusCode, _, body = ts.get(t, "/cities?country_code=USA&include=state&sort=-population")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, jsonArrayObjectHasKeyByID(body, "cities", "geoname_id", 5128581, "state"), true)
+}
+
+// TestSparseFieldsets tests the fields query parameter on city and country endpoints.
+func TestSparseFieldsets(t *testing.T) {
+	ts := newTestServerWithMockUser(testApp.routes())
+	defer ts.Close()
+
+	statusCode, header, body := ts.get(t, "/cities/1850147?include=numbeo_cost,avg_climate&fields=geoname_id,avg_climate.high_temp")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+
+	var city struct {
+		City map[string]map[string]any `json:"city"`
+	}
+	var raw struct {
+		City map[string]json.RawMessage `json:"city"`
+	}
+	unmarshalJSON(t, body, &raw)
+	assert.Equal(t, len(raw.City), 2)
+	assert.Equal(t, jsonHasKey(body, "city", "numbeo_cost"), false)
+
+	statusCode, _, body = ts.get(t, "/cities/1850147?include=avg_climate&fields=avg_climate.high_temp,avg_climate.low_temp")
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &city)
+	assert.Equal(t, len(city.City["avg_climate"]), 2)
+
+	statusCode, _, body = ts.get(t, "/countries?country_codes=USA,CAN&include=numbeo_indices&fields=country_code,numbeo_indices.safety")
+	assert.Equal(t, statusCode, http.StatusOK)
+
+	var countries struct {
+		Countries []map[string]json.RawMessage `json:"countries"`
+	}
+	unmarshalJSON(t, body, &countries)
+	assert.Equal(t, len(countries.Countries), 2)
+	for _, country := range countries.Countries {
+		assert.Equal(t, len(country), 2)
+		assert.StringContains(t, string(country["numbeo_indices"]), `"safety"`)
+	}
+
+	statusCode, _, body = ts.get(t, "/cities?country_code=JPN&fields=geoname_id,city")
+	assert.Equal(t, statusCode, http.StatusOK)
+
+	var cities struct {
+		Cities []map[string]json.RawMessage `json:"cities"`
+	}
+	unmarshalJSON(t, body, &cities)
+	assert.Equal(t, len(cities.Cities) > 0, true)
+	assert.Equal(t, len(cities.Cities[0]), 2)
+
+	statusCode, _, body = ts.get(t, "/countries/USA?fields=legatum_indices")
+	assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+	var got gotResponse
+	unmarshalJSON(t, body, &got)
+	assert.DeepEqual(t, got.Error, map[string]any{"fields": `fields contains "legatum_indices", which requires include=legatum_indices`})
+}
+
+// TestCityCurrencyConversion tests the currency query parameter on city endpoints.
+func TestCityCurrencyConversion(t *testing.T) {
 	ts := newTestServerWithMockUser(testApp.routes())
 	defer ts.Close()
 
+	var usd, eur gotResponse
+	statusCode, _, body := ts.get(t, "/cities/1850147?include=numbeo_cost")
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &usd)
+
+	statusCode, header, body := ts.get(t, "/cities/1850147?include=numbeo_cost&currency=eur")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &eur)
+
+	assert.Equal(t, eur.City.NumbeoCost.Currency, "EUR")
+	assert.Equal(t, eur.City.NumbeoCost.ExchangeRate != nil, true)
+	assert.Equal(t, eur.City.NumbeoCost.ExchangeRate.Base, "USD")
+	assert.Equal(t, eur.City.NumbeoCost.ExchangeRate.Timestamp > 0, true)
+	assert.Equal(t, len(eur.City.NumbeoCost.Prices), len(usd.City.NumbeoCost.Prices))
+
+	rate := eur.City.NumbeoCost.ExchangeRate.Rate
+	for i, price := range usd.City.NumbeoCost.Prices {
+		if price.Cost == nil {
+			continue
+		}
+		assert.Equal(t, *eur.City.NumbeoCost.Prices[i].Cost, math.Round(*price.Cost*rate*100)/100)
+	}
+
+	statusCode, _, body = ts.get(t, "/cities?ids=1850147,5128581&include=numbeo_cost&currency=JPY")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.StringContains(t, string(body), `"currency":"JPY"`)
+
 	tests := []struct {
-		name       string
-		method     string
-		urlPath    string
-		headers    http.Header
-		statusCode int
+		name      string
+		urlPath   string
+		wantError map[string]any
 	}{
-		{name: "healthcheck", method: http.MethodGet, urlPath: "/healthcheck?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
-		{name: "cities list", method: http.MethodGet, urlPath: "/cities?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
-		{name: "cities detail", method: http.MethodGet, urlPath: "/cities/5809844?foo=bar", headers: mocks.Headers, statusCode: http.StatusUnprocessableEntity},
-		{name: "countries list", method: http.MethodGet, urlPath: "/countries?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
-		{name: "countries detail", method: http.MethodGet, urlPath: "/countries/AUS?foo=bar", headers: mocks.Headers, statusCode: http.StatusUnprocessableEntity},
-		{name: "register user", method: http.MethodPost, urlPath: "/users?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
-		{name: "activate user", method: http.MethodPut, urlPath: "/users/activated?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
-		{name: "authentication token", method: http.MethodPost, urlPath: "/tokens/authentication?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "unsupported currency", urlPath: "/cities/1850147?include=numbeo_cost&currency=XYZ", wantError: map[string]any{"currency": "currency must be one of AUD, BRL, CAD, CNY, EUR, GBP, INR, JPY, RUB, USD"}},
+		{name: "without numbeo_cost", urlPath: "/cities/1850147?currency=EUR", wantError: map[string]any{"currency": "currency requires include=numbeo_cost"}},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			statusCode, header, body := ts.sendRequest(t, tt.method, tt.urlPath, tt.headers, nil)
-			assert.Equal(t, statusCode, tt.statusCode)
-			assert.Equal(t, header.Get("content-type"), "application/json")
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
 
 			var got gotResponse
 			unmarshalJSON(t, body, &got)
-			wantError := map[string]any{
-				"query": "unknown query parameter \"foo\"",
-			}
-			assert.DeepEqual(t, got.Error, wantError)
+			assert.DeepEqual(t, got.Error, tt.wantError)
 		})
 	}
 }
 
-// TestErrorHandling tests handle 404 Not Found and 405 Method Not Allowed errors.
-func TestErrorHandling(t *testing.T) {
-	ts := newTestServer(testApp.routes())
+func TestCityCostParams(t *testing.T) {
+	ts := newTestServerWithMockUser(testApp.routes())
 	defer ts.Close()
 
+	milk := url.QueryEscape("milk (regular), (1 liter)")
+	pass := url.QueryEscape("Monthly Pass (Regular Price)")
+
+	var got gotResponse
+	statusCode, header, body := ts.get(t, "/cities/1850147?include=numbeo_cost&cost_param="+milk+"&cost_param="+pass)
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.City.NumbeoCost.Prices), 2)
+
+	statusCode, _, body = ts.get(t, "/cities?ids=1850147,5128581&include=numbeo_cost&fields=geoname_id,numbeo_cost.prices&cost_param="+milk)
+	assert.Equal(t, statusCode, http.StatusOK)
+	got = gotResponse{}
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Cities), 2)
+	for _, city := range got.Cities {
+		assert.Equal(t, len(city.NumbeoCost.Prices), 1)
+		assert.Equal(t, city.NumbeoCost.Prices[0].Param, "Milk (regular), (1 liter)")
+	}
+
 	tests := []struct {
-		name       string
-		method     string
-		urlPath    string
-		statusCode int
-		errMessage string
+		name      string
+		urlPath   string
+		wantError map[string]any
 	}{
-		{
+		{name: "without numbeo_cost", urlPath: "/cities/1850147?cost_param=" + milk, wantError: map[string]any{"cost_param": "cost_param requires include=numbeo_cost"}},
+		{name: "empty", urlPath: "/cities/1850147?include=numbeo_cost&cost_param=", wantError: map[string]any{"cost_param": "cost_param must not be empty"}},
+		{name: "unknown", urlPath: "/cities/1850147?include=numbeo_cost&cost_param=" + milk + "&cost_param=Caviar", wantError: map[string]any{"cost_param": "unknown cost params: Caviar"}},
+		{name: "unknown in batch", urlPath: "/cities?ids=1850147&include=numbeo_cost&cost_param=Caviar", wantError: map[string]any{"cost_param": "unknown cost params: Caviar"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestCityClimate tests the "/cities/:id/climate" endpoint.
+func TestCityClimate(t *testing.T) {
+	ts := newTestServerWithMockUser(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Climate data.CityClimate `json:"climate"`
+	}
+
+	statusCode, header, body := ts.get(t, "/cities/1850147/climate?months=6,7,8&metrics=high_temp,rainfall")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.Climate.GeonameID, int64(1850147))
+	assert.DeepEqual(t, got.Climate.Months, []int{6, 7, 8})
+	assert.Equal(t, len(got.Climate.Metrics), 2)
+	assert.Equal(t, len(got.Climate.Metrics["high_temp"].Values), 3)
+	assert.Equal(t, got.Climate.Metrics["high_temp"].Annual.Max != nil, true)
+
+	statusCode, _, body = ts.get(t, "/cities/1850147/climate")
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Climate.Months), 12)
+	assert.Equal(t, len(got.Climate.Metrics), len(data.ClimateMetrics))
+
+	statusCode, _, _ = ts.get(t, "/cities/777/climate")
+	assert.Equal(t, statusCode, http.StatusNotFound)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "month out of range", urlPath: "/cities/1850147/climate?months=0", wantError: map[string]any{"months": "months must contain only positive integers"}},
+		{name: "month above december", urlPath: "/cities/1850147/climate?months=13", wantError: map[string]any{"months": "months must contain only values between 1 and 12"}},
+		{name: "unsupported metric", urlPath: "/cities/1850147/climate?metrics=tides", wantError: map[string]any{"metrics": `metrics contains unsupported value "tides"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestCitiesClimate tests the "/cities/climate" batch endpoint.
+func TestCitiesClimate(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Climates []data.CityClimate `json:"climates"`
+	}
+
+	statusCode, header, body := ts.get(t, "/cities/climate?ids=1850147,5128581&months=1&metrics=low_temp")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Climates), 2)
+	for _, climate := range got.Climates {
+		assert.Equal(t, len(climate.Metrics), 1)
+		assert.Equal(t, len(climate.Metrics["low_temp"].Values), 1)
+	}
+
+	statusCode, _, body = ts.get(t, "/cities/climate")
+	assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+	var gotErr gotResponse
+	unmarshalJSON(t, body, &gotErr)
+	assert.DeepEqual(t, gotErr.Error, map[string]any{"ids": "ids must be provided"})
+}
+
+// TestClimateSearch tests the "/cities/climate-search" endpoint.
+func TestClimateSearch(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Cities []data.ClimateMatch `json:"cities"`
+	}
+
+	urlPath := "/cities/climate-search?where=high_temp:7:22..27&where=rainfall_days:7:..8&limit=10"
+	statusCode, header, body := ts.get(t, urlPath)
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Cities) <= 10, true)
+	for _, city := range got.Cities {
+		assert.Equal(t, len(city.Matches), 2)
+		assert.Equal(t, city.Matches[0].Metric, "high_temp")
+		assert.Equal(t, *city.Matches[0].Values[0] >= 22 && *city.Matches[0].Values[0] <= 27, true)
+		assert.Equal(t, *city.Matches[1].Values[0] <= 8, true)
+	}
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "missing where", urlPath: "/cities/climate-search", wantError: map[string]any{"where": "must be provided"}},
+		{name: "unsupported metric", urlPath: "/cities/climate-search?where=tides:7:..1", wantError: map[string]any{"where": `unsupported metric "tides"`}},
+		{name: "malformed where", urlPath: "/cities/climate-search?where=high_temp", wantError: map[string]any{"where": `where value "high_temp" must have the form metric:months:min..max`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestSalaryEquivalence tests the "/salary-equivalence" endpoint.
+func TestSalaryEquivalence(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		SalaryEquivalence data.SalaryEquivalence `json:"salary_equivalence"`
+	}
+
+	statusCode, header, body := ts.get(t, "/salary-equivalence?from=1850147&to=5809844&amount=5000&currency=jpy")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	equivalence := got.SalaryEquivalence
+	assert.Equal(t, equivalence.Currency, "JPY")
+	assert.Equal(t, equivalence.From.GeonameID, int64(1850147))
+	assert.Equal(t, equivalence.To.GeonameID, int64(5809844))
+	assert.Equal(t, equivalence.From.CostOfLivingPlusRent.Source != "", true)
+	assert.Equal(t, math.Abs(equivalence.EquivalentAmount-5000*equivalence.CostOfLivingRatio) < 1, true)
+
+	statusCode, _, _ = ts.get(t, "/salary-equivalence?from=1850147&to=999999999&amount=5000")
+	assert.Equal(t, statusCode, http.StatusNotFound)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "missing params", urlPath: "/salary-equivalence", wantError: map[string]any{"from": "from must be provided", "to": "to must be provided", "amount": "amount must be provided"}},
+		{name: "invalid amount", urlPath: "/salary-equivalence?from=1850147&to=5809844&amount=-5", wantError: map[string]any{"amount": "amount must be between 1 and 1000000000"}},
+		{name: "invalid city id", urlPath: "/salary-equivalence?from=0&to=5809844&amount=5", wantError: map[string]any{"from": "from must be a positive integer"}},
+		{name: "unsupported currency", urlPath: "/salary-equivalence?from=1850147&to=5809844&amount=5&currency=XYZ", wantError: map[string]any{"currency": "currency must be one of AUD, BRL, CAD, CNY, EUR, GBP, INR, JPY, RUB, USD"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestBudget tests the "POST /budget" endpoint.
+func TestBudget(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Budgets []data.CityBudget `json:"budgets"`
+	}
+
+	input := map[string]any{"city_ids": []int64{1850147, 5809844}, "preset": "couple", "currency": "eur"}
+	statusCode, header, body := ts.sendRequest(t, http.MethodPost, "/budget", nil, input)
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Budgets), 2)
+	for _, budget := range got.Budgets {
+		assert.Equal(t, budget.Currency, "EUR")
+		assert.Equal(t, len(budget.Items), len(data.BudgetPresets["couple"]))
+		assert.DeepEqual(t, budget.Missing, []string{})
+		assert.Equal(t, budget.Low <= budget.Total && budget.Total <= budget.High, true)
+	}
+
+	// Put the milk param in a second category to make it ambiguous.
+	deleteCategory := func() {
+		for _, query := range []string{
+			`DELETE FROM numbeo_cost_params WHERE category_id IN (SELECT category_id FROM numbeo_cost_categories WHERE category = 'Test Category')`,
+			`DELETE FROM numbeo_cost_categories WHERE category = 'Test Category'`,
+		} {
+			if _, err := testDB.Exec(query); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	deleteCategory()
+	t.Cleanup(deleteCategory)
+	_, err := testDB.Exec(`
+		WITH category AS (
+			INSERT INTO numbeo_cost_categories (category) VALUES ('Test Category') RETURNING category_id
+		)
+		INSERT INTO numbeo_cost_params (category_id, param)
+		SELECT category_id, 'Milk (regular), (1 liter)' FROM category`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		input     any
+		wantError map[string]any
+	}{
+		{
+			name:      "missing city ids",
+			input:     map[string]any{"preset": "student"},
+			wantError: map[string]any{"city_ids": "must be provided"},
+		},
+		{
+			name:      "unknown preset",
+			input:     map[string]any{"city_ids": []int64{1850147}, "preset": "retiree"},
+			wantError: map[string]any{"preset": "must be one of couple, family_of_four, student"},
+		},
+		{
+			name:      "unknown param",
+			input:     map[string]any{"city_ids": []int64{1850147}, "items": []map[string]any{{"param": "Unicorn rides", "quantity": 1}}},
+			wantError: map[string]any{"items": "unknown cost params: Unicorn rides"},
+		},
+		{
+			name:      "param in several categories",
+			input:     map[string]any{"city_ids": []int64{1850147}, "items": []map[string]any{{"param": "Milk (regular), (1 liter)", "quantity": 1}}},
+			wantError: map[string]any{"items": "cost params in several categories need a category: Milk (regular), (1 liter) (Markets, Test Category)"},
+		},
+		{
+			name:      "unsupported currency",
+			input:     map[string]any{"city_ids": []int64{1850147}, "preset": "student", "currency": "XYZ"},
+			wantError: map[string]any{"currency": "must be one of AUD, BRL, CAD, CNY, EUR, GBP, INR, JPY, RUB, USD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.sendRequest(t, http.MethodPost, "/budget", nil, tt.input)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestCompareCities tests the "/compare/cities" endpoint.
+func TestCompareCities(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Comparison data.CityComparison `json:"comparison"`
+	}
+
+	statusCode, header, body := ts.get(t, "/compare/cities?base=1850147&ids=5809844,1850147")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.Comparison.Base.GeonameID, int64(1850147))
+	assert.Equal(t, got.Comparison.Currency, "USD")
+	assert.Equal(t, len(got.Comparison.Cities), 2)
+	assert.Equal(t, got.Comparison.Cities[0].GeonameID, int64(5809844))
+	assert.Equal(t, len(got.Comparison.Cities[0].Indices), len(data.CityRankingIndices))
+	for _, cost := range got.Comparison.Cities[1].Costs {
+		if cost.Difference != nil {
+			assert.Equal(t, *cost.Difference, 0.0)
+		}
+	}
+
+	statusCode, _, _ = ts.get(t, "/compare/cities?base=999999999&ids=5809844")
+	assert.Equal(t, statusCode, http.StatusNotFound)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "missing base", urlPath: "/compare/cities?ids=5809844", wantError: map[string]any{"base": "base must be provided"}},
+		{name: "invalid base", urlPath: "/compare/cities?base=abc&ids=5809844", wantError: map[string]any{"base": "base must be an integer"}},
+		{name: "missing ids", urlPath: "/compare/cities?base=1850147", wantError: map[string]any{"ids": "ids must be provided"}},
+		{name: "unsupported currency", urlPath: "/compare/cities?base=1850147&ids=5809844&currency=XYZ", wantError: map[string]any{"currency": "currency must be one of AUD, BRL, CAD, CNY, EUR, GBP, INR, JPY, RUB, USD"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestSimilarCities tests the "/cities/{id}/similar" endpoint.
+func TestSimilarCities(t *testing.T) {
+	ts := newTestServerWithMockUser(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Cities []data.SimilarCity `json:"cities"`
+	}
+
+	statusCode, header, body := ts.get(t, "/cities/1850147/similar?limit=5&exclude_country=jpn&max_cost_ratio=1.2")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Cities) <= 5, true)
+	for i, city := range got.Cities {
+		assert.Equal(t, city.GeonameID != 1850147, true)
+		assert.Equal(t, city.CountryCode != "JPN", true)
+		assert.Equal(t, *city.CostRatio <= 1.2, true)
+		assert.Equal(t, city.SharedFeatures*2 >= len(data.CityFeatures), true)
+		if i > 0 {
+			assert.Equal(t, got.Cities[i-1].Distance <= city.Distance, true)
+		}
+	}
+
+	statusCode, _, _ = ts.get(t, "/cities/777/similar")
+	assert.Equal(t, statusCode, http.StatusNotFound)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "invalid limit", urlPath: "/cities/1850147/similar?limit=0", wantError: map[string]any{"limit": "limit must be between 1 and 50"}},
+		{name: "invalid country", urlPath: "/cities/1850147/similar?exclude_country=JP", wantError: map[string]any{"exclude_country": "must contain only ISO 3166-1 alpha-2, alpha-3 or numeric codes"}},
+		{name: "invalid cost ratio", urlPath: "/cities/1850147/similar?max_cost_ratio=cheap", wantError: map[string]any{"max_cost_ratio": "max_cost_ratio must be a number"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestCountryLegatum tests the "/countries/:code/legatum" endpoint.
+func TestCountryLegatum(t *testing.T) {
+	ts := newTestServerWithMockUser(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Legatum data.LegatumSeries `json:"legatum"`
+	}
+
+	statusCode, header, body := ts.sendRequest(t, "GET", "/countries/usa/legatum?pillars=health,governance&from=2010&to=2015", mocks.Headers, nil)
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.Legatum.CountryCode, "USA")
+	assert.Equal(t, len(got.Legatum.Pillars), 2)
+	assert.Equal(t, got.Legatum.Pillars[0].Pillar, "governance")
+	assert.Equal(t, got.Legatum.Pillars[1].Pillar, "health")
+	for _, pillar := range got.Legatum.Pillars {
+		assert.Equal(t, len(pillar.Series), 6)
+		for i, point := range pillar.Series {
+			assert.Equal(t, point.Year, 2010+i)
+		}
+	}
+
+	statusCode, _, body = ts.sendRequest(t, "GET", "/countries/usa/legatum", mocks.Headers, nil)
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Legatum.Pillars), len(data.LegatumPillars))
+
+	statusCode, _, _ = ts.sendRequest(t, "GET", "/countries/xyz/legatum", mocks.Headers, nil)
+	assert.Equal(t, statusCode, http.StatusNotFound)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "unknown pillar", urlPath: "/countries/usa/legatum?pillars=wealth", wantError: map[string]any{"pillars": `pillars contains unsupported value "wealth"`}},
+		{name: "year out of range", urlPath: "/countries/usa/legatum?from=1999", wantError: map[string]any{"from": "from must be between 2007 and 2100"}},
+		{name: "reversed range", urlPath: "/countries/usa/legatum?from=2020&to=2010", wantError: map[string]any{"to": "to must not be before from"}},
+		{name: "invalid country code", urlPath: "/countries/u5/legatum", wantError: map[string]any{"country_code": "must be an ISO 3166-1 alpha-2, alpha-3 or numeric code"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.sendRequest(t, "GET", tt.urlPath, mocks.Headers, nil)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestLegatumTrends tests the "/legatum/trends" endpoint.
+func TestLegatumTrends(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Trends data.LegatumTrends `json:"trends"`
+	}
+
+	statusCode, header, body := ts.get(t, "/legatum/trends?pillar=governance&from=2015&to=2023&limit=5")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.Trends.Pillar, "governance")
+	assert.Equal(t, got.Trends.From, 2015)
+	assert.Equal(t, got.Trends.To, 2023)
+	assert.Equal(t, len(got.Trends.Improvers) <= 5, true)
+	assert.Equal(t, len(got.Trends.Decliners) <= 5, true)
+	for i, trend := range got.Trends.Improvers {
+		assert.Equal(t, trend.ScoreChange > 0, true)
+		if i > 0 {
+			assert.Equal(t, got.Trends.Improvers[i-1].ScoreChange >= trend.ScoreChange, true)
+		}
+	}
+	for _, trend := range got.Trends.Decliners {
+		assert.Equal(t, trend.ScoreChange < 0, true)
+	}
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "missing pillar", urlPath: "/legatum/trends", wantError: map[string]any{"pillar": "must be provided"}},
+		{name: "unknown pillar", urlPath: "/legatum/trends?pillar=wealth", wantError: map[string]any{"pillar": "must be one of the supported pillars"}},
+		{name: "reversed range", urlPath: "/legatum/trends?pillar=health&from=2020&to=2020", wantError: map[string]any{"to": "to must be after from"}},
+		{name: "no edition after from", urlPath: "/legatum/trends?pillar=health&from=2100", wantError: map[string]any{"to": "to must be after from, but the pillar has no edition with data in the range"}},
+		{name: "invalid limit", urlPath: "/legatum/trends?pillar=health&limit=0", wantError: map[string]any{"limit": "limit must be between 1 and 100"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestTimezoneOverlap tests the "/timezones/overlap" endpoint.
+func TestTimezoneOverlap(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Overlap data.WorkingHoursOverlap `json:"overlap"`
+	}
+
+	statusCode, header, body := ts.get(t, "/timezones/overlap?ids=1850147,5809844&date=2026-07-01")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.Overlap.Date, "2026-07-01")
+	assert.Equal(t, len(got.Overlap.Cities), 2)
+	assert.Equal(t, got.Overlap.Cities[0].GeonameID, int64(1850147))
+	for _, window := range got.Overlap.Windows {
+		assert.Equal(t, len(window.Local), 2)
+		assert.Equal(t, window.EndUTC.After(window.StartUTC), true)
+	}
+
+	statusCode, _, _ = ts.get(t, "/timezones/overlap?ids=1850147,999999999")
+	assert.Equal(t, statusCode, http.StatusNotFound)
+
+	deleteCity := func() {
+		if _, err := testDB.Exec("DELETE FROM cities WHERE geoname_id = 999999002"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleteCity()
+	t.Cleanup(deleteCity)
+	_, err := testDB.Exec(`
+		INSERT INTO cities (geoname_id, city, country_code, population, latitude, longitude, timezone)
+		VALUES (999999002, 'Olympus', 'USA', 1000, 40.5, -73.9, 'Mars/Olympus_Mons')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "single id", urlPath: "/timezones/overlap?ids=1850147", wantError: map[string]any{"ids": "ids must contain at least 2 unique values"}},
+		{name: "invalid date", urlPath: "/timezones/overlap?ids=1850147,5809844&date=01.07.2026", wantError: map[string]any{"date": "date must have the form YYYY-MM-DD"}},
+		{name: "unknown timezone", urlPath: "/timezones/overlap?ids=1850147,999999002", wantError: map[string]any{"ids": `city 999999002: unknown timezone "Mars/Olympus_Mons"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestScores tests the "/cities/score" and "/countries/score" endpoints.
+func TestScores(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var cities struct {
+		Cities []data.CityScore `json:"cities"`
+	}
+
+	statusCode, header, body := ts.get(t, "/cities/score?weights=safety:0.4,health_care:0.3,cost_of_living:-0.3&ids=1850147,5809844")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &cities)
+	assert.Equal(t, len(cities.Cities), 2)
+	for _, city := range cities.Cities {
+		assert.Equal(t, len(city.Components), 3)
+		if city.Score != nil {
+			assert.Equal(t, *city.Score >= 0 && *city.Score <= 100, true)
+		}
+	}
+
+	var countries struct {
+		Countries []data.CountryScore `json:"countries"`
+	}
+
+	statusCode, _, body = ts.get(t, "/countries/score?weights=quality_of_life:1&limit=5")
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &countries)
+	assert.Equal(t, len(countries.Countries) <= 5, true)
+	for i := 1; i < len(countries.Countries); i++ {
+		assert.Equal(t, *countries.Countries[i-1].Score >= *countries.Countries[i].Score, true)
+	}
+
+	cities.Cities = nil
+	statusCode, _, body = ts.get(t, "/cities/score?weights=safety:1,traffic_commute_time:-3&limit=100&min_coverage=0.9")
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &cities)
+	for i := 1; i < len(cities.Cities); i++ {
+		prev, city := cities.Cities[i-1], cities.Cities[i]
+		assert.Equal(t, prev.Coverage >= 0.9 || city.Coverage < 0.9, true)
+	}
+
+	statusCode, _, _ = ts.get(t, "/cities/score?weights=safety:1&ids=999999999")
+	assert.Equal(t, statusCode, http.StatusNotFound)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "missing weights", urlPath: "/cities/score", wantError: map[string]any{"weights": "must be provided"}},
+		{name: "malformed weights", urlPath: "/cities/score?weights=safety", wantError: map[string]any{"weights": `weights value "safety" must have the form index:weight`}},
+		{name: "country only index", urlPath: "/cities/score?weights=avg_salary_usd:1", wantError: map[string]any{"weights": `unsupported index "avg_salary_usd"`}},
+		{name: "limit with ids", urlPath: "/cities/score?weights=safety:1&ids=1850147&limit=5", wantError: map[string]any{"limit": "limit cannot be used together with ids"}},
+		{name: "limit with country codes", urlPath: "/countries/score?weights=safety:1&country_codes=USA&limit=5", wantError: map[string]any{"limit": "limit cannot be used together with country_codes"}},
+		{name: "min coverage out of range", urlPath: "/cities/score?weights=safety:1&min_coverage=1.5", wantError: map[string]any{"min_coverage": "min_coverage must be between 0 and 1"}},
+		{name: "country min coverage not a number", urlPath: "/countries/score?weights=safety:1&min_coverage=half", wantError: map[string]any{"min_coverage": "min_coverage must be a number"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestRankings tests the "/rankings/cities" and "/rankings/countries" endpoints.
+func TestRankings(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var cities struct {
+		Rankings []data.CityRanking   `json:"rankings"`
+		Metadata data.RankingMetadata `json:"metadata"`
+	}
+
+	statusCode, header, body := ts.get(t, "/rankings/cities?index=safety&order=asc&limit=5&country_code=usa")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &cities)
+	assert.Equal(t, len(cities.Rankings) <= 5, true)
+	assert.Equal(t, cities.Metadata.Index, "safety")
+	assert.Equal(t, cities.Metadata.Order, "asc")
+	for i, city := range cities.Rankings {
+		assert.Equal(t, city.CountryCode, "USA")
+		if i > 0 {
+			assert.Equal(t, cities.Rankings[i-1].Value <= city.Value, true)
+		}
+	}
+
+	var countries struct {
+		Rankings []data.CountryRanking `json:"rankings"`
+		Metadata data.RankingMetadata  `json:"metadata"`
+	}
+
+	statusCode, _, body = ts.get(t, "/rankings/countries?index=avg_salary_usd")
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &countries)
+	assert.Equal(t, len(countries.Rankings) <= 20, true)
+	assert.Equal(t, countries.Metadata.Order, "desc")
+	if len(countries.Rankings) > 0 {
+		assert.Equal(t, countries.Rankings[0].Rank, 1)
+	}
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "missing index", urlPath: "/rankings/cities", wantError: map[string]any{"index": "must be provided"}},
+		{name: "unsupported city index", urlPath: "/rankings/cities?index=avg_salary_usd", wantError: map[string]any{"index": "must be one of the supported indices"}},
+		{name: "invalid order", urlPath: "/rankings/countries?index=rent&order=up", wantError: map[string]any{"order": "must be asc or desc"}},
+		{name: "invalid limit", urlPath: "/rankings/countries?index=rent&limit=0", wantError: map[string]any{"limit": "limit must be between 1 and 250"}},
+		{name: "invalid population range", urlPath: "/rankings/cities?index=rent&min_population=10&max_population=5", wantError: map[string]any{"max_population": "must not be less than min_population"}},
+		{name: "country filter on countries", urlPath: "/rankings/countries?index=rent&country_code=USA", wantError: map[string]any{"query": `unknown query parameter "country_code"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestNearbyCities tests the "/cities/nearby" endpoint.
+func TestNearbyCities(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var got struct {
+		Cities []struct {
+			GeonameID  int64   `json:"geoname_id"`
+			DistanceKm float64 `json:"distance_km"`
+		} `json:"cities"`
+	}
+
+	statusCode, header, body := ts.get(t, "/cities/nearby?lat=35.6895&lon=139.69171&radius_km=100&limit=3")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, len(got.Cities) > 0 && len(got.Cities) <= 3, true)
+	assert.Equal(t, got.Cities[0].GeonameID, int64(1850147))
+	assert.Equal(t, got.Cities[0].DistanceKm, 0.0)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{
+			name:      "missing coordinates",
+			urlPath:   "/cities/nearby",
+			wantError: map[string]any{"lat": "must be provided", "lon": "must be provided"},
+		},
+		{
+			name:      "latitude out of range",
+			urlPath:   "/cities/nearby?lat=91&lon=0",
+			wantError: map[string]any{"lat": "lat must be between -90 and 90"},
+		},
+		{
+			name:      "radius out of range",
+			urlPath:   "/cities/nearby?lat=0&lon=0&radius_km=5000",
+			wantError: map[string]any{"radius_km": "radius_km must be between 0.1 and 500"},
+		},
+		{
+			name:      "non numeric longitude",
+			urlPath:   "/cities/nearby?lat=0&lon=east",
+			wantError: map[string]any{"lon": "lon must be a number"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestLocateCity tests the "/cities/locate" reverse-geocoding endpoint.
+func TestLocateCity(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	statusCode, header, body := ts.get(t, "/cities/locate?lat=40.7&lon=-74.0")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+
+	var got gotResponse
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.City.GeonameID, int64(5128581))
+	assert.Equal(t, jsonHasKey(body, "city", "distance_km"), true)
+}
+
+// TestSearch tests the "/search" endpoint.
+func TestSearch(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	var results struct {
+		Results []data.SearchResult `json:"results"`
+	}
+
+	statusCode, header, body := ts.get(t, "/search?q=tokio&types=city")
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, header.Get("content-type"), "application/json")
+	unmarshalJSON(t, body, &results)
+	assert.Equal(t, len(results.Results) > 0, true)
+	assert.Equal(t, *results.Results[0].GeonameID, int64(1850147))
+	assert.Equal(t, results.Results[0].Match, "fuzzy")
+
+	statusCode, _, body = ts.get(t, "/search?q=jp&types=country")
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &results)
+	assert.Equal(t, len(results.Results), 1)
+	assert.Equal(t, *results.Results[0].CountryCode, "JPN")
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantError map[string]any
+	}{
+		{name: "missing q", urlPath: "/search", wantError: map[string]any{"q": "must be provided"}},
+		{name: "punctuation only", urlPath: "/search?q=" + url.QueryEscape("?!"), wantError: map[string]any{"q": "must contain at least one letter or digit"}},
+		{name: "unsupported type", urlPath: "/search?q=to&types=planet", wantError: map[string]any{"types": `types contains unsupported value "planet"`}},
+		{name: "limit out of range", urlPath: "/search?q=to&limit=0", wantError: map[string]any{"limit": "limit must be between 1 and 50"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+}
+
+// TestUnknownQueryParams tests that all endpoints reject unknown query parameters.
+func TestUnknownQueryParams(t *testing.T) {
+	ts := newTestServerWithMockUser(testApp.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		urlPath    string
+		headers    http.Header
+		statusCode int
+	}{
+		{name: "healthcheck", method: http.MethodGet, urlPath: "/healthcheck?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "cities list", method: http.MethodGet, urlPath: "/cities?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "cities detail", method: http.MethodGet, urlPath: "/cities/5809844?foo=bar", headers: mocks.Headers, statusCode: http.StatusUnprocessableEntity},
+		{name: "countries list", method: http.MethodGet, urlPath: "/countries?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "countries detail", method: http.MethodGet, urlPath: "/countries/AUS?foo=bar", headers: mocks.Headers, statusCode: http.StatusUnprocessableEntity},
+		{name: "country legatum", method: http.MethodGet, urlPath: "/countries/AUS/legatum?foo=bar", headers: mocks.Headers, statusCode: http.StatusUnprocessableEntity},
+		{name: "legatum trends", method: http.MethodGet, urlPath: "/legatum/trends?pillar=health&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "states list", method: http.MethodGet, urlPath: "/states?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "states detail", method: http.MethodGet, urlPath: "/states/NY?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "city climate", method: http.MethodGet, urlPath: "/cities/1850147/climate?foo=bar", headers: mocks.Headers, statusCode: http.StatusUnprocessableEntity},
+		{name: "similar cities", method: http.MethodGet, urlPath: "/cities/1850147/similar?foo=bar", headers: mocks.Headers, statusCode: http.StatusUnprocessableEntity},
+		{name: "cities climate", method: http.MethodGet, urlPath: "/cities/climate?ids=1850147&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "climate search", method: http.MethodGet, urlPath: "/cities/climate-search?where=high_temp:7:..30&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "compare cities", method: http.MethodGet, urlPath: "/compare/cities?base=1850147&ids=5809844&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "timezone overlap", method: http.MethodGet, urlPath: "/timezones/overlap?ids=1850147,5809844&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "salary equivalence", method: http.MethodGet, urlPath: "/salary-equivalence?from=1850147&to=5809844&amount=1&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "city scores", method: http.MethodGet, urlPath: "/cities/score?weights=safety:1&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "country scores", method: http.MethodGet, urlPath: "/countries/score?weights=safety:1&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "city rankings", method: http.MethodGet, urlPath: "/rankings/cities?index=safety&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "country rankings", method: http.MethodGet, urlPath: "/rankings/countries?index=safety&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "search", method: http.MethodGet, urlPath: "/search?q=to&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "nearby cities", method: http.MethodGet, urlPath: "/cities/nearby?lat=0&lon=0&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "locate city", method: http.MethodGet, urlPath: "/cities/locate?lat=0&lon=0&foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "budget", method: http.MethodPost, urlPath: "/budget?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "register user", method: http.MethodPost, urlPath: "/users?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "activate user", method: http.MethodPut, urlPath: "/users/activated?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+		{name: "authentication token", method: http.MethodPost, urlPath: "/tokens/authentication?foo=bar", headers: nil, statusCode: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, header, body := ts.sendRequest(t, tt.method, tt.urlPath, tt.headers, nil)
+			assert.Equal(t, statusCode, tt.statusCode)
+			assert.Equal(t, header.Get("content-type"), "application/json")
+
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			wantError := map[string]any{
+				"query": "unknown query parameter \"foo\"",
+			}
+			assert.DeepEqual(t, got.Error, wantError)
+		})
+	}
+}
+
+// TestErrorHandling tests handle 404 Not Found and 405 Method Not Allowed errors.
+func TestErrorHandling(t *testing.T) {
+	ts := newTestServer(testApp.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		urlPath    string
+		statusCode int
+		errMessage string
+	}{
+		{
 			name:       "GET to non-existent endpoint",
 			method:     "GET",
 			urlPath:    "/invalidpath",
@@ -1464,6 +2773,191 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+// TestAdminCities tests the admin write endpoints for cities, indices and
+// climate months.
+func TestAdminCities(t *testing.T) {
+	setupDomainVersions(t)
+
+	const cityPath = "/admin/cities/999999001"
+	cleanup := func() {
+		for _, table := range []string{"avg_climate", "numbeo_city_indices", "cities"} {
+			if _, err := testDB.Exec("DELETE FROM " + table + " WHERE geoname_id = 999999001"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	ts := newTestServerWithMockUser(testApp.routes())
+	defer ts.Close()
+
+	statusCode, _, body := ts.sendRequest(t, "POST", cityPath, mocks.Headers, map[string]any{"city": "Testville"})
+	assert.Equal(t, statusCode, http.StatusForbidden)
+	assert.Equal(t, strings.Contains(string(body), "necessary permissions"), true)
+
+	adminEmails := testApp.config.auth.adminEmails
+	testApp.config.auth.adminEmails = []string{"test@example.com"}
+	t.Cleanup(func() { testApp.config.auth.adminEmails = adminEmails })
+
+	var got struct {
+		City          data.CityRecord         `json:"city"`
+		NumbeoIndices data.CityIndicesRecord  `json:"numbeo_indices"`
+		AvgClimate    data.ClimateMonthRecord `json:"avg_climate"`
+	}
+
+	newCity := map[string]any{
+		"city":         "Testville",
+		"country_code": "US",
+		"population":   1200,
+		"latitude":     40.5,
+		"longitude":    -73.9,
+		"timezone":     "America/New_York",
+	}
+	statusCode, header, body := ts.sendRequest(t, "POST", cityPath, mocks.Headers, newCity)
+	assert.Equal(t, statusCode, http.StatusCreated)
+	assert.Equal(t, header.Get("Location"), "/cities/999999001")
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.City.CountryCode, "USA")
+	assert.Equal(t, *got.City.UpdatedBy, "test@example.com")
+	assert.Equal(t, got.City.Version, 1)
+
+	statusCode, _, body = ts.sendRequest(t, "POST", cityPath, mocks.Headers, newCity)
+	assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+	assert.Equal(t, strings.Contains(string(body), "a city with this geoname id already exists"), true)
+
+	statusCode, _, _ = ts.sendRequest(t, "PATCH", cityPath, mocks.Headers, map[string]any{"population": 1300, "version": 2})
+	assert.Equal(t, statusCode, http.StatusConflict)
+
+	statusCode, _, body = ts.sendRequest(t, "PATCH", cityPath, mocks.Headers, map[string]any{"population": 1300, "version": 1})
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, *got.City.Population, int64(1300))
+	assert.Equal(t, got.City.Version, 2)
+
+	indicesPath := cityPath + "/indices"
+	statusCode, _, body = ts.sendRequest(t, "PUT", indicesPath, mocks.Headers, map[string]any{"indices": map[string]any{"safety": 61.5}})
+	assert.Equal(t, statusCode, http.StatusCreated)
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, *got.NumbeoIndices.Indices["safety"], 61.5)
+	assert.Equal(t, got.NumbeoIndices.Version, 1)
+
+	statusCode, _, _ = ts.sendRequest(t, "PUT", indicesPath, mocks.Headers, map[string]any{"indices": map[string]any{"safety": 62}})
+	assert.Equal(t, statusCode, http.StatusConflict)
+
+	statusCode, _, body = ts.sendRequest(t, "PUT", indicesPath, mocks.Headers, map[string]any{"indices": map[string]any{"safety": 62}, "version": 1})
+	assert.Equal(t, statusCode, http.StatusOK)
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.NumbeoIndices.Version, 2)
+
+	climateMonth := map[string]any{"metrics": map[string]any{"high_temp": 29.5, "low_temp": 20.1, "pressure": 650}}
+	statusCode, _, body = ts.sendRequest(t, "PUT", cityPath+"/climate/7", mocks.Headers, climateMonth)
+	assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+	var gotErr gotResponse
+	unmarshalJSON(t, body, &gotErr)
+	assert.DeepEqual(t, gotErr.Error, map[string]any{"month": "can only be added when the city has climate data for the other 11 months"})
+
+	for month := 1; month <= 12; month++ {
+		if month == 7 {
+			continue
+		}
+		_, err := testDB.Exec("INSERT INTO avg_climate (geoname_id, month, high_temp) VALUES (999999001, $1, 20)", month)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statusCode, _, body = ts.sendRequest(t, "PUT", cityPath+"/climate/7", mocks.Headers, climateMonth)
+	assert.Equal(t, statusCode, http.StatusCreated)
+	unmarshalJSON(t, body, &got)
+	assert.Equal(t, got.AvgClimate.Month, 7)
+	assert.Equal(t, *got.AvgClimate.Metrics["high_temp"], 29.5)
+	assert.Equal(t, *got.AvgClimate.Metrics["pressure"], 650.0)
+
+	statusCode, _, body = ts.sendRequest(t, "GET", "/cities/999999001?include=avg_climate", mocks.Headers, nil)
+	assert.Equal(t, statusCode, http.StatusOK)
+	assert.Equal(t, jsonIsNull(body, "city", "avg_climate"), false)
+
+	statusCode, _, _ = ts.sendRequest(t, "GET", "/cities/999999001/climate", mocks.Headers, nil)
+	assert.Equal(t, statusCode, http.StatusOK)
+
+	tests := []struct {
+		name      string
+		method    string
+		urlPath   string
+		body      any
+		wantError map[string]any
+	}{
+		{
+			name:      "unknown country",
+			method:    "PATCH",
+			urlPath:   cityPath,
+			body:      map[string]any{"country_code": "ZZZ", "version": 2},
+			wantError: map[string]any{"country_code": "must be a known ISO 3166-1 alpha-2, alpha-3 or numeric code"},
+		},
+		{
+			name:      "invalid timezone",
+			method:    "PATCH",
+			urlPath:   cityPath,
+			body:      map[string]any{"timezone": "Mars/Olympus_Mons", "version": 2},
+			wantError: map[string]any{"timezone": "must be a valid IANA timezone"},
+		},
+		{
+			name:      "missing version on update",
+			method:    "PATCH",
+			urlPath:   cityPath,
+			body:      map[string]any{"population": 1400},
+			wantError: map[string]any{"version": "must be provided"},
+		},
+		{
+			name:      "missing version on delete",
+			method:    "DELETE",
+			urlPath:   cityPath,
+			wantError: map[string]any{"version": "must be provided"},
+		},
+		{
+			name:      "unsupported index",
+			method:    "PUT",
+			urlPath:   indicesPath,
+			body:      map[string]any{"indices": map[string]any{"happiness": 1}},
+			wantError: map[string]any{"indices": `contains unsupported index "happiness"`},
+		},
+		{
+			name:      "month out of range",
+			method:    "PUT",
+			urlPath:   cityPath + "/climate/13",
+			body:      map[string]any{"metrics": map[string]any{"high_temp": 1}},
+			wantError: map[string]any{"month": "must be between 1 and 12"},
+		},
+		{
+			name:      "temperature out of range",
+			method:    "PUT",
+			urlPath:   cityPath + "/climate/8",
+			body:      map[string]any{"metrics": map[string]any{"high_temp": 75, "sea_temp": -8}},
+			wantError: map[string]any{"metrics.high_temp": "must be between -90 and 60", "metrics.sea_temp": "must be between -5 and 40"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, _, body := ts.sendRequest(t, tt.method, tt.urlPath, mocks.Headers, tt.body)
+			assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+			var got gotResponse
+			unmarshalJSON(t, body, &got)
+			assert.DeepEqual(t, got.Error, tt.wantError)
+		})
+	}
+
+	statusCode, _, _ = ts.sendRequest(t, "DELETE", cityPath+"?version=1", mocks.Headers, nil)
+	assert.Equal(t, statusCode, http.StatusConflict)
+
+	statusCode, _, _ = ts.sendRequest(t, "DELETE", cityPath+"?version=2", mocks.Headers, nil)
+	assert.Equal(t, statusCode, http.StatusOK)
+
+	statusCode, _, _ = ts.sendRequest(t, "DELETE", cityPath+"?version=2", mocks.Headers, nil)
+	assert.Equal(t, statusCode, http.StatusNotFound)
+}
+
 func TestRegisterUser(t *testing.T) {
 	setupUsersTable(t)
 	defer teardownUsersTable(t)
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+)
+
+func (app *application) salaryEquivalenceHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("from", "to", "amount", "currency"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	errs := map[string]string{}
+	fromID, err := parseRequiredID(qs, "from")
+	if err != nil {
+		errs["from"] = err.Error()
+	}
+	toID, err := parseRequiredID(qs, "to")
+	if err != nil {
+		errs["to"] = err.Error()
+	}
+	amount, err := parseFloat(qs, "amount", 0, 1, 1e9)
+	if err == nil && !qs.Has("amount") {
+		err = errors.New("amount must be provided")
+	}
+	if err != nil {
+		errs["amount"] = err.Error()
+	}
+	currency, err := parseCurrency(qs)
+	if err != nil {
+		errs["currency"] = err.Error()
+	}
+	if len(errs) > 0 {
+		app.failedValidationResponse(w, r, errs)
+		return
+	}
+	if currency == "" {
+		currency = "USD"
+	}
+
+	cities, err := app.models.Cities.GetCitiesByIDs([]int64{fromID, toID}, data.NewIncludeSet("numbeo_indices"), nil)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	cityByID := make(map[int64]*data.City, len(cities))
+	codes := make([]string, 0, len(cities))
+	for _, city := range cities {
+		cityByID[city.GeonameID] = city
+		codes = append(codes, city.CountryCode)
+	}
+	if cityByID[fromID] == nil || cityByID[toID] == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	countries, err := app.models.Countries.GetCountriesByCodes(codes, data.NewIncludeSet("numbeo_indices"))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	countryByCode := make(map[string]*data.Country, len(countries))
+	for _, country := range countries {
+		countryByCode[country.Code] = country
+	}
+
+	from := data.NewSalaryCity(cityByID[fromID], countryByCode[cityByID[fromID].CountryCode])
+	to := data.NewSalaryCity(cityByID[toID], countryByCode[cityByID[toID].CountryCode])
+
+	equivalence, err := data.NewSalaryEquivalence(from, to, amount, currency)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMissingCostOfLiving):
+			key := "from"
+			if from.CostOfLivingPlusRent.Value != nil && *from.CostOfLivingPlusRent.Value != 0 {
+				key = "to"
+			}
+			app.failedValidationResponse(w, r, map[string]string{key: err.Error()})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"salary_equivalence": equivalence}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func (app *application) cityScoresHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("weights", "ids", "limit", "min_coverage"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	weights, err := parseScoreWeights(qs, "weights")
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"weights": err.Error()})
+		return
+	}
+
+	ids, idsPresent, err := parseIDsInt64(qs, "ids", app.config.batch.maxIDs)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"ids": err.Error()})
+		return
+	}
+
+	limit, err := parseScoreLimit(qs, idsPresent, "ids")
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"limit": err.Error()})
+		return
+	}
+
+	minCoverage, err := parseFloat(qs, "min_coverage", data.DefaultMinScoreCoverage, 0, 1)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"min_coverage": err.Error()})
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateScoreWeights(v, weights, data.CityRankingIndices); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	scores, err := app.models.Cities.ScoreCities(weights, ids, limit, minCoverage)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if idsPresent && len(scores) == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"cities": scores}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) countryScoresHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("weights", "country_codes", "limit", "min_coverage"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	weights, err := parseScoreWeights(qs, "weights")
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"weights": err.Error()})
+		return
+	}
+
+	codes, codesPresent, err := parseIDsString(qs, "country_codes", 0)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"country_codes": err.Error()})
+		return
+	}
+
+	limit, err := parseScoreLimit(qs, codesPresent, "country_codes")
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"limit": err.Error()})
+		return
+	}
+
+	minCoverage, err := parseFloat(qs, "min_coverage", data.DefaultMinScoreCoverage, 0, 1)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"min_coverage": err.Error()})
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateScoreWeights(v, weights, data.CountryRankingIndices); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if codesPresent {
+		codes, err = app.models.Countries.ResolveCodes(codes)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(codes) == 0 {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+
+	scores, err := app.models.Countries.ScoreCountries(weights, codes, limit, minCoverage)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if codesPresent && len(scores) == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"countries": scores}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// parseScoreLimit reads limit, which only applies when the score endpoints rank
+// the whole dataset rather than an explicit list of ids.
+func parseScoreLimit(qs url.Values, idsPresent bool, idsKey string) (int, error) {
+	if idsPresent {
+		if qs.Has("limit") {
+			return 0, fmt.Errorf("limit cannot be used together with %s", idsKey)
+		}
+		return 0, nil
+	}
+	return parseInt(qs, "limit", 20, 1, 100)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("q", "types", "limit"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	query := strings.TrimSpace(qs.Get("q"))
+
+	v := validator.New()
+	v.Check(query != "", "q", "must be provided")
+	v.Check(utf8.RuneCountInString(query) <= 100, "q", "must not be more than 100 characters long")
+	v.Check(data.NormalizeSearchText(query) != "", "q", "must contain at least one letter or digit")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	types, err := parseValueSet(qs, "types", newIncludeSet(data.SearchTypeCity, data.SearchTypeCountry, data.SearchTypeState))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"types": err.Error()})
+		return
+	}
+
+	limit, err := parseInt(qs, "limit", 10, 1, 50)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"limit": err.Error()})
+		return
+	}
+
+	results, err := app.models.Search.Search(r.Context(), query, types, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func (app *application) similarCitiesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	err = validateAllowedQueryParams(qs, newIncludeSet("limit", "exclude_country", "max_cost_ratio"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	var input data.SimilarityFilters
+	v := validator.New()
+
+	if input.Limit, err = parseInt(qs, "limit", 10, 1, 50); err != nil {
+		v.AddError("limit", err.Error())
+	}
+
+	if input.ExcludeCountries, _, err = parseIDsString(qs, "exclude_country", 0); err != nil {
+		v.AddError("exclude_country", err.Error())
+	}
+	for _, code := range input.ExcludeCountries {
+		countryV := validator.New()
+		if data.ValidateFilters(countryV, data.Filters{CountryCode: code}); !countryV.Valid() {
+			v.AddError("exclude_country", "must contain only ISO 3166-1 alpha-2, alpha-3 or numeric codes")
+		}
+	}
+
+	if qs.Has("max_cost_ratio") {
+		ratio, err := parseFloat(qs, "max_cost_ratio", 0, 0.01, 100)
+		if err != nil {
+			v.AddError("max_cost_ratio", err.Error())
+		}
+		input.MaxCostRatio = &ratio
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if len(input.ExcludeCountries) > 0 {
+		input.ExcludeCountries, err = app.models.Countries.ResolveCodes(input.ExcludeCountries)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	cities, err := app.models.Cities.SimilarCities(id, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"cities": cities}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/exchangerates"
 	"github.com/denis-k2/relohelper-go/internal/mocks"
 )
 
@@ -77,6 +78,9 @@ func newTestApplication(cfg config) (*application, *sql.DB, error) {
 		db:     db,
 		models: data.NewModels(db),
 		mailer: mocks.NewMockMailer(),
+		// Without an app id the service never calls upstream and serves the
+		// embedded fallback rates.
+		exchangeRates: exchangerates.NewService(logger, ""),
 	}, db, nil
 }
 
@@ -243,6 +247,20 @@ func setupUsersTable(t *testing.T) {
 	}
 }
 
+// setupDomainVersions adds the version columns used by the admin endpoints.
+func setupDomainVersions(t *testing.T) {
+	t.Helper()
+	script, err := os.ReadFile("../../migrations/000008_add_domain_versions.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = testDB.Exec(string(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func teardownUsersTable(t *testing.T) {
 	t.Helper()
 	script, err := os.ReadFile("../../migrations/000001_create_users_table.down.sql")
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+)
+
+func (app *application) timezoneOverlapHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	err := validateAllowedQueryParams(qs, newIncludeSet("ids", "date"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"query": err.Error()})
+		return
+	}
+
+	ids, _, err := parseIDsInt64(qs, "ids", app.config.batch.maxDetailedIDs)
+	if err == nil && len(ids) < 2 {
+		err = fmt.Errorf("ids must contain at least 2 unique values")
+	}
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"ids": err.Error()})
+		return
+	}
+
+	date := time.Now().UTC()
+	if qs.Has("date") {
+		date, err = time.Parse(time.DateOnly, strings.TrimSpace(qs.Get("date")))
+		if err != nil {
+			app.failedValidationResponse(w, r, map[string]string{"date": "date must have the form YYYY-MM-DD"})
+			return
+		}
+	}
+
+	cities, err := app.models.Cities.GetCitiesByIDs(ids, data.NewIncludeSet(), nil)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Keep the requested order: the first city is the reference.
+	byID := make(map[int64]*data.City, len(cities))
+	for _, city := range cities {
+		byID[city.GeonameID] = city
+	}
+	ordered := make([]*data.City, 0, len(ids))
+	for _, id := range ids {
+		city, ok := byID[id]
+		if !ok {
+			app.notFoundResponse(w, r)
+			return
+		}
+		ordered = append(ordered, city)
+	}
+
+	overlap, err := data.NewWorkingHoursOverlap(ordered, date)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownTimezone):
+			app.failedValidationResponse(w, r, map[string]string{"ids": err.Error()})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"overlap": overlap}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
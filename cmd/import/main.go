@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/importer"
+)
+
+const usage = `Usage: import <command> [flags] <files>
+
+Commands:
+  numbeo-costs  load Numbeo city costs into numbeo_city_costs from <file.csv>
+  geonames      load cities and states from <citiesNNNN.txt> <admin1CodesASCII.txt>
+  climate       load monthly climate averages into avg_climate from <file.csv|file.json>
+
+Run "import <command> -h" for the flags of a command.`
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "numbeo-costs":
+		return runNumbeoCosts(args[1:], stdout)
+	case "geonames":
+		return runGeoNames(args[1:], stdout)
+	case "climate":
+		return runClimate(args[1:], stdout)
+	case "-h", "-help", "--help", "help":
+		_, err := fmt.Fprintln(stdout, usage)
+		return err
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+}
+
+// commandConfig holds the flags shared by every command.
+type commandConfig struct {
+	dsn       string
+	dryRun    bool
+	updatedBy string
+	paths     []string
+}
+
+// parseCommandFlags parses the shared flags, the flags that define registers
+// and exactly len(files) file arguments.
+func parseCommandFlags(name string, args []string, files []string, define func(fs *flag.FlagSet)) (commandConfig, error) {
+	var cfg commandConfig
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if define != nil {
+		define(fs)
+	}
+	fs.StringVar(&cfg.dsn, "db-dsn", os.Getenv("RELOHELPER_DB_DSN"), "PostgreSQL DSN")
+	fs.BoolVar(&cfg.dryRun, "dry-run", false, "Validate and report without writing to the database")
+	fs.StringVar(&cfg.updatedBy, "updated-by", "import", "Value stored in the updated_by column")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, err
+	}
+
+	if fs.NArg() != len(files) {
+		return cfg, fmt.Errorf("%s expects %d arguments (%s), got %d", name, len(files), strings.Join(files, " "), fs.NArg())
+	}
+	cfg.paths = fs.Args()
+
+	if cfg.dsn == "" {
+		return cfg, errors.New("database DSN must be provided with -db-dsn or RELOHELPER_DB_DSN")
+	}
+
+	return cfg, nil
+}
+
+func runNumbeoCosts(args []string, stdout io.Writer) error {
+	cfg, err := parseCommandFlags("numbeo-costs", args, []string{"<file.csv>"}, nil)
+	if err != nil {
+		return err
+	}
+
+	var report importer.Report
+	var costs []importer.NumbeoCost
+	err = parseFile(cfg.paths[0], func(r io.Reader) (err error) {
+		costs, err = importer.ParseNumbeoCosts(r, &report)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = importer.ImportNumbeoCosts(db, costs, cfg.updatedBy, cfg.dryRun, &report)
+	if err != nil {
+		return err
+	}
+
+	return report.Print(stdout, "numbeo-costs")
+}
+
+func runGeoNames(args []string, stdout io.Writer) error {
+	var stateCountries string
+	cfg, err := parseCommandFlags("geonames", args, []string{"<citiesNNNN.txt>", "<admin1CodesASCII.txt>"}, func(fs *flag.FlagSet) {
+		fs.StringVar(&stateCountries, "state-countries", "US", "Comma-separated ISO alpha-2 codes of the countries whose admin1 divisions are imported as states")
+	})
+	if err != nil {
+		return err
+	}
+
+	var cityReport, stateReport importer.Report
+	var cities []importer.GeoNamesCity
+	err = parseFile(cfg.paths[0], func(r io.Reader) (err error) {
+		cities, err = importer.ParseGeoNamesCities(r, &cityReport)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var states []importer.GeoNamesState
+	err = parseFile(cfg.paths[1], func(r io.Reader) (err error) {
+		states, err = importer.ParseGeoNamesStates(r, strings.Split(stateCountries, ","), &stateReport)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = importer.ImportGeoNames(db, states, cities, cfg.updatedBy, cfg.dryRun, &stateReport, &cityReport)
+	if err != nil {
+		return err
+	}
+
+	err = stateReport.Print(stdout, "states")
+	if err != nil {
+		return err
+	}
+	return cityReport.Print(stdout, "cities")
+}
+
+func runClimate(args []string, stdout io.Writer) error {
+	cfg, err := parseCommandFlags("climate", args, []string{"<file.csv|file.json>"}, nil)
+	if err != nil {
+		return err
+	}
+
+	parse := importer.ParseClimateCSV
+	if strings.EqualFold(filepath.Ext(cfg.paths[0]), ".json") {
+		parse = importer.ParseClimateJSON
+	}
+
+	var report importer.Report
+	var cities []importer.ClimateCity
+	err = parseFile(cfg.paths[0], func(r io.Reader) (err error) {
+		cities, err = parse(r, &report)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = importer.ImportClimate(db, cities, cfg.updatedBy, cfg.dryRun, &report)
+	if err != nil {
+		return err
+	}
+
+	err = report.Print(stdout, "climate")
+	if err != nil {
+		return err
+	}
+
+	// The similar cities features average the climate, so they are stale now.
+	if cfg.dryRun || report.Inserted+report.Updated == 0 {
+		return nil
+	}
+	return data.CityModel{DB: db}.RefreshFeatures()
+}
+
+// parseFile opens path and passes it to parse, prefixing errors with path.
+func parseFile(path string, parse func(r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = parse(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		if closeErr := db.Close(); closeErr != nil {
+			return nil, errors.Join(err, closeErr)
+		}
+		return nil, err
+	}
+
+	return db, nil
+}
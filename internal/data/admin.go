@@ -0,0 +1,446 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+var (
+	ErrDuplicateCity     = errors.New("duplicate city")
+	ErrUnknownState      = errors.New("unknown state")
+	ErrIncompleteClimate = errors.New("incomplete climate")
+)
+
+// CityRecord is a row of the cities table as written through the admin API.
+// UpdatedDate, UpdatedBy and Version are set by the database.
+type CityRecord struct {
+	GeonameID   int64   `json:"geoname_id"`
+	Name        string  `json:"city"`
+	StateCode   *string `json:"state_code"`
+	CountryCode string  `json:"country_code"`
+	Population  *int64  `json:"population"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Timezone    string  `json:"timezone"`
+	UpdatedDate string  `json:"updated_date"`
+	UpdatedBy   *string `json:"updated_by"`
+	Version     int     `json:"version"`
+}
+
+func ValidateCityRecord(v *validator.Validator, city *CityRecord) {
+	v.Check(city.GeonameID > 0, "geoname_id", "must be a positive integer")
+
+	v.Check(city.Name != "", "city", "must be provided")
+	v.Check(len(city.Name) <= 200, "city", "must not be more than 200 bytes long")
+
+	v.Check(city.StateCode == nil || *city.StateCode != "", "state_code", "must not be empty")
+	v.Check(city.CountryCode != "", "country_code", "must be provided")
+	v.Check(city.Population == nil || *city.Population >= 0, "population", "must not be negative")
+
+	v.Check(city.Latitude >= -90 && city.Latitude <= 90, "latitude", "must be between -90 and 90")
+	v.Check(city.Longitude >= -180 && city.Longitude <= 180, "longitude", "must be between -180 and 180")
+
+	_, err := loadLocation(city.Timezone)
+	v.Check(city.Timezone != "", "timezone", "must be provided")
+	v.Check(err == nil, "timezone", "must be a valid IANA timezone")
+}
+
+// CityIndicesRecord is the numbeo_city_indices row of a city. Indices is keyed
+// by the names in CityRankingIndices; missing indices are stored as null.
+type CityIndicesRecord struct {
+	GeonameID   int64               `json:"geoname_id"`
+	Indices     map[string]*float64 `json:"indices"`
+	UpdatedDate string              `json:"updated_date"`
+	UpdatedBy   *string             `json:"updated_by"`
+	Version     int                 `json:"version"`
+}
+
+func ValidateCityIndicesRecord(v *validator.Validator, record *CityIndicesRecord) {
+	v.Check(len(record.Indices) > 0, "indices", "must be provided")
+	for _, name := range sortedKeys(record.Indices) {
+		v.Check(slices.Contains(CityRankingIndices, name), "indices", fmt.Sprintf("contains unsupported index %q", name))
+		value := record.Indices[name]
+		v.Check(value == nil || *value >= 0, "indices."+name, "must not be negative")
+	}
+	v.Check(record.Version >= 0, "version", "must not be negative")
+}
+
+// ClimateMonthRecord is the avg_climate row of a city for one month. Metrics is
+// keyed by the names in ClimateMetrics; missing metrics are stored as null.
+type ClimateMonthRecord struct {
+	GeonameID   int64               `json:"geoname_id"`
+	Month       int                 `json:"month"`
+	Metrics     map[string]*float64 `json:"metrics"`
+	UpdatedDate string              `json:"updated_date"`
+	UpdatedBy   *string             `json:"updated_by"`
+	Version     int                 `json:"version"`
+}
+
+// climateMetricBounds lists the inclusive range of the climate metrics that
+// have one. The pressure series doesn't say whether it is reduced to sea level
+// or measured at the station, so its range admits both: 300 mbar is below the
+// station pressure of any inhabited place.
+var climateMetricBounds = map[string][2]float64{
+	"high_temp":     {-90, 60},
+	"low_temp":      {-90, 60},
+	"pressure":      {300, 1100},
+	"wind_speed":    {0, 500},
+	"humidity":      {0, 100},
+	"rainfall":      {0, 10000},
+	"rainfall_days": {0, 31},
+	"snowfall":      {0, 10000},
+	"snowfall_days": {0, 31},
+	"sea_temp":      {-5, 40},
+	"daylight":      {0, 24},
+	"sunshine":      {0, 744},
+	"sunshine_days": {0, 31},
+	"uv_index":      {0, 20},
+	"cloud_cover":   {0, 100},
+	"visibility":    {0, 1000},
+}
+
+func ValidateClimateMonthRecord(v *validator.Validator, record *ClimateMonthRecord) {
+	v.Check(record.Month >= 1 && record.Month <= 12, "month", "must be between 1 and 12")
+	v.Check(len(record.Metrics) > 0, "metrics", "must be provided")
+	for _, name := range sortedKeys(record.Metrics) {
+		v.Check(slices.Contains(ClimateMetrics, name), "metrics", fmt.Sprintf("contains unsupported metric %q", name))
+		value, bounds := record.Metrics[name], climateMetricBounds[name]
+		if value != nil && bounds != [2]float64{} {
+			v.Check(*value >= bounds[0] && *value <= bounds[1], "metrics."+name, fmt.Sprintf("must be between %g and %g", bounds[0], bounds[1]))
+		}
+	}
+	if high, low := record.Metrics["high_temp"], record.Metrics["low_temp"]; high != nil && low != nil {
+		v.Check(*low <= *high, "metrics.low_temp", "must not be greater than high_temp")
+	}
+	v.Check(record.Version >= 0, "version", "must not be negative")
+}
+
+func sortedKeys(values map[string]*float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// cityWriteError maps constraint violations of the cities table to the errors
+// of this package.
+func cityWriteError(err error) error {
+	switch {
+	case err.Error() == `pq: duplicate key value violates unique constraint "cities_pkey"`:
+		return ErrDuplicateCity
+	case strings.Contains(err.Error(), `"cities_state_code_fkey"`):
+		return ErrUnknownState
+	case strings.Contains(err.Error(), `"cities_country_code_fkey"`):
+		return ErrRecordNotFound
+	default:
+		return err
+	}
+}
+
+func (c CityModel) GetCityRecord(id int64) (*CityRecord, error) {
+	query := `
+		SELECT geoname_id, city, state_code, country_code, population, latitude, longitude,
+		       timezone, COALESCE(to_char(updated_date, 'YYYY-MM-DD'), ''), updated_by, version
+		FROM cities
+		WHERE geoname_id = $1;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var city CityRecord
+	err := c.DB.QueryRowContext(ctx, query, id).Scan(
+		&city.GeonameID,
+		&city.Name,
+		&city.StateCode,
+		&city.CountryCode,
+		&city.Population,
+		&city.Latitude,
+		&city.Longitude,
+		&city.Timezone,
+		&city.UpdatedDate,
+		&city.UpdatedBy,
+		&city.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &city, nil
+}
+
+// InsertCity returns ErrDuplicateCity if the geoname id is taken, and
+// ErrUnknownState or ErrRecordNotFound if the state or the country is unknown.
+func (c CityModel) InsertCity(city *CityRecord, updatedBy string) error {
+	query := `
+		INSERT INTO cities (geoname_id, city, state_code, country_code, population, latitude, longitude,
+		                    timezone, updated_date, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_DATE, $9)
+		RETURNING to_char(updated_date, 'YYYY-MM-DD'), updated_by, version`
+
+	args := []any{
+		city.GeonameID,
+		city.Name,
+		city.StateCode,
+		city.CountryCode,
+		city.Population,
+		city.Latitude,
+		city.Longitude,
+		city.Timezone,
+		updatedBy,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&city.UpdatedDate, &city.UpdatedBy, &city.Version)
+	if err != nil {
+		return cityWriteError(err)
+	}
+
+	return nil
+}
+
+// UpdateCity saves city if its Version is still current and returns
+// ErrEditConflict otherwise.
+func (c CityModel) UpdateCity(city *CityRecord, updatedBy string) error {
+	query := `
+		UPDATE cities
+		SET city = $1, state_code = $2, country_code = $3, population = $4, latitude = $5, longitude = $6,
+		    timezone = $7, updated_date = CURRENT_DATE, updated_by = $8, version = version + 1
+		WHERE geoname_id = $9 AND version = $10
+		RETURNING to_char(updated_date, 'YYYY-MM-DD'), updated_by, version`
+
+	args := []any{
+		city.Name,
+		city.StateCode,
+		city.CountryCode,
+		city.Population,
+		city.Latitude,
+		city.Longitude,
+		city.Timezone,
+		updatedBy,
+		city.GeonameID,
+		city.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&city.UpdatedDate, &city.UpdatedBy, &city.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return cityWriteError(err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteCity deletes a city together with its Numbeo and climate rows. It
+// returns ErrEditConflict when version is no longer current.
+func (c CityModel) DeleteCity(id int64, version int) (retErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	var current int
+	err = tx.QueryRowContext(ctx, `SELECT version FROM cities WHERE geoname_id = $1 FOR UPDATE;`, id).Scan(&current)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	if version != current {
+		return ErrEditConflict
+	}
+
+	for _, table := range []string{"avg_climate", "numbeo_city_costs", "numbeo_city_indices", "cities"} {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE geoname_id = $1;`, table), id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UpsertCityIndices inserts the indices of a city when record.Version is zero
+// and updates them otherwise. It returns ErrEditConflict when a zero version
+// meets an existing row or a non-zero version is no longer current. created
+// reports whether a row was inserted.
+func (c CityModel) UpsertCityIndices(record *CityIndicesRecord, updatedBy string) (created bool, err error) {
+	created = record.Version == 0
+	values := make([]any, 0, len(CityRankingIndices))
+	for _, name := range CityRankingIndices {
+		values = append(values, record.Indices[name])
+	}
+
+	query := upsertQuery("numbeo_city_indices", []string{"geoname_id"}, CityRankingIndices, record.Version)
+	args := append([]any{record.GeonameID}, values...)
+	args = append(args, updatedBy)
+	if record.Version != 0 {
+		args = append(args, record.Version)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = c.DB.QueryRowContext(ctx, query, args...).Scan(&record.UpdatedDate, &record.UpdatedBy, &record.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrEditConflict
+		default:
+			return false, err
+		}
+	}
+
+	record.Indices = completeValues(record.Indices, CityRankingIndices)
+	return created, nil
+}
+
+// UpsertClimateMonth works like UpsertCityIndices for one avg_climate month.
+// Climate is only read as a full year, so a month can only be inserted when the
+// city already has the other 11; ErrIncompleteClimate is returned otherwise.
+func (c CityModel) UpsertClimateMonth(record *ClimateMonthRecord, updatedBy string) (created bool, retErr error) {
+	created = record.Version == 0
+	values := make([]any, 0, len(ClimateMetrics))
+	for _, name := range ClimateMetrics {
+		values = append(values, record.Metrics[name])
+	}
+
+	query := upsertQuery("avg_climate", []string{"geoname_id", "month"}, ClimateMetrics, record.Version)
+	args := append([]any{record.GeonameID, record.Month}, values...)
+	args = append(args, updatedBy)
+	if record.Version != 0 {
+		args = append(args, record.Version)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	if created {
+		// Locking the city serializes inserts, so two requests cannot both
+		// see 10 other months and leave the year incomplete.
+		_, err = tx.ExecContext(ctx, `SELECT 1 FROM cities WHERE geoname_id = $1 FOR UPDATE;`, record.GeonameID)
+		if err != nil {
+			return false, err
+		}
+
+		var otherMonths int
+		err = tx.QueryRowContext(ctx, `
+			SELECT count(*)
+			FROM avg_climate
+			WHERE geoname_id = $1 AND month <> $2;`, record.GeonameID, record.Month).Scan(&otherMonths)
+		if err != nil {
+			return false, err
+		}
+		if otherMonths < 11 {
+			return false, ErrIncompleteClimate
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&record.UpdatedDate, &record.UpdatedBy, &record.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrEditConflict
+		default:
+			return false, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	record.Metrics = completeValues(record.Metrics, ClimateMetrics)
+	return created, nil
+}
+
+// upsertQuery builds the statement of UpsertCityIndices and UpsertClimateMonth.
+// The placeholders are the keys, the columns and updated_by, followed by the
+// expected version for updates. Only package-level column names are used.
+func upsertQuery(table string, keys, columns []string, version int) string {
+	placeholders := make([]string, 0, len(keys)+len(columns))
+	for i := range len(keys) + len(columns) {
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+	}
+	updatedBy := len(placeholders) + 1
+
+	if version == 0 {
+		return fmt.Sprintf(`
+			INSERT INTO %s (%s, %s, updated_date, updated_by)
+			VALUES (%s, CURRENT_DATE, $%d)
+			ON CONFLICT (%s) DO NOTHING
+			RETURNING to_char(updated_date, 'YYYY-MM-DD'), updated_by, version`,
+			table, strings.Join(keys, ", "), strings.Join(columns, ", "),
+			strings.Join(placeholders, ", "), updatedBy,
+			strings.Join(keys, ", "))
+	}
+
+	assignments := make([]string, 0, len(columns))
+	for i, column := range columns {
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", column, len(keys)+i+1))
+	}
+	conditions := make([]string, 0, len(keys))
+	for i, key := range keys {
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", key, i+1))
+	}
+
+	return fmt.Sprintf(`
+		UPDATE %s
+		SET %s, updated_date = CURRENT_DATE, updated_by = $%d, version = version + 1
+		WHERE %s AND version = $%d
+		RETURNING to_char(updated_date, 'YYYY-MM-DD'), updated_by, version`,
+		table, strings.Join(assignments, ", "), updatedBy,
+		strings.Join(conditions, " AND "), updatedBy+1)
+}
+
+// completeValues returns values with an entry, possibly nil, for every name.
+func completeValues(values map[string]*float64, names []string) map[string]*float64 {
+	complete := make(map[string]*float64, len(names))
+	for _, name := range names {
+		complete[name] = values[name]
+	}
+	return complete
+}
@@ -0,0 +1,91 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func TestValidateCityRecord(t *testing.T) {
+	population := int64(-1)
+	empty := ""
+
+	v := validator.New()
+	ValidateCityRecord(v, &CityRecord{
+		GeonameID:   1,
+		Name:        "Testville",
+		CountryCode: "USA",
+		Latitude:    40.5,
+		Longitude:   -73.9,
+		Timezone:    "America/New_York",
+	})
+	assert.Equal(t, v.Valid(), true)
+
+	v = validator.New()
+	ValidateCityRecord(v, &CityRecord{
+		StateCode:  &empty,
+		Population: &population,
+		Latitude:   91,
+		Longitude:  -181,
+		Timezone:   "Mars/Olympus_Mons",
+	})
+	assert.DeepEqual(t, v.Errors, map[string]string{
+		"geoname_id":   "must be a positive integer",
+		"city":         "must be provided",
+		"state_code":   "must not be empty",
+		"country_code": "must be provided",
+		"population":   "must not be negative",
+		"latitude":     "must be between -90 and 90",
+		"longitude":    "must be between -180 and 180",
+		"timezone":     "must be a valid IANA timezone",
+	})
+}
+
+func TestValidateClimateMonthRecord(t *testing.T) {
+	high, low, humidity := 10.0, 12.0, 120.0
+
+	v := validator.New()
+	ValidateClimateMonthRecord(v, &ClimateMonthRecord{
+		Month:   13,
+		Metrics: map[string]*float64{"high_temp": &high, "low_temp": &low, "humidity": &humidity, "fog": nil},
+	})
+	assert.DeepEqual(t, v.Errors, map[string]string{
+		"month":            "must be between 1 and 12",
+		"metrics":          `contains unsupported metric "fog"`,
+		"metrics.humidity": "must be between 0 and 100",
+		"metrics.low_temp": "must not be greater than high_temp",
+	})
+
+	hot, cold, stationPressure, seaTemp := 75.0, -95.0, 650.0, 41.0
+	v = validator.New()
+	ValidateClimateMonthRecord(v, &ClimateMonthRecord{
+		Month:   1,
+		Metrics: map[string]*float64{"high_temp": &hot, "low_temp": &cold, "pressure": &stationPressure, "sea_temp": &seaTemp},
+	})
+	assert.DeepEqual(t, v.Errors, map[string]string{
+		"metrics.high_temp": "must be between -90 and 60",
+		"metrics.low_temp":  "must be between -90 and 60",
+		"metrics.sea_temp":  "must be between -5 and 40",
+	})
+
+	v = validator.New()
+	ValidateCityIndicesRecord(v, &CityIndicesRecord{Version: -1})
+	assert.DeepEqual(t, v.Errors, map[string]string{
+		"indices": "must be provided",
+		"version": "must not be negative",
+	})
+}
+
+func TestUpsertQuery(t *testing.T) {
+	insert := strings.Join(strings.Fields(upsertQuery("avg_climate", []string{"geoname_id", "month"}, []string{"high_temp", "low_temp"}, 0)), " ")
+	assert.Equal(t, insert, "INSERT INTO avg_climate (geoname_id, month, high_temp, low_temp, updated_date, updated_by) "+
+		"VALUES ($1, $2, $3, $4, CURRENT_DATE, $5) ON CONFLICT (geoname_id, month) DO NOTHING "+
+		"RETURNING to_char(updated_date, 'YYYY-MM-DD'), updated_by, version")
+
+	update := strings.Join(strings.Fields(upsertQuery("avg_climate", []string{"geoname_id", "month"}, []string{"high_temp", "low_temp"}, 3)), " ")
+	assert.Equal(t, update, "UPDATE avg_climate SET high_temp = $3, low_temp = $4, updated_date = CURRENT_DATE, updated_by = $5, version = version + 1 "+
+		"WHERE geoname_id = $1 AND month = $2 AND version = $6 "+
+		"RETURNING to_char(updated_date, 'YYYY-MM-DD'), updated_by, version")
+}
@@ -0,0 +1,259 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// CityAggregateCosts are the Numbeo cost params, in USD, summarised by
+// include=city_aggregates.
+var CityAggregateCosts = []string{
+	"Meal, Inexpensive Restaurant",
+	"Cappuccino (regular)",
+	"Monthly Pass (Regular Price)",
+	"Basic (Electricity, Heating, Cooling, Water, Garbage) for 85m2 Apartment",
+	"Internet (60 Mbps or More, Unlimited Data, Cable/ADSL)",
+	"Apartment (1 bedroom) in City Centre",
+	"Apartment (1 bedroom) Outside of Centre",
+	"Apartment (3 bedrooms) in City Centre",
+	"Fitness Club, Monthly Fee for 1 Adult",
+	"Average Monthly Net Salary (After Tax)",
+}
+
+// CityAggregates summarises the Numbeo data of the cities of a country.
+// CityCount is the number of cities that contributed at least one value.
+type CityAggregates struct {
+	CityCount int                       `json:"city_count"`
+	Indices   map[string]AggregateStats `json:"indices"`
+	Costs     []CostAggregate           `json:"costs"`
+}
+
+// AggregateStats describes the values of Cities cities. WeightedMean is weighted
+// by city population; cities without a population are left out of it, and the
+// plain mean is used when none of the cities has one.
+type AggregateStats struct {
+	Cities       int      `json:"cities"`
+	WeightedMean *float64 `json:"weighted_mean"`
+	Median       *float64 `json:"median"`
+	Min          *float64 `json:"min"`
+	Max          *float64 `json:"max"`
+}
+
+type CostAggregate struct {
+	Category string `json:"category"`
+	Param    string `json:"param"`
+	AggregateStats
+}
+
+type cityValue struct {
+	value      float64
+	population *int64
+}
+
+func newAggregateStats(values []cityValue) AggregateStats {
+	stats := AggregateStats{Cities: len(values)}
+	if len(values) == 0 {
+		return stats
+	}
+
+	sorted := make([]float64, 0, len(values))
+	var sum, weightedSum, weights float64
+	for _, v := range values {
+		sorted = append(sorted, v.value)
+		sum += v.value
+		if v.population != nil && *v.population > 0 {
+			weightedSum += v.value * float64(*v.population)
+			weights += float64(*v.population)
+		}
+	}
+	slices.Sort(sorted)
+
+	mean := sum / float64(len(values))
+	if weights > 0 {
+		mean = weightedSum / weights
+	}
+
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+
+	stats.WeightedMean = roundAggregate(mean)
+	stats.Median = roundAggregate(median)
+	stats.Min = roundAggregate(sorted[0])
+	stats.Max = roundAggregate(sorted[len(sorted)-1])
+
+	return stats
+}
+
+func roundAggregate(value float64) *float64 {
+	rounded := math.Round(value*100) / 100
+	return &rounded
+}
+
+// cityAggregatesBuilder collects city values of a single country.
+type cityAggregatesBuilder struct {
+	cities  map[int64]struct{}
+	indices map[string][]cityValue
+	costs   map[[2]string][]cityValue
+}
+
+func newCityAggregatesBuilder() *cityAggregatesBuilder {
+	return &cityAggregatesBuilder{
+		cities:  map[int64]struct{}{},
+		indices: map[string][]cityValue{},
+		costs:   map[[2]string][]cityValue{},
+	}
+}
+
+func (b *cityAggregatesBuilder) build() *CityAggregates {
+	aggregates := &CityAggregates{
+		CityCount: len(b.cities),
+		Indices:   make(map[string]AggregateStats, len(CityRankingIndices)),
+		Costs:     make([]CostAggregate, 0, len(b.costs)),
+	}
+
+	for _, index := range CityRankingIndices {
+		aggregates.Indices[index] = newAggregateStats(b.indices[index])
+	}
+	for key, values := range b.costs {
+		aggregates.Costs = append(aggregates.Costs, CostAggregate{
+			Category:       key[0],
+			Param:          key[1],
+			AggregateStats: newAggregateStats(values),
+		})
+	}
+	slices.SortFunc(aggregates.Costs, func(a, b CostAggregate) int {
+		return cmp.Or(cmp.Compare(a.Category, b.Category), cmp.Compare(a.Param, b.Param))
+	})
+
+	return aggregates
+}
+
+// attachCityAggregatesByCodes sets the CityAggregates of every country in
+// countryByCode, including countries without any city data.
+func (c CountryModel) attachCityAggregatesByCodes(ctx context.Context, codes []string, countryByCode map[string]*Country) error {
+	builders := make(map[string]*cityAggregatesBuilder, len(countryByCode))
+	for code := range countryByCode {
+		builders[code] = newCityAggregatesBuilder()
+	}
+
+	err := c.collectCityIndices(ctx, codes, builders)
+	if err != nil {
+		return err
+	}
+	err = c.collectCityCosts(ctx, codes, builders)
+	if err != nil {
+		return err
+	}
+
+	for code, country := range countryByCode {
+		country.CityAggregates = builders[code].build()
+	}
+
+	return nil
+}
+
+func (c CountryModel) collectCityIndices(ctx context.Context, codes []string, builders map[string]*cityAggregatesBuilder) (retErr error) {
+	columns := make([]string, 0, len(CityRankingIndices))
+	for _, index := range CityRankingIndices {
+		columns = append(columns, "nic."+index)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT c.country_code, c.geoname_id, c.population, %s
+		FROM numbeo_city_indices nic
+		JOIN cities c ON c.geoname_id = nic.geoname_id
+		WHERE c.country_code = ANY($1);`,
+		strings.Join(columns, ", "))
+
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	for rows.Next() {
+		var (
+			countryCode string
+			geonameID   int64
+			population  *int64
+		)
+		values := make([]*float64, len(CityRankingIndices))
+		dest := []any{&countryCode, &geonameID, &population}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		builder, ok := builders[countryCode]
+		if !ok {
+			continue
+		}
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			index := CityRankingIndices[i]
+			builder.indices[index] = append(builder.indices[index], cityValue{value: *value, population: population})
+			builder.cities[geonameID] = struct{}{}
+		}
+	}
+
+	return rows.Err()
+}
+
+func (c CountryModel) collectCityCosts(ctx context.Context, codes []string, builders map[string]*cityAggregatesBuilder) (retErr error) {
+	query := `
+		SELECT c.country_code, c.geoname_id, c.population, nc.category, np.param, ns.cost
+		FROM numbeo_city_costs ns
+		JOIN numbeo_cost_params np ON np.param_id = ns.param_id
+		JOIN numbeo_cost_categories nc ON nc.category_id = np.category_id
+		JOIN cities c ON c.geoname_id = ns.geoname_id
+		WHERE c.country_code = ANY($1) AND np.param = ANY($2) AND ns.cost IS NOT NULL;`
+
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(codes), pq.Array(CityAggregateCosts))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	for rows.Next() {
+		var (
+			countryCode     string
+			geonameID       int64
+			population      *int64
+			category, param string
+			cost            float64
+		)
+		if err := rows.Scan(&countryCode, &geonameID, &population, &category, &param, &cost); err != nil {
+			return err
+		}
+
+		builder, ok := builders[countryCode]
+		if !ok {
+			continue
+		}
+		key := [2]string{category, param}
+		builder.costs[key] = append(builder.costs[key], cityValue{value: cost, population: population})
+		builder.cities[geonameID] = struct{}{}
+	}
+
+	return rows.Err()
+}
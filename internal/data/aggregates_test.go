@@ -0,0 +1,50 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+func TestNewAggregateStats(t *testing.T) {
+	population := func(n int64) *int64 { return &n }
+
+	stats := newAggregateStats([]cityValue{
+		{value: 60, population: population(3000000)},
+		{value: 40, population: population(1000000)},
+		{value: 50, population: nil},
+		{value: 30, population: population(0)},
+	})
+	assert.Equal(t, stats.Cities, 4)
+	assert.Equal(t, *stats.WeightedMean, 55.0)
+	assert.Equal(t, *stats.Median, 45.0)
+	assert.Equal(t, *stats.Min, 30.0)
+	assert.Equal(t, *stats.Max, 60.0)
+
+	stats = newAggregateStats([]cityValue{{value: 10}, {value: 20}, {value: 60}})
+	assert.Equal(t, *stats.WeightedMean, 30.0)
+	assert.Equal(t, *stats.Median, 20.0)
+
+	stats = newAggregateStats(nil)
+	assert.Equal(t, stats.Cities, 0)
+	assert.Equal(t, stats.WeightedMean, (*float64)(nil))
+	assert.Equal(t, stats.Median, (*float64)(nil))
+}
+
+func TestCityAggregatesBuilder(t *testing.T) {
+	b := newCityAggregatesBuilder()
+	b.cities[1] = struct{}{}
+	b.cities[2] = struct{}{}
+	b.indices["safety"] = []cityValue{{value: 70}, {value: 50}}
+	b.costs[[2]string{"Restaurants", "Meal, Inexpensive Restaurant"}] = []cityValue{{value: 12}}
+	b.costs[[2]string{"Rent Per Month", "Apartment (1 bedroom) in City Centre"}] = []cityValue{{value: 900}, {value: 1100}}
+
+	aggregates := b.build()
+	assert.Equal(t, aggregates.CityCount, 2)
+	assert.Equal(t, len(aggregates.Indices), len(CityRankingIndices))
+	assert.Equal(t, *aggregates.Indices["safety"].Median, 60.0)
+	assert.Equal(t, aggregates.Indices["pollution"].Cities, 0)
+	assert.Equal(t, len(aggregates.Costs), 2)
+	assert.Equal(t, aggregates.Costs[0].Category, "Rent Per Month")
+	assert.Equal(t, *aggregates.Costs[0].WeightedMean, 1000.0)
+}
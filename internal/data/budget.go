@@ -0,0 +1,284 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+const MaxBudgetItems = 100
+
+// BudgetItem is a Numbeo cost param bought Quantity times a month. Params are
+// matched ignoring case; Category is only needed when a param name is ambiguous.
+type BudgetItem struct {
+	Category string  `json:"category,omitempty"`
+	Param    string  `json:"param"`
+	Quantity float64 `json:"quantity"`
+}
+
+type InputBudget struct {
+	CityIDs  []int64      `json:"city_ids"`
+	Preset   string       `json:"preset"`
+	Items    []BudgetItem `json:"items"`
+	Currency string       `json:"currency"`
+}
+
+// BudgetPresets are monthly baskets for common households.
+var BudgetPresets = map[string][]BudgetItem{
+	"student": {
+		{Param: "Apartment (1 bedroom) Outside of Centre", Quantity: 0.5},
+		{Param: "Basic (Electricity, Heating, Cooling, Water, Garbage) for 85m2 Apartment", Quantity: 0.5},
+		{Param: "Internet (60 Mbps or More, Unlimited Data, Cable/ADSL)", Quantity: 0.5},
+		{Param: "Mobile Phone Monthly Plan with Calls and 10GB+ Data", Quantity: 1},
+		{Param: "Monthly Pass (Regular Price)", Quantity: 1},
+		{Param: "Milk (regular), (1 liter)", Quantity: 8},
+		{Param: "Loaf of Fresh White Bread (500g)", Quantity: 8},
+		{Param: "Eggs (regular) (12)", Quantity: 2},
+		{Param: "Rice (white), (1kg)", Quantity: 2},
+		{Param: "Chicken Fillets (1kg)", Quantity: 2},
+		{Param: "Apples (1kg)", Quantity: 3},
+		{Param: "Potato (1kg)", Quantity: 3},
+		{Param: "Meal, Inexpensive Restaurant", Quantity: 4},
+		{Param: "Cappuccino (regular)", Quantity: 6},
+	},
+	"couple": {
+		{Param: "Apartment (1 bedroom) in City Centre", Quantity: 1},
+		{Param: "Basic (Electricity, Heating, Cooling, Water, Garbage) for 85m2 Apartment", Quantity: 1},
+		{Param: "Internet (60 Mbps or More, Unlimited Data, Cable/ADSL)", Quantity: 1},
+		{Param: "Mobile Phone Monthly Plan with Calls and 10GB+ Data", Quantity: 2},
+		{Param: "Monthly Pass (Regular Price)", Quantity: 2},
+		{Param: "Milk (regular), (1 liter)", Quantity: 16},
+		{Param: "Loaf of Fresh White Bread (500g)", Quantity: 12},
+		{Param: "Eggs (regular) (12)", Quantity: 4},
+		{Param: "Rice (white), (1kg)", Quantity: 3},
+		{Param: "Chicken Fillets (1kg)", Quantity: 4},
+		{Param: "Apples (1kg)", Quantity: 6},
+		{Param: "Potato (1kg)", Quantity: 6},
+		{Param: "Meal for 2 People, Mid-range Restaurant, Three-course", Quantity: 2},
+		{Param: "Fitness Club, Monthly Fee for 1 Adult", Quantity: 2},
+	},
+	"family_of_four": {
+		{Param: "Apartment (3 bedrooms) Outside of Centre", Quantity: 1},
+		{Param: "Basic (Electricity, Heating, Cooling, Water, Garbage) for 85m2 Apartment", Quantity: 1.5},
+		{Param: "Internet (60 Mbps or More, Unlimited Data, Cable/ADSL)", Quantity: 1},
+		{Param: "Mobile Phone Monthly Plan with Calls and 10GB+ Data", Quantity: 2},
+		{Param: "Monthly Pass (Regular Price)", Quantity: 2},
+		{Param: "Milk (regular), (1 liter)", Quantity: 30},
+		{Param: "Loaf of Fresh White Bread (500g)", Quantity: 20},
+		{Param: "Eggs (regular) (12)", Quantity: 6},
+		{Param: "Rice (white), (1kg)", Quantity: 5},
+		{Param: "Chicken Fillets (1kg)", Quantity: 7},
+		{Param: "Apples (1kg)", Quantity: 10},
+		{Param: "Potato (1kg)", Quantity: 10},
+		{Param: "Meal for 2 People, Mid-range Restaurant, Three-course", Quantity: 2},
+		{Param: "Preschool (or Kindergarten), Full Day, Private, Monthly for 1 Child", Quantity: 1},
+	},
+}
+
+// BudgetPresetNames returns the preset names in sorted order.
+func BudgetPresetNames() []string {
+	names := make([]string, 0, len(BudgetPresets))
+	for name := range BudgetPresets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func ValidateInputBudget(v *validator.Validator, input InputBudget, maxCities int) {
+	v.Check(len(input.CityIDs) > 0, "city_ids", "must be provided")
+	v.Check(len(input.CityIDs) <= maxCities, "city_ids", fmt.Sprintf("must not contain more than %d values", maxCities))
+	v.Check(validator.Unique(input.CityIDs), "city_ids", "must not contain duplicate values")
+	for _, id := range input.CityIDs {
+		v.Check(id > 0, "city_ids", "must contain only positive integers")
+	}
+
+	v.Check(input.Preset != "" || len(input.Items) > 0, "items", "must be provided when preset is not set")
+	v.Check(input.Preset == "" || len(input.Items) == 0, "items", "cannot be used together with preset")
+	if input.Preset != "" {
+		_, ok := BudgetPresets[input.Preset]
+		v.Check(ok, "preset", "must be one of "+strings.Join(BudgetPresetNames(), ", "))
+	}
+
+	v.Check(len(input.Items) <= MaxBudgetItems, "items", fmt.Sprintf("must not contain more than %d items", MaxBudgetItems))
+	for _, item := range input.Items {
+		v.Check(strings.TrimSpace(item.Param) != "", "items", "each item must have a param")
+		v.Check(item.Quantity > 0, "items", "each item must have a positive quantity")
+	}
+}
+
+// CityBudget is the monthly cost of a basket in one city. Total prices each
+// item at its average cost, Low and High at the bounds of its price range, or
+// at the average cost when Numbeo has no range. Items the city has no price for
+// are listed in Missing and left out of every total.
+type CityBudget struct {
+	GeonameID   int64        `json:"geoname_id"`
+	Name        string       `json:"city"`
+	CountryCode string       `json:"country_code"`
+	CountryName string       `json:"country"`
+	Currency    string       `json:"currency"`
+	Total       float64      `json:"total"`
+	Low         float64      `json:"low"`
+	High        float64      `json:"high"`
+	Items       []BudgetLine `json:"items"`
+	Missing     []string     `json:"missing"`
+}
+
+type BudgetLine struct {
+	Category string   `json:"category"`
+	Param    string   `json:"param"`
+	Quantity float64  `json:"quantity"`
+	Cost     float64  `json:"cost"`
+	Low      *float64 `json:"low"`
+	High     *float64 `json:"high"`
+	Subtotal float64  `json:"subtotal"`
+}
+
+// NewCityBudget prices items with the numbeo_cost block of city.
+func NewCityBudget(city *City, items []BudgetItem) *CityBudget {
+	budget := &CityBudget{
+		GeonameID:   city.GeonameID,
+		Name:        city.Name,
+		CountryCode: city.CountryCode,
+		CountryName: city.CountryName,
+		Currency:    "USD",
+		Items:       make([]BudgetLine, 0, len(items)),
+		Missing:     []string{},
+	}
+
+	var prices []Price
+	if city.NumbeoCost != nil {
+		budget.Currency = city.NumbeoCost.Currency
+		prices = city.NumbeoCost.Prices
+	}
+
+	for _, item := range items {
+		i := slices.IndexFunc(prices, item.matches)
+		if i == -1 || prices[i].Cost == nil {
+			budget.Missing = append(budget.Missing, item.Param)
+			continue
+		}
+		price := prices[i]
+
+		line := BudgetLine{
+			Category: price.Category,
+			Param:    price.Param,
+			Quantity: item.Quantity,
+			Cost:     *price.Cost,
+			Low:      price.RangeLower,
+			High:     price.RangeUpper,
+			Subtotal: roundCents(*price.Cost * item.Quantity),
+		}
+		budget.Items = append(budget.Items, line)
+
+		budget.Total += *price.Cost * item.Quantity
+		budget.Low += *cmp.Or(price.RangeLower, price.Cost) * item.Quantity
+		budget.High += *cmp.Or(price.RangeUpper, price.Cost) * item.Quantity
+	}
+
+	budget.Total = roundCents(budget.Total)
+	budget.Low = roundCents(budget.Low)
+	budget.High = roundCents(budget.High)
+
+	return budget
+}
+
+func (item BudgetItem) matches(price Price) bool {
+	if item.Category != "" && !strings.EqualFold(item.Category, price.Category) {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(item.Param), price.Param)
+}
+
+func roundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// CostParams returns the (category, param) pairs of the Numbeo cost params
+// that items name, ignoring case and the categories of items.
+func (c CityModel) CostParams(items []BudgetItem) (known []Price, retErr error) {
+	params := make([]string, 0, len(items))
+	for _, item := range items {
+		params = append(params, strings.ToLower(strings.TrimSpace(item.Param)))
+	}
+
+	query := `
+		SELECT np.param, nc.category
+		FROM numbeo_cost_params np
+		JOIN numbeo_cost_categories nc ON nc.category_id = np.category_id
+		WHERE LOWER(np.param) = ANY($1)
+		ORDER BY nc.category;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(params))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	known = []Price{}
+	for rows.Next() {
+		var price Price
+		if err := rows.Scan(&price.Param, &price.Category); err != nil {
+			return nil, err
+		}
+		known = append(known, price)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return known, nil
+}
+
+// UnknownCostParams returns the params of items that match none of known.
+func UnknownCostParams(items []BudgetItem, known []Price) []string {
+	unknown := []string{}
+	for _, item := range items {
+		if !slices.ContainsFunc(known, item.matches) {
+			unknown = append(unknown, item.Param)
+		}
+	}
+	return unknown
+}
+
+// ValidateBudgetItemParams checks items against known, the pairs loaded by
+// CostParams. Every item must name a known param, and an item without a
+// category must name a param that is in a single category, since a budget
+// would otherwise price whichever category comes first.
+func ValidateBudgetItemParams(v *validator.Validator, items []BudgetItem, known []Price) {
+	unknown := UnknownCostParams(items, known)
+	v.Check(len(unknown) == 0, "items", fmt.Sprintf("unknown cost params: %s", strings.Join(unknown, "; ")))
+
+	var ambiguous []string
+	for _, item := range items {
+		if item.Category != "" {
+			continue
+		}
+		var categories []string
+		for _, price := range known {
+			if item.matches(price) && !slices.Contains(categories, price.Category) {
+				categories = append(categories, price.Category)
+			}
+		}
+		if len(categories) > 1 {
+			ambiguous = append(ambiguous, fmt.Sprintf("%s (%s)", item.Param, strings.Join(categories, ", ")))
+		}
+	}
+	v.Check(len(ambiguous) == 0, "items", fmt.Sprintf("cost params in several categories need a category: %s", strings.Join(ambiguous, "; ")))
+}
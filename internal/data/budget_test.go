@@ -0,0 +1,155 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func TestNewCityBudget(t *testing.T) {
+	city := &City{
+		GeonameID: 2950159,
+		Name:      "Berlin",
+		NumbeoCost: &NumbeoCost{Currency: "EUR", Prices: []Price{
+			{Category: "Rent Per Month", Param: "Apartment (1 bedroom) in City Centre", Cost: floatPtr(1200), RangeLower: floatPtr(900), RangeUpper: floatPtr(1600)},
+			{Category: "Markets", Param: "Milk (regular), (1 liter)", Cost: floatPtr(1.1)},
+			{Category: "Markets", Param: "Rice (white), (1kg)", Cost: nil},
+		}},
+	}
+
+	budget := NewCityBudget(city, []BudgetItem{
+		{Param: "apartment (1 bedroom) in city centre", Quantity: 1},
+		{Category: "Markets", Param: "Milk (regular), (1 liter)", Quantity: 12},
+		{Param: "Rice (white), (1kg)", Quantity: 2},
+		{Category: "Restaurants", Param: "Milk (regular), (1 liter)", Quantity: 1},
+	})
+
+	assert.Equal(t, budget.Currency, "EUR")
+	assert.Equal(t, len(budget.Items), 2)
+	assert.Equal(t, budget.Items[1].Subtotal, 13.2)
+	assert.Equal(t, budget.Total, 1213.2)
+	assert.Equal(t, budget.Low, 913.2)
+	assert.Equal(t, budget.High, 1613.2)
+	assert.DeepEqual(t, budget.Missing, []string{"Rice (white), (1kg)", "Milk (regular), (1 liter)"})
+}
+
+func TestNewCityBudgetWithoutCosts(t *testing.T) {
+	budget := NewCityBudget(&City{GeonameID: 1}, BudgetPresets["student"])
+
+	assert.Equal(t, budget.Currency, "USD")
+	assert.Equal(t, budget.Total, 0.0)
+	assert.Equal(t, len(budget.Missing), len(BudgetPresets["student"]))
+}
+
+func TestValidateInputBudget(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      InputBudget
+		wantErrors map[string]string
+	}{
+		{
+			name:       "preset",
+			input:      InputBudget{CityIDs: []int64{1, 2}, Preset: "couple"},
+			wantErrors: map[string]string{},
+		},
+		{
+			name:       "items",
+			input:      InputBudget{CityIDs: []int64{1}, Items: []BudgetItem{{Param: "Milk", Quantity: 12}}},
+			wantErrors: map[string]string{},
+		},
+		{
+			name:       "missing basket",
+			input:      InputBudget{CityIDs: []int64{1}},
+			wantErrors: map[string]string{"items": "must be provided when preset is not set"},
+		},
+		{
+			name:       "preset and items",
+			input:      InputBudget{CityIDs: []int64{1}, Preset: "student", Items: []BudgetItem{{Param: "Milk", Quantity: 1}}},
+			wantErrors: map[string]string{"items": "cannot be used together with preset"},
+		},
+		{
+			name:  "unknown preset and duplicate ids",
+			input: InputBudget{CityIDs: []int64{1, 1}, Preset: "retiree"},
+			wantErrors: map[string]string{
+				"city_ids": "must not contain duplicate values",
+				"preset":   "must be one of couple, family_of_four, student",
+			},
+		},
+		{
+			name:       "invalid quantity",
+			input:      InputBudget{CityIDs: []int64{1}, Items: []BudgetItem{{Param: "Milk", Quantity: 0}}},
+			wantErrors: map[string]string{"items": "each item must have a positive quantity"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateInputBudget(v, tt.input, 20)
+			assert.DeepEqual(t, v.Errors, tt.wantErrors)
+		})
+	}
+}
+
+func TestValidateBudgetItemParams(t *testing.T) {
+	known := []Price{
+		{Category: "Markets", Param: "Milk (regular), (1 liter)"},
+		{Category: "Restaurants", Param: "Milk (regular), (1 liter)"},
+		{Category: "Markets", Param: "Rice (white), (1kg)"},
+	}
+
+	tests := []struct {
+		name       string
+		items      []BudgetItem
+		wantErrors map[string]string
+	}{
+		{
+			name:       "single category",
+			items:      []BudgetItem{{Param: "rice (white), (1kg)", Quantity: 1}},
+			wantErrors: map[string]string{},
+		},
+		{
+			name:       "category picks one",
+			items:      []BudgetItem{{Category: "restaurants", Param: "Milk (regular), (1 liter)", Quantity: 1}},
+			wantErrors: map[string]string{},
+		},
+		{
+			name:       "ambiguous without category",
+			items:      []BudgetItem{{Param: "milk (regular), (1 liter)", Quantity: 1}},
+			wantErrors: map[string]string{"items": "cost params in several categories need a category: milk (regular), (1 liter) (Markets, Restaurants)"},
+		},
+		{
+			name:       "unknown",
+			items:      []BudgetItem{{Param: "Unicorn rides", Quantity: 1}, {Category: "Restaurants", Param: "Rice (white), (1kg)", Quantity: 1}},
+			wantErrors: map[string]string{"items": "unknown cost params: Unicorn rides; Rice (white), (1kg)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateBudgetItemParams(v, tt.items, known)
+			assert.DeepEqual(t, v.Errors, tt.wantErrors)
+		})
+	}
+}
+
+func TestBudgetPresetParams(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	for _, name := range BudgetPresetNames() {
+		t.Run(name, func(t *testing.T) {
+			items := BudgetPresets[name]
+			known, err := models.Cities.CostParams(items)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v := validator.New()
+			ValidateBudgetItemParams(v, items, known)
+			assert.DeepEqual(t, v.Errors, map[string]string{})
+		})
+	}
+}
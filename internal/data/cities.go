@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -15,6 +18,7 @@ type City struct {
 	GeonameID         int64              `json:"geoname_id"`
 	Name              string             `json:"city"`
 	StateCode         *string            `json:"state_code,omitzero"`
+	State             *State             `json:"state,omitzero"`
 	CountryCode       string             `json:"country_code"`
 	CountryName       string             `json:"country"`
 	Population        *int64             `json:"population"`
@@ -25,12 +29,44 @@ type City struct {
 	NumbeoCost        *NumbeoCost        `json:"numbeo_cost,omitzero"`
 	NumbeoCityIndices *NumbeoCityIndices `json:"numbeo_indices,omitzero"`
 	AvgClimate        *AvgClimate        `json:"avg_climate,omitzero"`
+	Time              *LocalTime         `json:"time,omitzero"`
 }
 
 type NumbeoCost struct {
-	Currency   string  `json:"currency"`
-	LastUpdate string  `json:"last_update"`
-	Prices     []Price `json:"prices"`
+	Currency     string        `json:"currency"`
+	LastUpdate   string        `json:"last_update"`
+	ExchangeRate *ExchangeRate `json:"exchange_rate,omitzero"`
+	Prices       []Price       `json:"prices"`
+}
+
+// ExchangeRate describes the rate that was applied to convert Numbeo prices from
+// their stored USD values.
+type ExchangeRate struct {
+	Base      string  `json:"base"`
+	Rate      float64 `json:"rate"`
+	Timestamp int64   `json:"timestamp"`
+	Stale     bool    `json:"stale"`
+}
+
+// ConvertCurrency converts the prices, which are stored in USD, to currency in
+// place. Converted values are rounded to two decimal places.
+func (c *NumbeoCost) ConvertCurrency(currency string, rate ExchangeRate) {
+	convert := func(value *float64) *float64 {
+		if value == nil {
+			return nil
+		}
+		converted := math.Round(*value*rate.Rate*100) / 100
+		return &converted
+	}
+
+	for i := range c.Prices {
+		c.Prices[i].Cost = convert(c.Prices[i].Cost)
+		c.Prices[i].RangeLower = convert(c.Prices[i].RangeLower)
+		c.Prices[i].RangeUpper = convert(c.Prices[i].RangeUpper)
+	}
+
+	c.Currency = currency
+	c.ExchangeRate = &rate
 }
 
 type Price struct {
@@ -99,22 +135,82 @@ type CityModel struct {
 	DB *sql.DB
 }
 
-func (c CityModel) ListCities(countryCode string, include IncludeSet) (cities []*City, retErr error) {
-	query := `
-		SELECT c.geoname_id, c.city, c.state_code, c.country_code,
+var CitySortSafelist = []string{"geoname_id", "name", "population", "-geoname_id", "-name", "-population"}
+
+var cityPage = keysetPage{
+	idColumn: "geoname_id",
+	idType:   "bigint",
+	sortColumns: map[string]keysetColumn{
+		"geoname_id": {expr: "c.geoname_id", sqlType: "bigint"},
+		"name":       {expr: "c.city", sqlType: "text"},
+		"population": {expr: "COALESCE(c.population, -1)", sqlType: "bigint"},
+	},
+}
+
+// cityColumns are the columns of City that come from the cities table, selected
+// from cities c with countries joined as ctr. Queries select their own columns
+// after them and scan with City.scanDest.
+const cityColumns = `c.geoname_id, c.city, c.state_code, c.country_code,
 		       ctr.country AS country, c.population, c.latitude, c.longitude, c.timezone,
-		       to_char(c.updated_date, 'YYYY-MM-DD') AS last_update
+		       to_char(c.updated_date, 'YYYY-MM-DD') AS last_update`
+
+// scanDest returns the scan destinations of cityColumns followed by extra.
+func (city *City) scanDest(extra ...any) []any {
+	return append([]any{
+		&city.GeonameID,
+		&city.Name,
+		&city.StateCode,
+		&city.CountryCode,
+		&city.CountryName,
+		&city.Population,
+		&city.Latitude,
+		&city.Longitude,
+		&city.Timezone,
+		&city.LastUpdate,
+	}, extra...)
+}
+
+type cityPageRow struct {
+	city    *City
+	sortKey string
+}
+
+func (c CityModel) ListCities(filters Filters, include IncludeSet) (cities []*City, metadata Metadata, retErr error) {
+	if filters.Sort == "" {
+		filters.Sort = "geoname_id"
+	}
+
+	where, args := cityFilterClause(filters)
+
+	baseQuery := fmt.Sprintf(`
+		SELECT %s,
+		       st.state_name, st.category AS state_category,
+		       %s AS sort_key
 		FROM cities c
 		LEFT JOIN countries ctr ON ctr.country_code = c.country_code
-		WHERE (LOWER(c.country_code) = LOWER($1) OR $1 = '')
-		ORDER BY c.geoname_id;`
+		LEFT JOIN states st ON st.state_code = c.state_code
+		%s`, cityColumns, cityPage.sortKeyExpr(filters), where)
+
+	query, queryArgs, cursor, err := cityPage.pageQuery(baseQuery, filters, args)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query, countryCode)
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM cities c %s;`, where)
+	err = c.DB.QueryRowContext(ctx, countQuery, args...).Scan(&metadata.TotalCount)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
+	}
+	if metadata.TotalCount == 0 {
+		return nil, Metadata{}, ErrRecordNotFound
+	}
+
+	rows, err := c.DB.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, Metadata{}, err
 	}
 	defer func() {
 		if err := rows.Close(); err != nil && retErr == nil {
@@ -122,53 +218,122 @@ func (c CityModel) ListCities(countryCode string, include IncludeSet) (cities []
 		}
 	}()
 
-	cities = []*City{}
+	pageRows := []cityPageRow{}
 	for rows.Next() {
+		var row cityPageRow
 		var city City
-		if err := rows.Scan(
-			&city.GeonameID,
-			&city.Name,
-			&city.StateCode,
-			&city.CountryCode,
-			&city.CountryName,
-			&city.Population,
-			&city.Latitude,
-			&city.Longitude,
-			&city.Timezone,
-			&city.LastUpdate,
-		); err != nil {
-			return nil, err
+		var stateName, stateCategory *string
+		if err := rows.Scan(city.scanDest(&stateName, &stateCategory, &row.sortKey)...); err != nil {
+			return nil, Metadata{}, err
 		}
-		cities = append(cities, &city)
+		city.attachState(include, stateName, stateCategory)
+		row.city = &city
+		pageRows = append(pageRows, row)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	if len(cities) == 0 {
-		return nil, ErrRecordNotFound
+
+	pageRows, metadata.NextCursor, metadata.PrevCursor = pageBounds(pageRows, filters, cursor, func(row cityPageRow) (*string, string) {
+		return &row.sortKey, strconv.FormatInt(row.city.GeonameID, 10)
+	})
+	metadata.PageSize = filters.PageSize
+
+	cities = make([]*City, 0, len(pageRows))
+	for _, row := range pageRows {
+		cities = append(cities, row.city)
 	}
 
-	return cities, nil
+	return cities, metadata, nil
+}
+
+func cityFilterClause(f Filters) (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+
+	if f.CountryCode != "" {
+		args = append(args, f.CountryCode)
+		conditions = append(conditions, fmt.Sprintf("LOWER(c.country_code) = LOWER($%d)", len(args)))
+	}
+	if f.StateCode != "" {
+		args = append(args, f.StateCode)
+		conditions = append(conditions, fmt.Sprintf("UPPER(c.state_code) = UPPER($%d)", len(args)))
+	}
+	if f.Timezone != "" {
+		args = append(args, likePrefix(f.Timezone))
+		conditions = append(conditions, fmt.Sprintf("c.timezone LIKE $%d", len(args)))
+	}
+	if f.MinPopulation != nil {
+		args = append(args, *f.MinPopulation)
+		conditions = append(conditions, fmt.Sprintf("c.population >= $%d", len(args)))
+	}
+	if f.MaxPopulation != nil {
+		args = append(args, *f.MaxPopulation)
+		conditions = append(conditions, fmt.Sprintf("c.population <= $%d", len(args)))
+	}
+	if f.BBox != nil {
+		args = append(args, f.BBox.MinLat, f.BBox.MaxLat)
+		conditions = append(conditions, fmt.Sprintf("c.latitude BETWEEN $%d AND $%d", len(args)-1, len(args)))
+
+		args = append(args, f.BBox.MinLon, f.BBox.MaxLon)
+		if f.BBox.WrapsLon() {
+			conditions = append(conditions, fmt.Sprintf("(c.longitude >= $%d OR c.longitude <= $%d)", len(args)-1, len(args)))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("c.longitude BETWEEN $%d AND $%d", len(args)-1, len(args)))
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// attachState sets the embedded state block when include has "state" and the
+// city references a known state.
+func (city *City) attachState(include IncludeSet, name, category *string) {
+	if !include.Has("state") || city.StateCode == nil || name == nil {
+		return
+	}
+
+	city.State = &State{Code: *city.StateCode, Name: *name, Category: category}
+}
+
+// likePrefix escapes LIKE wildcards in prefix and appends a trailing %, so that
+// timezone names such as America/Port_of_Spain match literally.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
 }
 
-func (c CityModel) GetCity(id int64, include IncludeSet) (*City, error) {
+// lowerAll lowercases values for matching against LOWER() columns. A nil slice
+// stays nil, so that it reaches queries as NULL.
+func lowerAll(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	lowered := make([]string, 0, len(values))
+	for _, value := range values {
+		lowered = append(lowered, strings.ToLower(value))
+	}
+	return lowered
+}
+
+// GetCity returns the city with the include blocks requested. A non-nil
+// costParams keeps only the numbeo_cost prices with those params, ignoring case.
+func (c CityModel) GetCity(id int64, include IncludeSet, costParams []string) (*City, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
+	query := fmt.Sprintf(`
 		SELECT
-			c.geoname_id,
-			c.city,
-			c.state_code,
-			c.country_code,
-			ctr.country AS country,
-			c.population,
-			c.latitude,
-			c.longitude,
-			c.timezone,
-			to_char(c.updated_date, 'YYYY-MM-DD') AS last_update,
+			%s,
+			st.state_name,
+			st.category AS state_category,
 			CASE
 				WHEN $2 THEN (
 					SELECT CASE
@@ -192,6 +357,7 @@ func (c CityModel) GetCity(id int64, include IncludeSet) (*City, error) {
 					JOIN numbeo_cost_params np ON np.param_id = ns.param_id
 					JOIN numbeo_cost_categories nc ON nc.category_id = np.category_id
 					WHERE ns.geoname_id = c.geoname_id
+					  AND ($5::text[] IS NULL OR LOWER(np.param) = ANY($5))
 				)
 				ELSE NULL
 			END AS numbeo_cost,
@@ -265,13 +431,16 @@ func (c CityModel) GetCity(id int64, include IncludeSet) (*City, error) {
 			END AS avg_climate
 		FROM cities c
 		LEFT JOIN countries ctr ON ctr.country_code = c.country_code
-		WHERE c.geoname_id = $1;`
+		LEFT JOIN states st ON st.state_code = c.state_code
+		WHERE c.geoname_id = $1;`, cityColumns)
 
 	var (
-		city        City
-		costJSON    []byte
-		indicesJSON []byte
-		climateJSON []byte
+		city          City
+		stateName     *string
+		stateCategory *string
+		costJSON      []byte
+		indicesJSON   []byte
+		climateJSON   []byte
 	)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -284,27 +453,15 @@ func (c CityModel) GetCity(id int64, include IncludeSet) (*City, error) {
 		include.Has("numbeo_cost"),
 		include.Has("numbeo_indices"),
 		include.Has("avg_climate"),
-	).Scan(
-		&city.GeonameID,
-		&city.Name,
-		&city.StateCode,
-		&city.CountryCode,
-		&city.CountryName,
-		&city.Population,
-		&city.Latitude,
-		&city.Longitude,
-		&city.Timezone,
-		&city.LastUpdate,
-		&costJSON,
-		&indicesJSON,
-		&climateJSON,
-	)
+		pq.Array(lowerAll(costParams)),
+	).Scan(city.scanDest(&stateName, &stateCategory, &costJSON, &indicesJSON, &climateJSON)...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
 		}
 		return nil, err
 	}
+	city.attachState(include, stateName, stateCategory)
 
 	if len(costJSON) > 0 {
 		var details NumbeoCost
@@ -333,19 +490,20 @@ func (c CityModel) GetCity(id int64, include IncludeSet) (*City, error) {
 	return &city, nil
 }
 
-func (c CityModel) GetCitiesByIDs(ids []int64, include IncludeSet) (cities []*City, retErr error) {
+// GetCitiesByIDs is the batch form of GetCity, ordered by geoname_id.
+func (c CityModel) GetCitiesByIDs(ids []int64, include IncludeSet, costParams []string) (cities []*City, retErr error) {
 	if len(ids) == 0 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
-		SELECT c.geoname_id, c.city, c.state_code, c.country_code,
-		       ctr.country AS country, c.population, c.latitude, c.longitude, c.timezone,
-		       to_char(c.updated_date, 'YYYY-MM-DD') AS last_update
+	query := fmt.Sprintf(`
+		SELECT %s,
+		       st.state_name, st.category AS state_category
 		FROM cities c
 		LEFT JOIN countries ctr ON ctr.country_code = c.country_code
+		LEFT JOIN states st ON st.state_code = c.state_code
 		WHERE c.geoname_id = ANY($1)
-		ORDER BY c.geoname_id;`
+		ORDER BY c.geoname_id;`, cityColumns)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -364,20 +522,11 @@ func (c CityModel) GetCitiesByIDs(ids []int64, include IncludeSet) (cities []*Ci
 	cityByID := make(map[int64]*City, len(ids))
 	for rows.Next() {
 		var city City
-		if err := rows.Scan(
-			&city.GeonameID,
-			&city.Name,
-			&city.StateCode,
-			&city.CountryCode,
-			&city.CountryName,
-			&city.Population,
-			&city.Latitude,
-			&city.Longitude,
-			&city.Timezone,
-			&city.LastUpdate,
-		); err != nil {
+		var stateName, stateCategory *string
+		if err := rows.Scan(city.scanDest(&stateName, &stateCategory)...); err != nil {
 			return nil, err
 		}
+		city.attachState(include, stateName, stateCategory)
 		cityPtr := &city
 		cities = append(cities, cityPtr)
 		cityByID[city.GeonameID] = cityPtr
@@ -391,7 +540,7 @@ func (c CityModel) GetCitiesByIDs(ids []int64, include IncludeSet) (cities []*Ci
 	}
 
 	if include.Has("numbeo_cost") {
-		err = c.attachNumbeoCostByCityIDs(ctx, ids, cityByID)
+		err = c.attachNumbeoCostByCityIDs(ctx, ids, costParams, cityByID)
 		if err != nil {
 			return nil, err
 		}
@@ -414,7 +563,99 @@ func (c CityModel) GetCitiesByIDs(ids []int64, include IncludeSet) (cities []*Ci
 	return cities, nil
 }
 
-func (c CityModel) attachNumbeoCostByCityIDs(ctx context.Context, ids []int64, cityByID map[int64]*City) (retErr error) {
+type NearbyCity struct {
+	City       *City
+	DistanceKm float64
+}
+
+var nearestCityRadiiKm = []float64{50, 250, 1000, 5000, math.Pi * earthRadiusKm}
+
+func (c CityModel) NearbyCities(lat, lon, radiusKm float64, limit int) (cities []*NearbyCity, retErr error) {
+	box := newGeoBox(lat, lon, radiusKm)
+
+	query := fmt.Sprintf(`
+		SELECT %s,
+		       d.distance_km
+		FROM cities c
+		LEFT JOIN countries ctr ON ctr.country_code = c.country_code
+		CROSS JOIN LATERAL (
+			SELECT 2 * $3::double precision * asin(LEAST(1, sqrt(
+				power(sin(radians(c.latitude - $1) / 2), 2) +
+				cos(radians($1)) * cos(radians(c.latitude)) *
+				power(sin(radians(c.longitude - $2) / 2), 2)
+			))) AS distance_km
+		) d
+		WHERE c.latitude BETWEEN $4 AND $5
+		  AND (
+			(NOT $8 AND c.longitude BETWEEN $6 AND $7)
+			OR ($8 AND (c.longitude >= $6 OR c.longitude <= $7))
+		  )
+		  AND d.distance_km <= $9
+		ORDER BY d.distance_km, c.geoname_id
+		LIMIT $10;`, cityColumns)
+
+	args := []any{
+		lat,
+		lon,
+		earthRadiusKm,
+		box.MinLat,
+		box.MaxLat,
+		box.MinLon,
+		box.MaxLon,
+		box.WrapsLon,
+		radiusKm,
+		limit,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	cities = []*NearbyCity{}
+	for rows.Next() {
+		var (
+			city     City
+			distance float64
+		)
+		if err := rows.Scan(city.scanDest(&distance)...); err != nil {
+			return nil, err
+		}
+		cities = append(cities, &NearbyCity{City: &city, DistanceKm: distance})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cities, nil
+}
+
+// NearestCity widens the search radius step by step so that the common case
+// stays within a small bounding box on the coordinates index.
+func (c CityModel) NearestCity(lat, lon float64) (*NearbyCity, error) {
+	for _, radiusKm := range nearestCityRadiiKm {
+		cities, err := c.NearbyCities(lat, lon, radiusKm, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(cities) > 0 {
+			return cities[0], nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (c CityModel) attachNumbeoCostByCityIDs(ctx context.Context, ids []int64, costParams []string, cityByID map[int64]*City) (retErr error) {
 	query := `
 		SELECT
 			ns.geoname_id,
@@ -436,9 +677,10 @@ func (c CityModel) attachNumbeoCostByCityIDs(ctx context.Context, ids []int64, c
 		JOIN numbeo_cost_params np ON np.param_id = ns.param_id
 		JOIN numbeo_cost_categories nc ON nc.category_id = np.category_id
 		WHERE ns.geoname_id = ANY($1)
+		  AND ($2::text[] IS NULL OR LOWER(np.param) = ANY($2))
 		GROUP BY ns.geoname_id;`
 
-	rows, err := c.DB.QueryContext(ctx, query, pq.Array(ids))
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(ids), pq.Array(lowerAll(costParams)))
 	if err != nil {
 		return err
 	}
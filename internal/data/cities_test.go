@@ -2,6 +2,8 @@ package data
 
 import (
 	"database/sql"
+	"slices"
+	"strings"
 	"testing"
 
 	_ "github.com/lib/pq"
@@ -13,12 +15,14 @@ func TestListCities(t *testing.T) {
 	db := newTestDB(t)
 	models := NewModels(db)
 
-	cities, err := models.Cities.ListCities("", NewIncludeSet())
+	cities, metadata, err := models.Cities.ListCities(Filters{Sort: "geoname_id"}, NewIncludeSet())
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	assert.Equal(t, len(cities), 527)
+	assert.Equal(t, metadata.TotalCount, 527)
+	assert.Equal(t, metadata.NextCursor, "")
 	assert.Equal(t, len(cities) > 0, true)
 	assert.Equal(t, cities[0].GeonameID > 0, true)
 	assert.Equal(t, cities[0].Name != "", true)
@@ -34,7 +38,7 @@ func TestListCitiesWithCountryInclude(t *testing.T) {
 	db := newTestDB(t)
 	models := NewModels(db)
 
-	cities, err := models.Cities.ListCities("USA", NewIncludeSet("country"))
+	cities, _, err := models.Cities.ListCities(Filters{CountryCode: "USA", Sort: "geoname_id"}, NewIncludeSet("country"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -43,11 +47,145 @@ func TestListCitiesWithCountryInclude(t *testing.T) {
 	assert.Equal(t, cities[0].CountryName != "", true)
 }
 
+func TestListCitiesPagination(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	filters := Filters{PageSize: 200, Sort: "-population", SortSafelist: CitySortSafelist}
+	seen := map[int64]bool{}
+	var last *City
+	pages := 0
+
+	for {
+		cities, metadata, err := models.Cities.ListCities(filters, NewIncludeSet())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+
+		assert.Equal(t, metadata.TotalCount, 527)
+		for _, city := range cities {
+			assert.Equal(t, seen[city.GeonameID], false)
+			seen[city.GeonameID] = true
+			if last != nil && last.Population != nil && city.Population != nil {
+				assert.Equal(t, *last.Population >= *city.Population, true)
+			}
+			last = city
+		}
+
+		if metadata.NextCursor == "" {
+			break
+		}
+		filters.Cursor = metadata.NextCursor
+	}
+
+	assert.Equal(t, pages, 3)
+	assert.Equal(t, len(seen), 527)
+}
+
+func TestListCitiesPaginationBackward(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	first, metadata, err := models.Cities.ListCities(Filters{PageSize: 10, Sort: "name"}, NewIncludeSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, metadata.PrevCursor, "")
+
+	_, metadata, err = models.Cities.ListCities(Filters{PageSize: 10, Sort: "name", Cursor: metadata.NextCursor}, NewIncludeSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	back, _, err := models.Cities.ListCities(Filters{PageSize: 10, Sort: "name", Cursor: metadata.PrevCursor}, NewIncludeSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(back), len(first))
+	for i := range first {
+		assert.Equal(t, back[i].GeonameID, first[i].GeonameID)
+	}
+}
+
+func TestListCitiesAttributeFilters(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	minPopulation := int64(500000)
+	cities, _, err := models.Cities.ListCities(Filters{Timezone: "Europe/", MinPopulation: &minPopulation}, NewIncludeSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(cities) > 0, true)
+	for _, city := range cities {
+		assert.Equal(t, strings.HasPrefix(city.Timezone, "Europe/"), true)
+		assert.Equal(t, *city.Population >= minPopulation, true)
+	}
+
+	bbox := &BoundingBox{MinLon: 139, MinLat: 35, MaxLon: 140, MaxLat: 36}
+	cities, _, err = models.Cities.ListCities(Filters{BBox: bbox}, NewIncludeSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(cities) > 0, true)
+	for _, city := range cities {
+		assert.Equal(t, city.Latitude >= 35 && city.Latitude <= 36, true)
+		assert.Equal(t, city.Longitude >= 139 && city.Longitude <= 140, true)
+	}
+
+	_, _, err = models.Cities.ListCities(Filters{Timezone: "Mars/"}, NewIncludeSet())
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestGetCityWithStateInclude(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	city, err := models.Cities.GetCity(5128581, NewIncludeSet("state"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, city.State != nil, true)
+	assert.Equal(t, city.State.Code, *city.StateCode)
+	assert.Equal(t, city.State.Name != "", true)
+
+	city, err = models.Cities.GetCity(5128581, NewIncludeSet(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, city.State == nil, true)
+}
+
+func TestNumbeoCostConvertCurrency(t *testing.T) {
+	cost, lower := 10.0, 7.5
+	numbeoCost := &NumbeoCost{
+		Currency: "USD",
+		Prices: []Price{
+			{Category: "Restaurants", Param: "Meal", Cost: &cost, RangeLower: &lower},
+		},
+	}
+
+	numbeoCost.ConvertCurrency("EUR", ExchangeRate{Base: "USD", Rate: 0.9234, Timestamp: 1700000000, Stale: true})
+
+	assert.Equal(t, numbeoCost.Currency, "EUR")
+	assert.Equal(t, *numbeoCost.Prices[0].Cost, 9.23)
+	assert.Equal(t, *numbeoCost.Prices[0].RangeLower, 6.93)
+	assert.Equal(t, numbeoCost.Prices[0].RangeUpper == nil, true)
+	assert.Equal(t, numbeoCost.ExchangeRate.Stale, true)
+	assert.Equal(t, cost, 10.0)
+}
+
 func TestGetCity(t *testing.T) {
 	db := newTestDB(t)
 	models := NewModels(db)
 
-	city, err := models.Cities.GetCity(1850147, NewIncludeSet("country", "numbeo_cost", "numbeo_indices", "avg_climate"))
+	city, err := models.Cities.GetCity(1850147, NewIncludeSet("country", "numbeo_cost", "numbeo_indices", "avg_climate"), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -62,11 +200,40 @@ func TestGetCity(t *testing.T) {
 	assert.Equal(t, city.NumbeoCityIndices != nil, true)
 }
 
+func TestGetCityCostParams(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	params := []string{"MILK (REGULAR), (1 LITER)", "Monthly Pass (Regular Price)"}
+	city, err := models.Cities.GetCity(1850147, NewIncludeSet("numbeo_cost"), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, city.NumbeoCost != nil, true)
+	assert.Equal(t, len(city.NumbeoCost.Prices), 2)
+	for _, price := range city.NumbeoCost.Prices {
+		assert.Equal(t, slices.Contains([]string{"Milk (regular), (1 liter)", "Monthly Pass (Regular Price)"}, price.Param), true)
+	}
+
+	cities, err := models.Cities.GetCitiesByIDs([]int64{1850147, 5128581}, NewIncludeSet("numbeo_cost"), params[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(cities), 2)
+	for _, city := range cities {
+		assert.Equal(t, city.NumbeoCost != nil, true)
+		assert.Equal(t, len(city.NumbeoCost.Prices), 1)
+		assert.Equal(t, city.NumbeoCost.Prices[0].Param, "Milk (regular), (1 liter)")
+	}
+}
+
 func TestGetCitiesByIDs(t *testing.T) {
 	db := newTestDB(t)
 	models := NewModels(db)
 
-	cities, err := models.Cities.GetCitiesByIDs([]int64{5128581, 6167865, 5128581}, NewIncludeSet("country"))
+	cities, err := models.Cities.GetCitiesByIDs([]int64{5128581, 6167865, 5128581}, NewIncludeSet("country"), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -95,7 +262,7 @@ func TestGetCityAvgClimateOrderedByMonth(t *testing.T) {
 	}
 	t.Logf("testing geonameid=%d", geonameID)
 
-	city, err := models.Cities.GetCity(geonameID, NewIncludeSet("avg_climate"))
+	city, err := models.Cities.GetCity(geonameID, NewIncludeSet("avg_climate"), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -160,7 +327,7 @@ func TestGetCityAvgClimateSeaTempAllNull(t *testing.T) {
 	}
 	t.Logf("testing geonameid=%d", geonameID)
 
-	city, err := models.Cities.GetCity(geonameID, NewIncludeSet("avg_climate"))
+	city, err := models.Cities.GetCity(geonameID, NewIncludeSet("avg_climate"), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -185,3 +352,95 @@ func equalFloatPtrs(a, b *float64) bool {
 	}
 	return *a == *b
 }
+
+func TestNearbyCities(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	// Coordinates of Tokyo.
+	cities, err := models.Cities.NearbyCities(35.6895, 139.69171, 50, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(cities) > 0, true)
+	assert.Equal(t, cities[0].City.GeonameID, int64(1850147))
+	assert.Equal(t, cities[0].DistanceKm < 0.01, true)
+	for i := 1; i < len(cities); i++ {
+		assert.Equal(t, cities[i-1].DistanceKm <= cities[i].DistanceKm, true)
+		assert.Equal(t, cities[i].DistanceKm <= 50, true)
+	}
+}
+
+func TestNearestCity(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	// A point in the Pacific far from any city still resolves to the nearest one.
+	city, err := models.Cities.NearestCity(0, -150)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, city.City.GeonameID > 0, true)
+	assert.Equal(t, city.DistanceKm > 250, true)
+}
+
+func TestSimilarCities(t *testing.T) {
+	db := newTestDB(t)
+	cities := CityModel{DB: db}
+
+	err := cities.RefreshFeatures()
+	assert.NilError(t, err)
+
+	similar, err := cities.SimilarCities(1850147, SimilarityFilters{Limit: 10})
+	assert.NilError(t, err)
+	assert.Equal(t, len(similar) <= 10, true)
+	for i, city := range similar {
+		assert.Equal(t, city.GeonameID != 1850147, true)
+		if i > 0 {
+			assert.Equal(t, similar[i-1].Distance <= city.Distance, true)
+		}
+	}
+
+	_, err = cities.SimilarCities(777, SimilarityFilters{Limit: 10})
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestListCitiesByCountries(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	citiesByCode, err := models.Cities.ListCitiesByCountries([]string{"USA", "RUS"}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for code, cities := range citiesByCode {
+		assert.Equal(t, len(cities) <= 3, true)
+		for i, city := range cities {
+			assert.Equal(t, city.CountryCode, code)
+			assert.Equal(t, city.CountryName != "", true)
+			if i > 0 && cities[i-1].Population != nil && city.Population != nil {
+				assert.Equal(t, *cities[i-1].Population >= *city.Population, true)
+			}
+		}
+	}
+}
+
+func TestSummarizeCitiesByCountries(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	summaries, err := models.Cities.SummarizeCitiesByCountries([]string{"USA", "RUS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, summary := range summaries {
+		assert.Equal(t, summary.CityCount > 0, true)
+		assert.Equal(t, summary.Coverage.NumbeoCost <= summary.CityCount, true)
+		assert.Equal(t, summary.Coverage.NumbeoIndices <= summary.CityCount, true)
+		assert.Equal(t, summary.Coverage.AvgClimate <= summary.CityCount, true)
+	}
+}
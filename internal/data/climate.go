@@ -0,0 +1,316 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+// ClimateMetrics lists the avg_climate series in their canonical order.
+var ClimateMetrics = []string{
+	"high_temp",
+	"low_temp",
+	"pressure",
+	"wind_speed",
+	"humidity",
+	"rainfall",
+	"rainfall_days",
+	"snowfall",
+	"snowfall_days",
+	"sea_temp",
+	"daylight",
+	"sunshine",
+	"sunshine_days",
+	"uv_index",
+	"cloud_cover",
+	"visibility",
+}
+
+type CityClimate struct {
+	GeonameID int64                    `json:"geoname_id"`
+	Name      string                   `json:"city"`
+	Months    []int                    `json:"months"`
+	Metrics   map[string]ClimateMetric `json:"metrics"`
+}
+
+// ClimateMetric holds the values for the selected months, in the order of
+// CityClimate.Months, and a summary over the whole year.
+type ClimateMetric struct {
+	Values []*float64     `json:"values"`
+	Annual ClimateSummary `json:"annual"`
+}
+
+type ClimateSummary struct {
+	Min  *float64 `json:"min"`
+	Max  *float64 `json:"max"`
+	Mean *float64 `json:"mean"`
+}
+
+// Series returns the monthly values of metric, or false if metric is unknown.
+func (a *AvgClimate) Series(metric string) ([12]*float64, bool) {
+	switch metric {
+	case "high_temp":
+		return a.HighTemp, true
+	case "low_temp":
+		return a.LowTemp, true
+	case "pressure":
+		return a.Pressure, true
+	case "wind_speed":
+		return a.WindSpeed, true
+	case "humidity":
+		return a.Humidity, true
+	case "rainfall":
+		return a.Rainfall, true
+	case "rainfall_days":
+		return a.RainfallDays, true
+	case "snowfall":
+		return a.Snowfall, true
+	case "snowfall_days":
+		return a.SnowfallDays, true
+	case "sea_temp":
+		return a.SeaTemp, true
+	case "daylight":
+		return a.Daylight, true
+	case "sunshine":
+		return a.Sunshine, true
+	case "sunshine_days":
+		return a.SunshineDays, true
+	case "uv_index":
+		return a.UVIndex, true
+	case "cloud_cover":
+		return a.CloudCover, true
+	case "visibility":
+		return a.Visibility, true
+	default:
+		return [12]*float64{}, false
+	}
+}
+
+// NewCityClimate slices the climate of city to months (1-12) and metrics. Unknown
+// metrics are skipped.
+func NewCityClimate(city *City, months []int, metrics IncludeSet) *CityClimate {
+	climate := &CityClimate{
+		GeonameID: city.GeonameID,
+		Name:      city.Name,
+		Months:    months,
+		Metrics:   make(map[string]ClimateMetric, len(metrics)),
+	}
+	if city.AvgClimate == nil {
+		return climate
+	}
+
+	for _, metric := range ClimateMetrics {
+		if !metrics.Has(metric) {
+			continue
+		}
+		series, _ := city.AvgClimate.Series(metric)
+
+		values := make([]*float64, 0, len(months))
+		for _, month := range months {
+			values = append(values, series[month-1])
+		}
+
+		climate.Metrics[metric] = ClimateMetric{
+			Values: values,
+			Annual: summarizeClimateSeries(series),
+		}
+	}
+
+	return climate
+}
+
+func summarizeClimateSeries(series [12]*float64) ClimateSummary {
+	values := make([]float64, 0, len(series))
+	for _, value := range series {
+		if value != nil {
+			values = append(values, *value)
+		}
+	}
+	if len(values) == 0 {
+		return ClimateSummary{}
+	}
+
+	minValue, maxValue := slices.Min(values), slices.Max(values)
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	mean := math.Round(sum/float64(len(values))*100) / 100
+
+	return ClimateSummary{Min: &minValue, Max: &maxValue, Mean: &mean}
+}
+
+const MaxClimateConstraints = 10
+
+// ClimateConstraint requires metric to stay within [Min, Max] in every month of
+// Months. A nil bound is open.
+type ClimateConstraint struct {
+	Metric string
+	Months []int
+	Min    *float64
+	Max    *float64
+}
+
+type ClimateMatch struct {
+	GeonameID   int64                    `json:"geoname_id"`
+	Name        string                   `json:"city"`
+	CountryCode string                   `json:"country_code"`
+	CountryName string                   `json:"country"`
+	Population  *int64                   `json:"population"`
+	Matches     []ClimateConstraintMatch `json:"matches"`
+}
+
+// ClimateConstraintMatch reports the values that satisfied a constraint, in the
+// order of Months.
+type ClimateConstraintMatch struct {
+	Metric string     `json:"metric"`
+	Months []int      `json:"months"`
+	Values []*float64 `json:"values"`
+}
+
+func ValidateClimateConstraints(v *validator.Validator, constraints []ClimateConstraint) {
+	v.Check(len(constraints) > 0, "where", "must be provided")
+	v.Check(len(constraints) <= MaxClimateConstraints, "where", fmt.Sprintf("must not contain more than %d constraints", MaxClimateConstraints))
+
+	for _, c := range constraints {
+		v.Check(slices.Contains(ClimateMetrics, c.Metric), "where", fmt.Sprintf("unsupported metric %q", c.Metric))
+		v.Check(len(c.Months) > 0, "where", "each constraint must select at least one month")
+		for _, month := range c.Months {
+			v.Check(month >= 1 && month <= 12, "where", "months must be between 1 and 12")
+		}
+		v.Check(c.Min != nil || c.Max != nil, "where", "each constraint must have a lower or upper bound")
+		if c.Min != nil && c.Max != nil {
+			v.Check(*c.Min <= *c.Max, "where", "lower bound must not be greater than upper bound")
+		}
+	}
+}
+
+// SearchByClimate returns up to limit cities, most populous first, whose climate
+// satisfies every constraint.
+func (c CityModel) SearchByClimate(constraints []ClimateConstraint, limit int) (matches []*ClimateMatch, retErr error) {
+	var (
+		conditions []string
+		args       []any
+	)
+
+	for _, constraint := range constraints {
+		// Only metric names from ClimateMetrics are used as column names.
+		if !slices.Contains(ClimateMetrics, constraint.Metric) {
+			return nil, fmt.Errorf("unsupported climate metric %q", constraint.Metric)
+		}
+		column := "ac." + constraint.Metric
+		monthArgs := make([]int64, 0, len(constraint.Months))
+		for _, month := range constraint.Months {
+			monthArgs = append(monthArgs, int64(month))
+		}
+
+		args = append(args, pq.Array(monthArgs))
+		condition := fmt.Sprintf("ac.month = ANY($%d) AND %s IS NOT NULL", len(args), column)
+		if constraint.Min != nil {
+			args = append(args, *constraint.Min)
+			condition += fmt.Sprintf(" AND %s >= $%d", column, len(args))
+		}
+		if constraint.Max != nil {
+			args = append(args, *constraint.Max)
+			condition += fmt.Sprintf(" AND %s <= $%d", column, len(args))
+		}
+
+		args = append(args, len(monthArgs))
+		conditions = append(conditions, fmt.Sprintf(
+			"(SELECT COUNT(*) FROM avg_climate ac WHERE ac.geoname_id = c.geoname_id AND %s) = $%d",
+			condition, len(args),
+		))
+	}
+
+	args = append(args, limit)
+	query := fmt.Sprintf(`
+		SELECT c.geoname_id
+		FROM cities c
+		WHERE %s
+		ORDER BY c.population DESC NULLS LAST, c.geoname_id
+		LIMIT $%d;`, strings.Join(conditions, "\n\t\t  AND "), len(args))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*ClimateMatch{}, nil
+	}
+
+	cities, err := c.GetCitiesByIDs(ids, NewIncludeSet("avg_climate"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	cityByID := make(map[int64]*City, len(cities))
+	for _, city := range cities {
+		cityByID[city.GeonameID] = city
+	}
+
+	matches = make([]*ClimateMatch, 0, len(ids))
+	for _, id := range ids {
+		city, ok := cityByID[id]
+		if !ok || city.AvgClimate == nil {
+			continue
+		}
+		matches = append(matches, newClimateMatch(city, constraints))
+	}
+
+	return matches, nil
+}
+
+func newClimateMatch(city *City, constraints []ClimateConstraint) *ClimateMatch {
+	match := &ClimateMatch{
+		GeonameID:   city.GeonameID,
+		Name:        city.Name,
+		CountryCode: city.CountryCode,
+		CountryName: city.CountryName,
+		Population:  city.Population,
+		Matches:     make([]ClimateConstraintMatch, 0, len(constraints)),
+	}
+
+	for _, constraint := range constraints {
+		series, _ := city.AvgClimate.Series(constraint.Metric)
+		values := make([]*float64, 0, len(constraint.Months))
+		for _, month := range constraint.Months {
+			values = append(values, series[month-1])
+		}
+
+		match.Matches = append(match.Matches, ClimateConstraintMatch{
+			Metric: constraint.Metric,
+			Months: constraint.Months,
+			Values: values,
+		})
+	}
+
+	return match
+}
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func TestNewCityClimate(t *testing.T) {
+	var highTemp, rainfall [12]*float64
+	for i := range highTemp {
+		high := float64(i + 1)
+		highTemp[i] = &high
+	}
+	rain := 40.0
+	rainfall[6] = &rain
+
+	city := &City{
+		GeonameID:  1850147,
+		Name:       "Tokyo",
+		AvgClimate: &AvgClimate{HighTemp: highTemp, Rainfall: rainfall},
+	}
+
+	climate := NewCityClimate(city, []int{12, 1, 7}, NewIncludeSet("high_temp", "rainfall", "tides"))
+
+	assert.Equal(t, climate.GeonameID, int64(1850147))
+	assert.DeepEqual(t, climate.Months, []int{12, 1, 7})
+	assert.Equal(t, len(climate.Metrics), 2)
+
+	high := climate.Metrics["high_temp"]
+	assert.Equal(t, *high.Values[0], 12.0)
+	assert.Equal(t, *high.Values[1], 1.0)
+	assert.Equal(t, *high.Values[2], 7.0)
+	assert.Equal(t, *high.Annual.Min, 1.0)
+	assert.Equal(t, *high.Annual.Max, 12.0)
+	assert.Equal(t, *high.Annual.Mean, 6.5)
+
+	rainfallMetric := climate.Metrics["rainfall"]
+	assert.Equal(t, rainfallMetric.Values[0] == nil, true)
+	assert.Equal(t, *rainfallMetric.Values[2], 40.0)
+	assert.Equal(t, *rainfallMetric.Annual.Mean, 40.0)
+}
+
+func TestNewCityClimateWithoutData(t *testing.T) {
+	climate := NewCityClimate(&City{GeonameID: 1}, []int{1}, NewIncludeSet("high_temp"))
+
+	assert.Equal(t, len(climate.Metrics), 0)
+}
+
+func TestAvgClimateSeriesCoversMetrics(t *testing.T) {
+	climate := &AvgClimate{}
+	for _, metric := range ClimateMetrics {
+		_, ok := climate.Series(metric)
+		assert.Equal(t, ok, true)
+	}
+
+	_, ok := climate.Series("tides")
+	assert.Equal(t, ok, false)
+}
+
+func TestValidateClimateConstraints(t *testing.T) {
+	low, high := 22.0, 27.0
+
+	v := validator.New()
+	ValidateClimateConstraints(v, []ClimateConstraint{{Metric: "high_temp", Months: []int{7}, Min: &low, Max: &high}})
+	assert.Equal(t, v.Valid(), true)
+
+	v = validator.New()
+	ValidateClimateConstraints(v, nil)
+	assert.DeepEqual(t, v.Errors, map[string]string{"where": "must be provided"})
+
+	v = validator.New()
+	ValidateClimateConstraints(v, []ClimateConstraint{{Metric: "tides", Months: []int{7}, Max: &high}})
+	assert.DeepEqual(t, v.Errors, map[string]string{"where": `unsupported metric "tides"`})
+
+	v = validator.New()
+	ValidateClimateConstraints(v, []ClimateConstraint{{Metric: "high_temp", Months: []int{7}}})
+	assert.DeepEqual(t, v.Errors, map[string]string{"where": "each constraint must have a lower or upper bound"})
+
+	v = validator.New()
+	ValidateClimateConstraints(v, []ClimateConstraint{{Metric: "high_temp", Months: []int{7}, Min: &high, Max: &low}})
+	assert.DeepEqual(t, v.Errors, map[string]string{"where": "lower bound must not be greater than upper bound"})
+}
+
+func TestSearchByClimate(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	low, high, rainDays := 22.0, 27.0, 8.0
+	constraints := []ClimateConstraint{
+		{Metric: "high_temp", Months: []int{7}, Min: &low, Max: &high},
+		{Metric: "rainfall_days", Months: []int{6, 7, 8}, Max: &rainDays},
+	}
+
+	matches, err := models.Cities.SearchByClimate(constraints, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, match := range matches {
+		assert.Equal(t, len(match.Matches), 2)
+		july := *match.Matches[0].Values[0]
+		assert.Equal(t, july >= low && july <= high, true)
+		for _, value := range match.Matches[1].Values {
+			assert.Equal(t, *value <= rainDays, true)
+		}
+	}
+
+	_, err = models.Cities.SearchByClimate([]ClimateConstraint{{Metric: "high_temp; DROP TABLE cities", Months: []int{1}, Max: &high}}, 1)
+	assert.Equal(t, err != nil, true)
+}
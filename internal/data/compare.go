@@ -0,0 +1,190 @@
+package data
+
+import "math"
+
+// CityComparison holds the differences between each compared city and the base
+// city. Costs are in Currency.
+type CityComparison struct {
+	Base     ComparedCityRef `json:"base"`
+	Currency string          `json:"currency"`
+	Cities   []*CityDeltas   `json:"cities"`
+}
+
+type ComparedCityRef struct {
+	GeonameID   int64  `json:"geoname_id"`
+	Name        string `json:"city"`
+	CountryCode string `json:"country_code"`
+	CountryName string `json:"country"`
+}
+
+type CityDeltas struct {
+	ComparedCityRef
+	Costs   []CostDelta  `json:"costs"`
+	Indices []IndexDelta `json:"indices"`
+}
+
+// Delta compares Value against BaseValue. Difference is nil when either value is
+// missing, and PercentDifference is also nil when BaseValue is zero.
+type Delta struct {
+	Value             *float64 `json:"value"`
+	BaseValue         *float64 `json:"base_value"`
+	Difference        *float64 `json:"difference"`
+	PercentDifference *float64 `json:"percent_difference"`
+}
+
+type CostDelta struct {
+	Category string `json:"category"`
+	Param    string `json:"param"`
+	Delta
+}
+
+type IndexDelta struct {
+	Index string `json:"index"`
+	Delta
+}
+
+// Index returns the value of the named index, or false if name is unknown.
+func (n *NumbeoCityIndices) Index(name string) (*float64, bool) {
+	switch name {
+	case "cost_of_living":
+		return n.CostOfLiving, true
+	case "rent":
+		return n.Rent, true
+	case "cost_of_living_plus_rent":
+		return n.CostOfLivingPlusRent, true
+	case "groceries":
+		return n.Groceries, true
+	case "local_purchasing_power":
+		return n.LocalPurchasingPower, true
+	case "quality_of_life":
+		return n.QualityOfLife, true
+	case "property_price_to_income_ratio":
+		return n.PropertyPriceToIncomeRatio, true
+	case "traffic_commute_time":
+		return n.TrafficCommuteTime, true
+	case "climate":
+		return n.Climate, true
+	case "safety":
+		return n.Safety, true
+	case "health_care":
+		return n.HealthCare, true
+	case "pollution":
+		return n.Pollution, true
+	default:
+		return nil, false
+	}
+}
+
+// NewCityComparison compares cities against base. Both are expected to carry
+// their numbeo_cost and numbeo_indices blocks in the same currency. currency is
+// the currency the costs were converted to; when it is empty the currency of
+// the base costs is reported.
+func NewCityComparison(base *City, cities []*City, currency string) *CityComparison {
+	comparison := &CityComparison{
+		Base:     newComparedCityRef(base),
+		Currency: "USD",
+		Cities:   make([]*CityDeltas, 0, len(cities)),
+	}
+	switch {
+	case currency != "":
+		comparison.Currency = currency
+	case base.NumbeoCost != nil:
+		comparison.Currency = base.NumbeoCost.Currency
+	}
+
+	for _, city := range cities {
+		comparison.Cities = append(comparison.Cities, &CityDeltas{
+			ComparedCityRef: newComparedCityRef(city),
+			Costs:           compareCosts(base.NumbeoCost, city.NumbeoCost),
+			Indices:         compareIndices(base.NumbeoCityIndices, city.NumbeoCityIndices),
+		})
+	}
+
+	return comparison
+}
+
+func newComparedCityRef(city *City) ComparedCityRef {
+	return ComparedCityRef{
+		GeonameID:   city.GeonameID,
+		Name:        city.Name,
+		CountryCode: city.CountryCode,
+		CountryName: city.CountryName,
+	}
+}
+
+// compareCosts lists the params of base in their stored order, followed by the
+// params that only city has.
+func compareCosts(base, city *NumbeoCost) []CostDelta {
+	type key struct{ category, param string }
+
+	var basePrices, cityPrices []Price
+	if base != nil {
+		basePrices = base.Prices
+	}
+	if city != nil {
+		cityPrices = city.Prices
+	}
+
+	cityCosts := make(map[key]*float64, len(cityPrices))
+	for _, price := range cityPrices {
+		cityCosts[key{price.Category, price.Param}] = price.Cost
+	}
+
+	deltas := make([]CostDelta, 0, len(basePrices))
+	seen := make(map[key]struct{}, len(basePrices))
+	for _, price := range basePrices {
+		k := key{price.Category, price.Param}
+		seen[k] = struct{}{}
+		deltas = append(deltas, CostDelta{
+			Category: price.Category,
+			Param:    price.Param,
+			Delta:    newDelta(cityCosts[k], price.Cost),
+		})
+	}
+	for _, price := range cityPrices {
+		if _, ok := seen[key{price.Category, price.Param}]; ok {
+			continue
+		}
+		deltas = append(deltas, CostDelta{
+			Category: price.Category,
+			Param:    price.Param,
+			Delta:    newDelta(price.Cost, nil),
+		})
+	}
+
+	return deltas
+}
+
+func compareIndices(base, city *NumbeoCityIndices) []IndexDelta {
+	if base == nil {
+		base = &NumbeoCityIndices{}
+	}
+	if city == nil {
+		city = &NumbeoCityIndices{}
+	}
+
+	deltas := make([]IndexDelta, 0, len(CityRankingIndices))
+	for _, name := range CityRankingIndices {
+		baseValue, _ := base.Index(name)
+		value, _ := city.Index(name)
+		deltas = append(deltas, IndexDelta{Index: name, Delta: newDelta(value, baseValue)})
+	}
+
+	return deltas
+}
+
+func newDelta(value, baseValue *float64) Delta {
+	delta := Delta{Value: value, BaseValue: baseValue}
+	if value == nil || baseValue == nil {
+		return delta
+	}
+
+	difference := math.Round((*value-*baseValue)*100) / 100
+	delta.Difference = &difference
+	if *baseValue != 0 {
+		percent := math.Round((*value-*baseValue) / *baseValue * 10000) / 100
+		delta.PercentDifference = &percent
+	}
+
+	return delta
+}
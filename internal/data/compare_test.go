@@ -0,0 +1,87 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestNewCityComparison(t *testing.T) {
+	base := &City{
+		GeonameID: 1,
+		Name:      "Berlin",
+		NumbeoCost: &NumbeoCost{Currency: "EUR", Prices: []Price{
+			{Category: "Markets", Param: "Milk", Cost: floatPtr(1.0)},
+			{Category: "Markets", Param: "Eggs", Cost: floatPtr(0)},
+			{Category: "Markets", Param: "Rice", Cost: nil},
+		}},
+		NumbeoCityIndices: &NumbeoCityIndices{Safety: floatPtr(60), Rent: floatPtr(40)},
+	}
+	city := &City{
+		GeonameID: 2,
+		Name:      "Munich",
+		NumbeoCost: &NumbeoCost{Currency: "EUR", Prices: []Price{
+			{Category: "Markets", Param: "Eggs", Cost: floatPtr(2.5)},
+			{Category: "Markets", Param: "Milk", Cost: floatPtr(1.25)},
+			{Category: "Markets", Param: "Bread", Cost: floatPtr(3)},
+		}},
+		NumbeoCityIndices: &NumbeoCityIndices{Safety: floatPtr(75)},
+	}
+
+	comparison := NewCityComparison(base, []*City{city}, "")
+
+	assert.Equal(t, comparison.Base.Name, "Berlin")
+	assert.Equal(t, comparison.Currency, "EUR")
+	assert.Equal(t, len(comparison.Cities), 1)
+
+	costs := comparison.Cities[0].Costs
+	assert.Equal(t, len(costs), 4)
+	assert.Equal(t, costs[0].Param, "Milk")
+	assert.Equal(t, *costs[0].Difference, 0.25)
+	assert.Equal(t, *costs[0].PercentDifference, 25.0)
+	assert.Equal(t, costs[1].Param, "Eggs")
+	assert.Equal(t, *costs[1].Difference, 2.5)
+	assert.Equal(t, costs[1].PercentDifference == nil, true)
+	assert.Equal(t, costs[2].Param, "Rice")
+	assert.Equal(t, costs[2].Difference == nil, true)
+	assert.Equal(t, costs[3].Param, "Bread")
+	assert.Equal(t, *costs[3].Value, 3.0)
+	assert.Equal(t, costs[3].BaseValue == nil, true)
+
+	indices := comparison.Cities[0].Indices
+	assert.Equal(t, len(indices), len(CityRankingIndices))
+	for _, index := range indices {
+		switch index.Index {
+		case "safety":
+			assert.Equal(t, *index.Difference, 15.0)
+			assert.Equal(t, *index.PercentDifference, 25.0)
+		case "rent":
+			assert.Equal(t, *index.BaseValue, 40.0)
+			assert.Equal(t, index.Difference == nil, true)
+		}
+	}
+}
+
+func TestNewCityComparisonCurrency(t *testing.T) {
+	base := &City{GeonameID: 1, Name: "Nowhere"}
+	city := &City{GeonameID: 2, Name: "Berlin", NumbeoCost: &NumbeoCost{Currency: "EUR"}}
+
+	assert.Equal(t, NewCityComparison(base, []*City{city}, "").Currency, "USD")
+	assert.Equal(t, NewCityComparison(base, []*City{city}, "EUR").Currency, "EUR")
+	assert.Equal(t, NewCityComparison(city, []*City{base}, "").Currency, "EUR")
+}
+
+func TestNumbeoCityIndicesIndexCoversRankingIndices(t *testing.T) {
+	indices := &NumbeoCityIndices{}
+	for _, name := range CityRankingIndices {
+		_, ok := indices.Index(name)
+		assert.Equal(t, ok, true)
+	}
+
+	_, ok := indices.Index("tides")
+	assert.Equal(t, ok, false)
+}
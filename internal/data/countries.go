@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/lib/pq"
@@ -12,12 +14,17 @@ import (
 
 type Country struct {
 	Code                  string                 `json:"country_code"`
+	Alpha2Code            *string                `json:"alpha2_code"`
+	NumericCode           *string                `json:"numeric_code"`
 	Name                  string                 `json:"country"`
 	Population            *int64                 `json:"population"`
 	Area                  *int64                 `json:"area"`
 	LastUpdate            string                 `json:"last_update"`
 	NumbeoCountryIndices  *NumbeoCountryIndices  `json:"numbeo_indices,omitzero"`
 	LegatumCountryIndices *LegatumCountryIndices `json:"legatum_indices,omitzero"`
+	CityAggregates        *CityAggregates        `json:"city_aggregates,omitzero"`
+	Cities                []*City                `json:"cities,omitzero"`
+	CitiesSummary         *CitiesSummary         `json:"cities_summary,omitzero"`
 }
 
 type NumbeoCountryIndices struct {
@@ -53,57 +60,123 @@ type LegatumCountryIndices struct {
 	NaturalEnvironment            RankAndScore `json:"natural_environment"`
 }
 
-type RankAndScore struct {
-	Rank2007  int     `json:"rank_2007"`
-	Rank2008  int     `json:"rank_2008"`
-	Rank2009  int     `json:"rank_2009"`
-	Rank2010  int     `json:"rank_2010"`
-	Rank2011  int     `json:"rank_2011"`
-	Rank2012  int     `json:"rank_2012"`
-	Rank2013  int     `json:"rank_2013"`
-	Rank2014  int     `json:"rank_2014"`
-	Rank2015  int     `json:"rank_2015"`
-	Rank2016  int     `json:"rank_2016"`
-	Rank2017  int     `json:"rank_2017"`
-	Rank2018  int     `json:"rank_2018"`
-	Rank2019  int     `json:"rank_2019"`
-	Rank2020  int     `json:"rank_2020"`
-	Rank2021  int     `json:"rank_2021"`
-	Rank2022  int     `json:"rank_2022"`
-	Rank2023  int     `json:"rank_2023"`
-	Score2007 float64 `json:"score_2007"`
-	Score2008 float64 `json:"score_2008"`
-	Score2009 float64 `json:"score_2009"`
-	Score2010 float64 `json:"score_2010"`
-	Score2011 float64 `json:"score_2011"`
-	Score2012 float64 `json:"score_2012"`
-	Score2013 float64 `json:"score_2013"`
-	Score2014 float64 `json:"score_2014"`
-	Score2015 float64 `json:"score_2015"`
-	Score2016 float64 `json:"score_2016"`
-	Score2017 float64 `json:"score_2017"`
-	Score2018 float64 `json:"score_2018"`
-	Score2019 float64 `json:"score_2019"`
-	Score2020 float64 `json:"score_2020"`
-	Score2021 float64 `json:"score_2021"`
-	Score2022 float64 `json:"score_2022"`
-	Score2023 float64 `json:"score_2023"`
-}
+// RankAndScore holds a pillar's rank_YYYY and score_YYYY values for every
+// edition in legatum_country_scores, so that new editions show up without a
+// code change. Values missing from an edition are null.
+type RankAndScore map[string]*float64
 
 type CountryModel struct {
 	DB *sql.DB
 }
 
-func (c CountryModel) ListCountries() (countries []*Country, retErr error) {
+var CountrySortSafelist = []string{"country_code", "name", "population", "-country_code", "-name", "-population"}
+
+var countryPage = keysetPage{
+	idColumn: "country_code",
+	idType:   "text",
+	sortColumns: map[string]keysetColumn{
+		"country_code": {expr: "ctr.country_code", sqlType: "text"},
+		"name":         {expr: "ctr.country", sqlType: "text"},
+		"population":   {expr: "COALESCE(ctr.population, -1)", sqlType: "bigint"},
+	},
+}
+
+type countryPageRow struct {
+	country *Country
+	sortKey string
+}
+
+func (c CountryModel) ListCountries(filters Filters) (countries []*Country, metadata Metadata, retErr error) {
+	if filters.Sort == "" {
+		filters.Sort = "country_code"
+	}
+
+	baseQuery := fmt.Sprintf(`
+		SELECT ctr.country_code, ctr.alpha2_code, LPAD(ctr.numeric_code::text, 3, '0'), ctr.country,
+		       ctr.population, ctr.area, ctr.last_update::text AS last_update,
+		       %s AS sort_key
+		FROM countries ctr`, countryPage.sortKeyExpr(filters))
+
+	query, args, cursor, err := countryPage.pageQuery(baseQuery, filters, nil)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = c.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM countries;`).Scan(&metadata.TotalCount)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	pageRows := []countryPageRow{}
+	for rows.Next() {
+		var row countryPageRow
+		var country Country
+		if err := rows.Scan(&country.Code, &country.Alpha2Code, &country.NumericCode, &country.Name, &country.Population, &country.Area, &country.LastUpdate, &row.sortKey); err != nil {
+			return nil, Metadata{}, err
+		}
+		row.country = &country
+		pageRows = append(pageRows, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	pageRows, metadata.NextCursor, metadata.PrevCursor = pageBounds(pageRows, filters, cursor, func(row countryPageRow) (*string, string) {
+		return &row.sortKey, row.country.Code
+	})
+	metadata.PageSize = filters.PageSize
+
+	countries = make([]*Country, 0, len(pageRows))
+	for _, row := range pageRows {
+		countries = append(countries, row.country)
+	}
+
+	return countries, metadata, nil
+}
+
+// ResolveCode returns the alpha-3 code of the country identified by an ISO
+// 3166-1 alpha-2, alpha-3 or numeric code, or ErrRecordNotFound.
+func (c CountryModel) ResolveCode(code string) (string, error) {
+	codes, err := c.ResolveCodes([]string{code})
+	if err != nil {
+		return "", err
+	}
+	if len(codes) == 0 {
+		return "", ErrRecordNotFound
+	}
+	return codes[0], nil
+}
+
+// ResolveCodes maps codes as ResolveCode does. Unknown codes are left out and
+// duplicates are removed, keeping the order of codes.
+func (c CountryModel) ResolveCodes(codes []string) (resolved []string, retErr error) {
 	query := `
-		SELECT country_code, country, population, area, last_update::text
-		FROM countries
-		ORDER BY country_code;`
+		SELECT ctr.country_code
+		FROM unnest($1::text[]) WITH ORDINALITY AS input(code, position)
+		JOIN countries ctr
+		  ON ctr.country_code = UPPER(input.code)
+		  OR UPPER(ctr.alpha2_code) = UPPER(input.code)
+		  OR ctr.numeric_code = CASE WHEN input.code ~ '^[0-9]{1,3}$' THEN input.code::bigint END
+		ORDER BY input.position;`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query)
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(codes))
 	if err != nil {
 		return nil, err
 	}
@@ -113,26 +186,30 @@ func (c CountryModel) ListCountries() (countries []*Country, retErr error) {
 		}
 	}()
 
-	countries = []*Country{}
+	resolved = []string{}
 	for rows.Next() {
-		var country Country
-		if err := rows.Scan(&country.Code, &country.Name, &country.Population, &country.Area, &country.LastUpdate); err != nil {
+		var code string
+		if err := rows.Scan(&code); err != nil {
 			return nil, err
 		}
-		countries = append(countries, &country)
+		if !slices.Contains(resolved, code) {
+			resolved = append(resolved, code)
+		}
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return countries, nil
+	return resolved, nil
 }
 
 func (c CountryModel) GetCountry(countryCode string, include IncludeSet) (*Country, error) {
 	query := `
 		SELECT
 			ctr.country_code,
+			ctr.alpha2_code,
+			LPAD(ctr.numeric_code::text, 3, '0'),
 			ctr.country,
 			ctr.population,
 			ctr.area,
@@ -182,9 +259,10 @@ func (c CountryModel) GetCountry(countryCode string, include IncludeSet) (*Count
 								WHEN 'Education' THEN 'education'
 								WHEN 'Natural Environment' THEN 'natural_environment'
 							END AS key,
-							to_jsonb(li) - 'country_code' - 'pillar_name' AS value
-						FROM legatum_country_indices li
+							jsonb_object_agg('rank_' || li.year, li.rank) || jsonb_object_agg('score_' || li.year, li.score) AS value
+						FROM legatum_country_scores li
 						WHERE li.country_code = ctr.country_code
+						GROUP BY li.pillar_name
 					) AS l
 					WHERE l.key IS NOT NULL
 				)
@@ -210,6 +288,8 @@ func (c CountryModel) GetCountry(countryCode string, include IncludeSet) (*Count
 		include.Has("legatum_indices"),
 	).Scan(
 		&country.Code,
+		&country.Alpha2Code,
+		&country.NumericCode,
 		&country.Name,
 		&country.Population,
 		&country.Area,
@@ -240,6 +320,13 @@ func (c CountryModel) GetCountry(countryCode string, include IncludeSet) (*Count
 		country.LegatumCountryIndices = &indices
 	}
 
+	if include.Has("city_aggregates") {
+		err = c.attachCityAggregatesByCodes(ctx, []string{country.Code}, map[string]*Country{country.Code: &country})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &country, nil
 }
 
@@ -249,7 +336,8 @@ func (c CountryModel) GetCountriesByCodes(codes []string, include IncludeSet) (c
 	}
 
 	query := `
-		SELECT ctr.country_code, ctr.country, ctr.population, ctr.area, ctr.last_update::text AS last_update
+		SELECT ctr.country_code, ctr.alpha2_code, LPAD(ctr.numeric_code::text, 3, '0'), ctr.country,
+		       ctr.population, ctr.area, ctr.last_update::text AS last_update
 		FROM countries ctr
 		WHERE ctr.country_code = ANY($1)
 		ORDER BY ctr.country_code;`
@@ -271,7 +359,7 @@ func (c CountryModel) GetCountriesByCodes(codes []string, include IncludeSet) (c
 	countryByCode := make(map[string]*Country, len(codes))
 	for rows.Next() {
 		var country Country
-		if err := rows.Scan(&country.Code, &country.Name, &country.Population, &country.Area, &country.LastUpdate); err != nil {
+		if err := rows.Scan(&country.Code, &country.Alpha2Code, &country.NumericCode, &country.Name, &country.Population, &country.Area, &country.LastUpdate); err != nil {
 			return nil, err
 		}
 		countryPtr := &country
@@ -300,6 +388,13 @@ func (c CountryModel) GetCountriesByCodes(codes []string, include IncludeSet) (c
 		}
 	}
 
+	if include.Has("city_aggregates") {
+		err = c.attachCityAggregatesByCodes(ctx, codes, countryByCode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return countries, nil
 }
 
@@ -374,11 +469,11 @@ func (c CountryModel) attachNumbeoIndicesByCodes(ctx context.Context, codes []st
 func (c CountryModel) attachLegatumIndicesByCodes(ctx context.Context, codes []string, countryByCode map[string]*Country) (retErr error) {
 	query := `
 		SELECT
-			li.country_code,
+			l.country_code,
 			jsonb_object_agg(l.key, l.value) AS legatum_indices
-		FROM legatum_country_indices li
-		CROSS JOIN LATERAL (
+		FROM (
 			SELECT
+				li.country_code,
 				CASE li.pillar_name
 					WHEN 'Safety and Security' THEN 'safety_and_security'
 					WHEN 'Personal Freedom' THEN 'personal_freedom'
@@ -393,10 +488,13 @@ func (c CountryModel) attachLegatumIndicesByCodes(ctx context.Context, codes []s
 					WHEN 'Education' THEN 'education'
 					WHEN 'Natural Environment' THEN 'natural_environment'
 				END AS key,
-				to_jsonb(li) - 'country_code' - 'pillar_name' AS value
+				jsonb_object_agg('rank_' || li.year, li.rank) || jsonb_object_agg('score_' || li.year, li.score) AS value
+			FROM legatum_country_scores li
+			WHERE li.country_code = ANY($1)
+			GROUP BY li.country_code, li.pillar_name
 		) AS l
-		WHERE li.country_code = ANY($1) AND l.key IS NOT NULL
-		GROUP BY li.country_code;`
+		WHERE l.key IS NOT NULL
+		GROUP BY l.country_code;`
 
 	rows, err := c.DB.QueryContext(ctx, query, pq.Array(codes))
 	if err != nil {
@@ -12,16 +12,40 @@ func TestListCountries(t *testing.T) {
 	db := newTestDB(t)
 	models := NewModels(db)
 
-	countries, err := models.Countries.ListCountries()
+	countries, metadata, err := models.Countries.ListCountries(Filters{Sort: "country_code"})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	assert.Equal(t, len(countries), 249)
+	assert.Equal(t, metadata.TotalCount, 249)
 	assert.Equal(t, countries[0].Code != "", true)
 	assert.Equal(t, countries[0].LastUpdate != "", true)
 }
 
+func TestListCountriesPagination(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	countries, metadata, err := models.Countries.ListCountries(Filters{PageSize: 5, Sort: "-country_code"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(countries), 5)
+	assert.Equal(t, metadata.PageSize, 5)
+	assert.Equal(t, metadata.TotalCount, 249)
+	assert.Equal(t, metadata.NextCursor != "", true)
+	assert.Equal(t, countries[0].Code > countries[4].Code, true)
+
+	next, _, err := models.Countries.ListCountries(Filters{PageSize: 5, Sort: "-country_code", Cursor: metadata.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, countries[4].Code > next[0].Code, true)
+}
+
 func TestGetCountry(t *testing.T) {
 	db := newTestDB(t)
 	models := NewModels(db)
@@ -37,6 +61,42 @@ func TestGetCountry(t *testing.T) {
 	assert.Equal(t, country.LegatumCountryIndices != nil, true)
 }
 
+func TestLegatumIndicesKeepEveryEdition(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	// 2099 stands for an edition newer than the dataset.
+	cleanup := func() {
+		if _, err := db.Exec(`DELETE FROM legatum_country_scores WHERE country_code = 'USA' AND year = 2099;`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	_, err := db.Exec(`
+		INSERT INTO legatum_country_scores (country_code, pillar_name, year, rank, score)
+		VALUES ('USA', 'Health', 2099, NULL, 80.5);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	country, err := models.Countries.GetCountry("USA", NewIncludeSet("legatum_indices"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	countries, err := models.Countries.GetCountriesByCodes([]string{"USA"}, NewIncludeSet("legatum_indices"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, indices := range []*LegatumCountryIndices{country.LegatumCountryIndices, countries[0].LegatumCountryIndices} {
+		assert.Equal(t, *indices.Health["score_2099"], 80.5)
+		rank, ok := indices.Health["rank_2099"]
+		assert.Equal(t, ok && rank == nil, true)
+		assert.Equal(t, indices.Health["score_2023"] != nil, true)
+	}
+}
+
 func TestGetCountriesByCodes(t *testing.T) {
 	db := newTestDB(t)
 	models := NewModels(db)
@@ -51,3 +111,61 @@ func TestGetCountriesByCodes(t *testing.T) {
 	assert.Equal(t, countries[0].LastUpdate != "", true)
 	assert.Equal(t, countries[1].Code, "USA")
 }
+
+func TestResolveCodes(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	codes, err := models.Countries.ResolveCodes([]string{"us", "USA", "840", "036", "XX", "jp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, codes, []string{"USA", "AUS", "JPN"})
+
+	_, err = models.Countries.ResolveCode("999")
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestGetLegatumSeries(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	series, err := models.Countries.GetLegatumSeries("USA", LegatumFilters{Pillars: NewIncludeSet("health"), From: 2020})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, series.CountryCode, "USA")
+	assert.Equal(t, len(series.Pillars), 1)
+	assert.Equal(t, series.Pillars[0].Name, "Health")
+	assert.Equal(t, len(series.Pillars[0].Series) > 0, true)
+	for _, point := range series.Pillars[0].Series {
+		assert.Equal(t, point.Year >= 2020, true)
+	}
+
+	_, err = models.Countries.GetLegatumSeries("XYZ", LegatumFilters{})
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestGetCountriesByCodesCityAggregates(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	countries, err := models.Countries.GetCountriesByCodes([]string{"USA", "RUS"}, NewIncludeSet("city_aggregates"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, country := range countries {
+		aggregates := country.CityAggregates
+		assert.Equal(t, aggregates != nil, true)
+		assert.Equal(t, len(aggregates.Indices), len(CityRankingIndices))
+		for _, stats := range aggregates.Indices {
+			assert.Equal(t, stats.Cities <= aggregates.CityCount, true)
+			if stats.Cities > 0 {
+				assert.Equal(t, *stats.Min <= *stats.Median && *stats.Median <= *stats.Max, true)
+				assert.Equal(t, *stats.Min <= *stats.WeightedMean && *stats.WeightedMean <= *stats.Max, true)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultCountryCitiesLimit = 10
+	MaxCountryCitiesLimit     = 100
+)
+
+// CitiesSummary describes the cities of a country. Population is the total
+// population of those cities, and Coverage counts the cities that have each
+// kind of data.
+type CitiesSummary struct {
+	CityCount  int            `json:"city_count"`
+	Population int64          `json:"population"`
+	Coverage   CitiesCoverage `json:"coverage"`
+}
+
+type CitiesCoverage struct {
+	NumbeoCost    int `json:"numbeo_cost"`
+	NumbeoIndices int `json:"numbeo_indices"`
+	AvgClimate    int `json:"avg_climate"`
+}
+
+// ListCitiesByCountries returns up to limit cities of every country in codes,
+// most populous first. Countries without cities are missing from the result.
+func (c CityModel) ListCitiesByCountries(codes []string, limit int) (citiesByCode map[string][]*City, retErr error) {
+	// Rank on cities alone and join countries only for the rows that are kept.
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM (
+			SELECT geoname_id,
+			       ROW_NUMBER() OVER (
+			           PARTITION BY country_code
+			           ORDER BY population DESC NULLS LAST, geoname_id
+			       ) AS position
+			FROM cities
+			WHERE country_code = ANY($1)
+		) AS ranked
+		JOIN cities c ON c.geoname_id = ranked.geoname_id
+		LEFT JOIN countries ctr ON ctr.country_code = c.country_code
+		WHERE ranked.position <= $2
+		ORDER BY c.country_code, ranked.position;`, cityColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(codes), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	citiesByCode = make(map[string][]*City, len(codes))
+	for rows.Next() {
+		var city City
+		if err := rows.Scan(city.scanDest()...); err != nil {
+			return nil, err
+		}
+		citiesByCode[city.CountryCode] = append(citiesByCode[city.CountryCode], &city)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return citiesByCode, nil
+}
+
+// SummarizeCitiesByCountries returns a CitiesSummary for every country in codes
+// that has cities.
+func (c CityModel) SummarizeCitiesByCountries(codes []string) (summaries map[string]*CitiesSummary, retErr error) {
+	query := `
+		SELECT c.country_code,
+		       COUNT(*)::int,
+		       COALESCE(SUM(c.population), 0)::bigint,
+		       COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM numbeo_city_costs ns WHERE ns.geoname_id = c.geoname_id))::int,
+		       COUNT(nic.geoname_id)::int,
+		       COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM avg_climate ac WHERE ac.geoname_id = c.geoname_id))::int
+		FROM cities c
+		LEFT JOIN numbeo_city_indices nic ON nic.geoname_id = c.geoname_id
+		WHERE c.country_code = ANY($1)
+		GROUP BY c.country_code;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	summaries = make(map[string]*CitiesSummary, len(codes))
+	for rows.Next() {
+		var (
+			code    string
+			summary CitiesSummary
+		)
+		if err := rows.Scan(
+			&code,
+			&summary.CityCount,
+			&summary.Population,
+			&summary.Coverage.NumbeoCost,
+			&summary.Coverage.NumbeoIndices,
+			&summary.Coverage.AvgClimate,
+		); err != nil {
+			return nil, err
+		}
+		summaries[code] = &summary
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
@@ -1,19 +1,264 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/denis-k2/relohelper-go/internal/validator"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 500
+)
+
 type Filters struct {
-	CountryCode string
+	CountryCode   string
+	StateCode     string
+	Timezone      string
+	MinPopulation *int64
+	MaxPopulation *int64
+	BBox          *BoundingBox
+	PageSize      int
+	Cursor        string
+	Sort          string
+	SortSafelist  []string
+}
+
+type Metadata struct {
+	PageSize   int    `json:"page_size"`
+	TotalCount int    `json:"total_count"`
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor,omitzero"`
+}
+
+type pageCursor struct {
+	Sort     string  `json:"s"`
+	Key      *string `json:"k,omitzero"`
+	ID       string  `json:"i"`
+	Backward bool    `json:"b,omitzero"`
+}
+
+func (f Filters) sortColumn() string {
+	return strings.TrimPrefix(f.Sort, "-")
+}
+
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func (f Filters) paginated() bool {
+	return f.PageSize > 0
+}
+
+func encodeCursor(c pageCursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(raw, sort string) (pageCursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+
+	var c pageCursor
+	if err := json.Unmarshal(js, &c); err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.ID == "" {
+		return pageCursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// validCursorValue reports whether a cursor value can be cast to sqlType, so a
+// tampered cursor is rejected before it reaches the query. A nil value stands for
+// a NULL sort key.
+func validCursorValue(value *string, sqlType string) bool {
+	if value == nil {
+		return true
+	}
+	switch sqlType {
+	case "bigint":
+		_, err := strconv.ParseInt(*value, 10, 64)
+		return err == nil
+	default:
+		return !strings.ContainsRune(*value, 0)
+	}
+}
+
+// keysetPage describes the sortable columns of a list query. Rows are ordered by
+// the sort expression and then by the unique id column, which keeps cursors stable
+// when several rows share the same sort key.
+type keysetPage struct {
+	idColumn    string
+	idType      string
+	sortColumns map[string]keysetColumn
+}
+
+type keysetColumn struct {
+	expr    string
+	sqlType string
+}
+
+// pageQuery wraps baseQuery, which must select a sort_key column and the id
+// column, with keyset conditions, ordering and a limit. args holds the arguments
+// already used by baseQuery; the cursor arguments are appended to it.
+func (p keysetPage) pageQuery(baseQuery string, f Filters, args []any) (string, []any, pageCursor, error) {
+	var c pageCursor
+	if f.Cursor != "" {
+		var err error
+		c, err = decodeCursor(f.Cursor, f.Sort)
+		if err != nil {
+			return "", nil, c, err
+		}
+	}
+
+	column := p.sortColumns[f.sortColumn()]
+	if f.Cursor != "" && (!validCursorValue(c.Key, column.sqlType) || !validCursorValue(&c.ID, p.idType)) {
+		return "", nil, c, ErrInvalidCursor
+	}
+	direction := f.sortDirection()
+	if c.Backward {
+		direction = reverseDirection(direction)
+	}
+
+	where := ""
+	if f.Cursor != "" {
+		operator := ">"
+		if direction == "DESC" {
+			operator = "<"
+		}
+
+		args = append(args, c.Key, c.ID)
+		where = fmt.Sprintf(
+			"WHERE (p.sort_key, p.%s) %s ($%d::%s, $%d::%s)",
+			p.idColumn, operator, len(args)-1, column.sqlType, len(args), p.idType,
+		)
+	}
+
+	limit := ""
+	if f.paginated() {
+		limit = fmt.Sprintf("LIMIT %d", f.PageSize+1)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT p.*
+		FROM (%s) AS p
+		%s
+		ORDER BY p.sort_key %s, p.%s %s
+		%s;`, baseQuery, where, direction, p.idColumn, direction, limit)
+
+	return query, args, c, nil
+}
+
+func (p keysetPage) sortKeyExpr(f Filters) string {
+	return p.sortColumns[f.sortColumn()].expr
+}
+
+func reverseDirection(direction string) string {
+	if direction == "DESC" {
+		return "ASC"
+	}
+	return "DESC"
 }
 
+// pageBounds trims the extra row fetched to detect a following page, restores the
+// natural order for backward pages and returns the slice bounds together with
+// next and previous cursors.
+func pageBounds[T any](rows []T, f Filters, c pageCursor, keyOf func(T) (*string, string)) ([]T, string, string) {
+	if !f.paginated() {
+		return rows, "", ""
+	}
+
+	hasMore := len(rows) > f.PageSize
+	if hasMore {
+		rows = rows[:f.PageSize]
+	}
+	if c.Backward {
+		slices.Reverse(rows)
+	}
+	if len(rows) == 0 {
+		return rows, "", ""
+	}
+
+	var next, prev string
+	if (!c.Backward && hasMore) || c.Backward {
+		key, id := keyOf(rows[len(rows)-1])
+		next = encodeCursor(pageCursor{Sort: f.Sort, Key: key, ID: id})
+	}
+	if (c.Backward && hasMore) || (!c.Backward && f.Cursor != "") {
+		key, id := keyOf(rows[0])
+		prev = encodeCursor(pageCursor{Sort: f.Sort, Key: key, ID: id, Backward: true})
+	}
+
+	return rows, next, prev
+}
+
+var countryCodeRX = regexp.MustCompile(`^([A-Za-z]{2,3}|[0-9]{1,3})$`)
+
+// ValidateFilters checks that the country code has the form of an ISO 3166-1
+// alpha-2, alpha-3 or numeric code. CountryModel.ResolveCode maps it to alpha-3.
 func ValidateFilters(v *validator.Validator, f Filters) {
-	countryCodeRegex := regexp.MustCompile(`^[A-Za-z]{3}$`)
-	v.Check(countryCodeRegex.MatchString(f.CountryCode), "country_code", "must be exactly three English letters")
+	v.Check(countryCodeRX.MatchString(f.CountryCode), "country_code", "must be an ISO 3166-1 alpha-2, alpha-3 or numeric code")
+}
+
+var (
+	stateCodeRX = regexp.MustCompile(`^[A-Za-z0-9-]{1,10}$`)
+	timezoneRX  = regexp.MustCompile(`^[A-Za-z0-9_+/-]{1,64}$`)
+)
+
+func ValidateStateCode(v *validator.Validator, code string) {
+	v.Check(stateCodeRX.MatchString(code), "state_code", "must be 1 to 10 letters, digits or hyphens")
+}
+
+func ValidateCityFilters(v *validator.Validator, f Filters) {
+	if f.StateCode != "" {
+		ValidateStateCode(v, f.StateCode)
+	}
+	if f.Timezone != "" {
+		v.Check(timezoneRX.MatchString(f.Timezone), "timezone", "must be an IANA timezone name or prefix, such as Europe/")
+	}
+
+	if f.MinPopulation != nil {
+		v.Check(*f.MinPopulation >= 0, "min_population", "must not be negative")
+	}
+	if f.MaxPopulation != nil {
+		v.Check(*f.MaxPopulation >= 0, "max_population", "must not be negative")
+	}
+	if f.MinPopulation != nil && f.MaxPopulation != nil {
+		v.Check(*f.MinPopulation <= *f.MaxPopulation, "max_population", "must not be less than min_population")
+	}
+
+	if f.BBox != nil {
+		b := f.BBox
+		v.Check(b.MinLon >= -180 && b.MinLon <= 180 && b.MaxLon >= -180 && b.MaxLon <= 180, "bbox", "longitudes must be between -180 and 180")
+		v.Check(b.MinLat >= -90 && b.MinLat <= 90 && b.MaxLat >= -90 && b.MaxLat <= 90, "bbox", "latitudes must be between -90 and 90")
+		v.Check(b.MinLat <= b.MaxLat, "bbox", "minLat must not be greater than maxLat")
+	}
+}
+
+func ValidatePagination(v *validator.Validator, f Filters) {
+	v.Check(f.PageSize >= 0 && f.PageSize <= MaxPageSize, "page_size", fmt.Sprintf("must be between 1 and %d", MaxPageSize))
+	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	if f.Cursor != "" && v.Valid() {
+		_, err := decodeCursor(f.Cursor, f.Sort)
+		v.Check(err == nil, "cursor", "must be a cursor returned for the same sort")
+	}
 }
 
 func ValidateBoolQuery(v *validator.Validator, s string) bool {
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	key := "Tokyo"
+	raw := encodeCursor(pageCursor{Sort: "-name", Key: &key, ID: "1850147"})
+
+	c, err := decodeCursor(raw, "-name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, *c.Key, "Tokyo")
+	assert.Equal(t, c.ID, "1850147")
+	assert.Equal(t, c.Backward, false)
+
+	_, err = decodeCursor(raw, "name")
+	assert.Equal(t, err, ErrInvalidCursor)
+
+	_, err = decodeCursor("not a cursor", "-name")
+	assert.Equal(t, err, ErrInvalidCursor)
+}
+
+func TestValidCursorValue(t *testing.T) {
+	value := func(s string) *string { return &s }
+
+	assert.Equal(t, validCursorValue(nil, "bigint"), true)
+	assert.Equal(t, validCursorValue(value("-1"), "bigint"), true)
+	assert.Equal(t, validCursorValue(value("abc"), "bigint"), false)
+	assert.Equal(t, validCursorValue(value("99999999999999999999"), "bigint"), false)
+	assert.Equal(t, validCursorValue(value("Tokyo"), "text"), true)
+	assert.Equal(t, validCursorValue(value("To\x00kyo"), "text"), false)
+}
+
+func TestPageBounds(t *testing.T) {
+	keyOf := func(id int) (*string, string) {
+		s := string(rune('a' + id))
+		return &s, s
+	}
+
+	f := Filters{PageSize: 3, Sort: "name"}
+	rows, next, prev := pageBounds([]int{0, 1, 2, 3}, f, pageCursor{}, keyOf)
+	assert.DeepEqual(t, rows, []int{0, 1, 2})
+	assert.Equal(t, next != "", true)
+	assert.Equal(t, prev, "")
+
+	f.Cursor = next
+	rows, next, prev = pageBounds([]int{3, 4}, f, pageCursor{}, keyOf)
+	assert.DeepEqual(t, rows, []int{3, 4})
+	assert.Equal(t, next, "")
+	assert.Equal(t, prev != "", true)
+
+	rows, next, prev = pageBounds([]int{2, 1, 0}, f, pageCursor{Backward: true}, keyOf)
+	assert.DeepEqual(t, rows, []int{0, 1, 2})
+	assert.Equal(t, next != "", true)
+	assert.Equal(t, prev, "")
+
+	rows, next, prev = pageBounds([]int{0, 1, 2, 3}, Filters{Sort: "name"}, pageCursor{}, keyOf)
+	assert.DeepEqual(t, rows, []int{0, 1, 2, 3})
+	assert.Equal(t, next, "")
+	assert.Equal(t, prev, "")
+}
+
+func TestValidatePagination(t *testing.T) {
+	v := validator.New()
+	ValidatePagination(v, Filters{PageSize: 10, Sort: "-population", SortSafelist: CitySortSafelist})
+	assert.Equal(t, v.Valid(), true)
+
+	v = validator.New()
+	ValidatePagination(v, Filters{PageSize: 10, Sort: "area", SortSafelist: CitySortSafelist})
+	assert.DeepEqual(t, v.Errors, map[string]string{"sort": "invalid sort value"})
+
+	v = validator.New()
+	ValidatePagination(v, Filters{PageSize: 10, Sort: "name", Cursor: "bogus", SortSafelist: CitySortSafelist})
+	assert.DeepEqual(t, v.Errors, map[string]string{"cursor": "must be a cursor returned for the same sort"})
+}
+
+func TestValidateFilters(t *testing.T) {
+	for _, code := range []string{"USA", "us", "840", "36"} {
+		v := validator.New()
+		ValidateFilters(v, Filters{CountryCode: code})
+		assert.Equal(t, v.Valid(), true)
+	}
+
+	for _, code := range []string{"", "u", "usaa", "u5", "8400", " us"} {
+		v := validator.New()
+		ValidateFilters(v, Filters{CountryCode: code})
+		assert.Equal(t, v.Errors["country_code"], "must be an ISO 3166-1 alpha-2, alpha-3 or numeric code")
+	}
+}
+
+func TestValidateCityFilters(t *testing.T) {
+	minPopulation, maxPopulation := int64(500000), int64(100000)
+
+	v := validator.New()
+	ValidateCityFilters(v, Filters{StateCode: "CA", Timezone: "America/Port_of_Spain", MinPopulation: &maxPopulation})
+	assert.Equal(t, v.Valid(), true)
+
+	v = validator.New()
+	ValidateCityFilters(v, Filters{
+		StateCode:     "C A",
+		Timezone:      "Europe/%",
+		MinPopulation: &minPopulation,
+		MaxPopulation: &maxPopulation,
+		BBox:          &BoundingBox{MinLon: 170, MinLat: 60, MaxLon: -170, MaxLat: 50},
+	})
+	assert.DeepEqual(t, v.Errors, map[string]string{
+		"state_code":     "must be 1 to 10 letters, digits or hyphens",
+		"timezone":       "must be an IANA timezone name or prefix, such as Europe/",
+		"max_population": "must not be less than min_population",
+		"bbox":           "minLat must not be greater than maxLat",
+	})
+
+	v = validator.New()
+	ValidateCityFilters(v, Filters{BBox: &BoundingBox{MinLon: 170, MinLat: -10, MaxLon: -170, MaxLat: 10}})
+	assert.Equal(t, v.Valid(), true)
+}
@@ -0,0 +1,76 @@
+package data
+
+import "math"
+
+const earthRadiusKm = 6371.0088
+
+// BoundingBox is a map viewport given as minLon,minLat,maxLon,maxLat. A box
+// with MinLon greater than MaxLon crosses the antimeridian.
+type BoundingBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+func (b BoundingBox) WrapsLon() bool {
+	return b.MinLon > b.MaxLon
+}
+
+type geoBox struct {
+	MinLat float64
+	MaxLat float64
+	MinLon float64
+	MaxLon float64
+	// WrapsLon is set when the box crosses the antimeridian, in which case
+	// matching longitudes are >= MinLon or <= MaxLon.
+	WrapsLon bool
+}
+
+func newGeoBox(lat, lon, radiusKm float64) geoBox {
+	angular := radiusKm / earthRadiusKm
+	latDelta := angular * 180 / math.Pi
+
+	box := geoBox{
+		MinLat: lat - latDelta,
+		MaxLat: lat + latDelta,
+		MinLon: -180,
+		MaxLon: 180,
+	}
+
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		box.MinLat = math.Max(box.MinLat, -90)
+		box.MaxLat = math.Min(box.MaxLat, 90)
+		return box
+	}
+
+	ratio := math.Sin(angular) / math.Cos(lat*math.Pi/180)
+	if ratio >= 1 {
+		return box
+	}
+
+	lonDelta := math.Asin(ratio) * 180 / math.Pi
+	box.MinLon = lon - lonDelta
+	box.MaxLon = lon + lonDelta
+	if box.MinLon < -180 {
+		box.MinLon += 360
+		box.WrapsLon = true
+	}
+	if box.MaxLon > 180 {
+		box.MaxLon -= 360
+		box.WrapsLon = true
+	}
+
+	return box
+}
+
+func HaversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Pow(math.Sin(dLon/2), 2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"math"
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+func TestHaversineKm(t *testing.T) {
+	// Paris -> London is roughly 344 km.
+	got := HaversineKm(48.85341, 2.3488, 51.50853, -0.12574)
+	assert.Equal(t, math.Abs(got-343.5) < 1, true)
+
+	assert.Equal(t, HaversineKm(10, 20, 10, 20), 0.0)
+}
+
+func TestNewGeoBox(t *testing.T) {
+	t.Run("regular box", func(t *testing.T) {
+		box := newGeoBox(48.85, 2.35, 100)
+		assert.Equal(t, box.WrapsLon, false)
+		assert.Equal(t, box.MinLat < 48.85 && box.MaxLat > 48.85, true)
+		assert.Equal(t, box.MinLon < 2.35 && box.MaxLon > 2.35, true)
+		// Every point on the radius must fall inside the box.
+		assert.Equal(t, HaversineKm(48.85, 2.35, box.MaxLat, 2.35) >= 99.9, true)
+		assert.Equal(t, HaversineKm(48.85, 2.35, 48.85, box.MaxLon) >= 99.9, true)
+	})
+
+	t.Run("crosses antimeridian", func(t *testing.T) {
+		box := newGeoBox(-17.7, 179.9, 100)
+		assert.Equal(t, box.WrapsLon, true)
+		assert.Equal(t, box.MinLon > 0, true)
+		assert.Equal(t, box.MaxLon < 0, true)
+	})
+
+	t.Run("touches pole", func(t *testing.T) {
+		box := newGeoBox(89.5, 10, 200)
+		assert.Equal(t, box.MaxLat, 90.0)
+		assert.Equal(t, box.MinLon, -180.0)
+		assert.Equal(t, box.MaxLon, 180.0)
+	})
+}
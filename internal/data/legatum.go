@@ -0,0 +1,394 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+// LegatumFirstYear is the year of the first Legatum Prosperity Index edition.
+const LegatumFirstYear = 2007
+
+// ErrLegatumYearRange is returned when the editions that a trend query resolves
+// to do not give a from year before the to year.
+var ErrLegatumYearRange = errors.New("to must be after from")
+
+// LegatumPillar maps the pillar names stored in legatum_country_scores to the
+// keys used by the API.
+type LegatumPillar struct {
+	Key  string
+	Name string
+}
+
+var LegatumPillars = []LegatumPillar{
+	{Key: "safety_and_security", Name: "Safety and Security"},
+	{Key: "personal_freedom", Name: "Personal Freedom"},
+	{Key: "governance", Name: "Governance"},
+	{Key: "social_capital", Name: "Social Capital"},
+	{Key: "investment_invironment", Name: "Investment Environment"},
+	{Key: "enterprise_conditions", Name: "Enterprise Conditions"},
+	{Key: "infrastructure_and_market_access", Name: "Infrastructure and Market Access"},
+	{Key: "economic_quality", Name: "Economic Quality"},
+	{Key: "living_conditions", Name: "Living Conditions"},
+	{Key: "health", Name: "Health"},
+	{Key: "education", Name: "Education"},
+	{Key: "natural_environment", Name: "Natural Environment"},
+}
+
+// MaxLegatumTrendLimit bounds the improvers and the decliners separately.
+const MaxLegatumTrendLimit = 100
+
+func LegatumPillarKeys() []string {
+	keys := make([]string, 0, len(LegatumPillars))
+	for _, pillar := range LegatumPillars {
+		keys = append(keys, pillar.Key)
+	}
+	return keys
+}
+
+func legatumPillar(key string) (LegatumPillar, bool) {
+	for _, pillar := range LegatumPillars {
+		if pillar.Key == key {
+			return pillar, true
+		}
+	}
+	return LegatumPillar{}, false
+}
+
+// LegatumFilters selects pillars by key and an inclusive range of years. An
+// empty Pillars selects every pillar, and a zero From or To leaves that end open.
+type LegatumFilters struct {
+	Pillars IncludeSet
+	From    int
+	To      int
+}
+
+type LegatumSeries struct {
+	CountryCode string                `json:"country_code"`
+	CountryName string                `json:"country"`
+	Pillars     []LegatumPillarSeries `json:"pillars"`
+}
+
+type LegatumPillarSeries struct {
+	Pillar string         `json:"pillar"`
+	Name   string         `json:"name"`
+	Series []LegatumPoint `json:"series"`
+}
+
+type LegatumPoint struct {
+	Year  int      `json:"year"`
+	Rank  *int64   `json:"rank"`
+	Score *float64 `json:"score"`
+}
+
+// GetLegatumSeries returns the yearly rank and score of every selected pillar,
+// in LegatumPillars order. Pillars without data have an empty series.
+func (c CountryModel) GetLegatumSeries(countryCode string, f LegatumFilters) (series *LegatumSeries, retErr error) {
+	series = &LegatumSeries{Pillars: []LegatumPillarSeries{}}
+	byName := make(map[string]*LegatumPillarSeries, len(LegatumPillars))
+	var names []string
+	for _, pillar := range LegatumPillars {
+		if len(f.Pillars) > 0 && !f.Pillars.Has(pillar.Key) {
+			continue
+		}
+		series.Pillars = append(series.Pillars, LegatumPillarSeries{Pillar: pillar.Key, Name: pillar.Name, Series: []LegatumPoint{}})
+		names = append(names, pillar.Name)
+	}
+	for i := range series.Pillars {
+		byName[series.Pillars[i].Name] = &series.Pillars[i]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, `SELECT country_code, country FROM countries WHERE country_code = $1;`, countryCode).
+		Scan(&series.CountryCode, &series.CountryName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	query := `
+		SELECT pillar_name, year, rank, score
+		FROM legatum_country_scores
+		WHERE country_code = $1
+		  AND pillar_name = ANY($2)
+		  AND ($3 = 0 OR year >= $3)
+		  AND ($4 = 0 OR year <= $4)
+		ORDER BY pillar_name, year;`
+
+	rows, err := c.DB.QueryContext(ctx, query, countryCode, pq.Array(names), f.From, f.To)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	for rows.Next() {
+		var (
+			name  string
+			point LegatumPoint
+		)
+		if err := rows.Scan(&name, &point.Year, &point.Rank, &point.Score); err != nil {
+			return nil, err
+		}
+		if pillar, ok := byName[name]; ok {
+			pillar.Series = append(pillar.Series, point)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
+
+// LegatumTrendQuery compares a pillar between From and To. A zero From or To
+// stands for the earliest or latest edition with data for the pillar, within
+// the other bound when that one is set.
+type LegatumTrendQuery struct {
+	Pillar string
+	From   int
+	To     int
+	Limit  int
+}
+
+func ValidateLegatumTrendQuery(v *validator.Validator, q LegatumTrendQuery) {
+	_, ok := legatumPillar(q.Pillar)
+	v.Check(ok, "pillar", "must be one of the supported pillars")
+	v.Check(q.From == 0 || q.To == 0 || q.From < q.To, "to", "to must be after from")
+	v.Check(q.Limit >= 1 && q.Limit <= MaxLegatumTrendLimit, "limit", fmt.Sprintf("must be between 1 and %d", MaxLegatumTrendLimit))
+}
+
+// LegatumTrends lists the countries whose pillar score rose or fell the most
+// between From and To. Only countries with a score in both years are compared.
+type LegatumTrends struct {
+	Pillar        string          `json:"pillar"`
+	Name          string          `json:"name"`
+	From          int             `json:"from"`
+	To            int             `json:"to"`
+	ComparedCount int             `json:"compared_count"`
+	Improvers     []*LegatumTrend `json:"improvers"`
+	Decliners     []*LegatumTrend `json:"decliners"`
+}
+
+// LegatumTrend describes how a country moved between two editions. RankChange
+// is positive when the country moved up. Slope is the least-squares trend of
+// the score, in points per year, over every edition from From to To.
+type LegatumTrend struct {
+	CountryCode string   `json:"country_code"`
+	CountryName string   `json:"country"`
+	FromRank    *int64   `json:"from_rank"`
+	ToRank      *int64   `json:"to_rank"`
+	RankChange  *int64   `json:"rank_change"`
+	FromScore   float64  `json:"from_score"`
+	ToScore     float64  `json:"to_score"`
+	ScoreChange float64  `json:"score_change"`
+	Slope       *float64 `json:"slope"`
+}
+
+type legatumCountryPoints struct {
+	code, name string
+	points     []LegatumPoint
+}
+
+// newLegatumTrend returns nil when points, sorted by year, lack a score for from
+// or to.
+func newLegatumTrend(code, name string, points []LegatumPoint, from, to int) *LegatumTrend {
+	var first, last *LegatumPoint
+	var xs, ys []float64
+	for i := range points {
+		p := &points[i]
+		if p.Year < from || p.Year > to || p.Score == nil {
+			continue
+		}
+		switch p.Year {
+		case from:
+			first = p
+		case to:
+			last = p
+		}
+		xs = append(xs, float64(p.Year))
+		ys = append(ys, *p.Score)
+	}
+	if first == nil || last == nil {
+		return nil
+	}
+
+	trend := &LegatumTrend{
+		CountryCode: code,
+		CountryName: name,
+		FromRank:    first.Rank,
+		ToRank:      last.Rank,
+		FromScore:   *first.Score,
+		ToScore:     *last.Score,
+		ScoreChange: roundTrend(*last.Score - *first.Score),
+		Slope:       linearSlope(xs, ys),
+	}
+	if first.Rank != nil && last.Rank != nil {
+		change := *first.Rank - *last.Rank
+		trend.RankChange = &change
+	}
+
+	return trend
+}
+
+// linearSlope returns the least-squares slope of ys over xs, or nil for fewer
+// than two distinct xs.
+func linearSlope(xs, ys []float64) *float64 {
+	if len(xs) < 2 {
+		return nil
+	}
+
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+
+	var covariance, variance float64
+	for i := range xs {
+		covariance += (xs[i] - meanX) * (ys[i] - meanY)
+		variance += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	if variance == 0 {
+		return nil
+	}
+
+	slope := roundTrend(covariance / variance)
+	return &slope
+}
+
+func roundTrend(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
+
+// newLegatumTrends resolves the defaults of q against the editions in countries
+// and returns an error wrapping ErrLegatumYearRange unless from ends up before
+// to, which ValidateLegatumTrendQuery can only check for explicit years.
+func newLegatumTrends(pillar LegatumPillar, countries []legatumCountryPoints, q LegatumTrendQuery) (*LegatumTrends, error) {
+	trends := &LegatumTrends{
+		Pillar:    pillar.Key,
+		Name:      pillar.Name,
+		From:      q.From,
+		To:        q.To,
+		Improvers: []*LegatumTrend{},
+		Decliners: []*LegatumTrend{},
+	}
+
+	// Default to the earliest and latest editions in the data.
+	for _, country := range countries {
+		for _, p := range country.points {
+			if q.From == 0 && (trends.From == 0 || p.Year < trends.From) {
+				trends.From = p.Year
+			}
+			if q.To == 0 && p.Year > trends.To {
+				trends.To = p.Year
+			}
+		}
+	}
+
+	switch {
+	case trends.From == 0 || trends.To == 0:
+		return nil, fmt.Errorf("%w, but the pillar has no edition with data in the range", ErrLegatumYearRange)
+	case trends.From >= trends.To:
+		return nil, fmt.Errorf("%w, but the editions with data for the pillar resolve to from %d and to %d", ErrLegatumYearRange, trends.From, trends.To)
+	}
+
+	for _, country := range countries {
+		trend := newLegatumTrend(country.code, country.name, country.points, trends.From, trends.To)
+		if trend == nil {
+			continue
+		}
+		trends.ComparedCount++
+		switch {
+		case trend.ScoreChange > 0:
+			trends.Improvers = append(trends.Improvers, trend)
+		case trend.ScoreChange < 0:
+			trends.Decliners = append(trends.Decliners, trend)
+		}
+	}
+
+	slices.SortFunc(trends.Improvers, func(a, b *LegatumTrend) int {
+		return cmp.Or(cmp.Compare(b.ScoreChange, a.ScoreChange), cmp.Compare(a.CountryCode, b.CountryCode))
+	})
+	slices.SortFunc(trends.Decliners, func(a, b *LegatumTrend) int {
+		return cmp.Or(cmp.Compare(a.ScoreChange, b.ScoreChange), cmp.Compare(a.CountryCode, b.CountryCode))
+	})
+	if len(trends.Improvers) > q.Limit {
+		trends.Improvers = trends.Improvers[:q.Limit]
+	}
+	if len(trends.Decliners) > q.Limit {
+		trends.Decliners = trends.Decliners[:q.Limit]
+	}
+
+	return trends, nil
+}
+
+func (c CountryModel) LegatumTrends(q LegatumTrendQuery) (trends *LegatumTrends, retErr error) {
+	pillar, ok := legatumPillar(q.Pillar)
+	if !ok {
+		return nil, fmt.Errorf("unsupported legatum pillar %q", q.Pillar)
+	}
+
+	query := `
+		SELECT ls.country_code, ctr.country, ls.year, ls.rank, ls.score
+		FROM legatum_country_scores ls
+		JOIN countries ctr ON ctr.country_code = ls.country_code
+		WHERE ls.pillar_name = $1
+		  AND ($2 = 0 OR ls.year >= $2)
+		  AND ($3 = 0 OR ls.year <= $3)
+		ORDER BY ls.country_code, ls.year;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, pillar.Name, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	var countries []legatumCountryPoints
+	for rows.Next() {
+		var (
+			code, name string
+			point      LegatumPoint
+		)
+		if err := rows.Scan(&code, &name, &point.Year, &point.Rank, &point.Score); err != nil {
+			return nil, err
+		}
+		if len(countries) == 0 || countries[len(countries)-1].code != code {
+			countries = append(countries, legatumCountryPoints{code: code, name: name})
+		}
+		last := &countries[len(countries)-1]
+		last.points = append(last.points, point)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newLegatumTrends(pillar, countries, q)
+}
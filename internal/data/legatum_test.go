@@ -0,0 +1,91 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+func legatumPoint(year int, rank int64, score float64) LegatumPoint {
+	return LegatumPoint{Year: year, Rank: &rank, Score: &score}
+}
+
+func TestNewLegatumTrend(t *testing.T) {
+	points := []LegatumPoint{
+		legatumPoint(2015, 40, 50),
+		legatumPoint(2016, 38, 52),
+		legatumPoint(2017, 35, 54),
+		{Year: 2018},
+		legatumPoint(2019, 30, 58),
+	}
+
+	trend := newLegatumTrend("DEU", "Germany", points, 2015, 2019)
+	assert.Equal(t, trend.FromScore, 50.0)
+	assert.Equal(t, trend.ToScore, 58.0)
+	assert.Equal(t, trend.ScoreChange, 8.0)
+	assert.Equal(t, *trend.RankChange, int64(10))
+	assert.Equal(t, *trend.Slope, 2.0)
+
+	trend = newLegatumTrend("DEU", "Germany", points, 2016, 2017)
+	assert.Equal(t, *trend.RankChange, int64(3))
+	assert.Equal(t, *trend.Slope, 2.0)
+
+	assert.Equal(t, newLegatumTrend("DEU", "Germany", points, 2015, 2018), (*LegatumTrend)(nil))
+	assert.Equal(t, newLegatumTrend("DEU", "Germany", points, 2014, 2019), (*LegatumTrend)(nil))
+}
+
+func TestLinearSlope(t *testing.T) {
+	assert.Equal(t, *linearSlope([]float64{2020, 2021, 2022}, []float64{10, 8, 6}), -2.0)
+	assert.Equal(t, linearSlope([]float64{2020}, []float64{10}), (*float64)(nil))
+	assert.Equal(t, linearSlope([]float64{2020, 2020}, []float64{10, 12}), (*float64)(nil))
+}
+
+func TestNewLegatumTrends(t *testing.T) {
+	pillar, _ := legatumPillar("governance")
+	countries := []legatumCountryPoints{
+		{code: "AAA", name: "A", points: []LegatumPoint{legatumPoint(2015, 10, 60), legatumPoint(2023, 5, 70)}},
+		{code: "BBB", name: "B", points: []LegatumPoint{legatumPoint(2015, 20, 50), legatumPoint(2023, 8, 65)}},
+		{code: "CCC", name: "C", points: []LegatumPoint{legatumPoint(2015, 5, 70), legatumPoint(2023, 12, 61)}},
+		{code: "DDD", name: "D", points: []LegatumPoint{legatumPoint(2015, 30, 40), legatumPoint(2023, 30, 40)}},
+		{code: "EEE", name: "E", points: []LegatumPoint{legatumPoint(2023, 1, 90)}},
+	}
+
+	trends, err := newLegatumTrends(pillar, countries, LegatumTrendQuery{Pillar: "governance", Limit: 1})
+	assert.NilError(t, err)
+	assert.Equal(t, trends.Name, "Governance")
+	assert.Equal(t, trends.From, 2015)
+	assert.Equal(t, trends.To, 2023)
+	assert.Equal(t, trends.ComparedCount, 4)
+	assert.Equal(t, len(trends.Improvers), 1)
+	assert.Equal(t, trends.Improvers[0].CountryCode, "BBB")
+	assert.Equal(t, len(trends.Decliners), 1)
+	assert.Equal(t, trends.Decliners[0].CountryCode, "CCC")
+	assert.Equal(t, *trends.Decliners[0].RankChange, int64(-7))
+}
+
+func TestNewLegatumTrendsResolvedRange(t *testing.T) {
+	pillar, _ := legatumPillar("governance")
+	latest := []legatumCountryPoints{
+		{code: "AAA", name: "A", points: []LegatumPoint{legatumPoint(2023, 5, 70)}},
+		{code: "BBB", name: "B", points: []LegatumPoint{legatumPoint(2023, 8, 65)}},
+	}
+
+	tests := []struct {
+		name      string
+		countries []legatumCountryPoints
+		q         LegatumTrendQuery
+	}{
+		{name: "single edition", countries: latest, q: LegatumTrendQuery{Pillar: "governance", Limit: 1}},
+		{name: "from the latest edition", countries: latest, q: LegatumTrendQuery{Pillar: "governance", From: 2023, Limit: 1}},
+		{name: "to the earliest edition", countries: latest, q: LegatumTrendQuery{Pillar: "governance", To: 2023, Limit: 1}},
+		{name: "no editions", countries: nil, q: LegatumTrendQuery{Pillar: "governance", From: 2030, Limit: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newLegatumTrends(pillar, tt.countries, tt.q)
+			assert.Equal(t, errors.Is(err, ErrLegatumYearRange), true)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -13,6 +14,8 @@ var (
 type Models struct {
 	Cities    CityModel
 	Countries CountryModel
+	Search    SearchModel
+	States    StateModel
 	Tokens    TokenModel
 	Users     UserModelInterface
 }
@@ -21,6 +24,8 @@ func NewModels(db *sql.DB) Models {
 	return Models{
 		Cities:    CityModel{DB: db},
 		Countries: CountryModel{DB: db},
+		Search:    SearchModel{DB: db, RefreshInterval: 10 * time.Minute, cache: &searchCache{}},
+		States:    StateModel{DB: db},
 		Tokens:    TokenModel{DB: db},
 		Users:     UserModel{DB: db},
 	}
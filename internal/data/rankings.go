@@ -0,0 +1,242 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+// CityRankingIndices and CountryRankingIndices are the numbeo_city_indices and
+// numbeo_country_indices columns that can be ranked.
+var (
+	CityRankingIndices = []string{
+		"cost_of_living",
+		"rent",
+		"cost_of_living_plus_rent",
+		"groceries",
+		"local_purchasing_power",
+		"quality_of_life",
+		"property_price_to_income_ratio",
+		"traffic_commute_time",
+		"climate",
+		"safety",
+		"health_care",
+		"pollution",
+	}
+	CountryRankingIndices = []string{
+		"cost_of_living",
+		"rent",
+		"cost_of_living_plus_rent",
+		"groceries",
+		"restaurant_price",
+		"local_purchasing_power",
+		"quality_of_life",
+		"property_price_to_income_ratio",
+		"traffic_commute_time",
+		"climate",
+		"safety",
+		"health_care",
+		"pollution",
+		"avg_salary_usd",
+	}
+)
+
+const MaxRankingLimit = 250
+
+type RankingQuery struct {
+	Index   string
+	Order   string
+	Limit   int
+	Filters Filters
+}
+
+// RankingMetadata reports how many rows were ranked and how many were left out
+// because their index value is NULL.
+type RankingMetadata struct {
+	Index         string `json:"index"`
+	Order         string `json:"order"`
+	RankedCount   int    `json:"ranked_count"`
+	UnrankedCount int    `json:"unranked_count"`
+}
+
+// Percentile is the share of ranked rows with a lower value, from 0 to 100,
+// independent of the requested order.
+type CityRanking struct {
+	Rank        int     `json:"rank"`
+	GeonameID   int64   `json:"geoname_id"`
+	Name        string  `json:"city"`
+	CountryCode string  `json:"country_code"`
+	CountryName string  `json:"country"`
+	Population  *int64  `json:"population"`
+	Value       float64 `json:"value"`
+	Percentile  float64 `json:"percentile"`
+}
+
+type CountryRanking struct {
+	Rank       int     `json:"rank"`
+	Code       string  `json:"country_code"`
+	Name       string  `json:"country"`
+	Population *int64  `json:"population"`
+	Value      float64 `json:"value"`
+	Percentile float64 `json:"percentile"`
+}
+
+func ValidateRankingQuery(v *validator.Validator, q RankingQuery, indices []string) {
+	v.Check(slices.Contains(indices, q.Index), "index", "must be one of the supported indices")
+	v.Check(validator.PermittedValue(q.Order, "asc", "desc"), "order", "must be asc or desc")
+	v.Check(q.Limit >= 1 && q.Limit <= MaxRankingLimit, "limit", fmt.Sprintf("must be between 1 and %d", MaxRankingLimit))
+}
+
+func (q RankingQuery) direction() string {
+	if q.Order == "asc" {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+const rankingSelect = `
+	WITH base AS (%s),
+	ranked AS (
+		SELECT b.*,
+		       RANK() OVER (ORDER BY b.value %s) AS rank,
+		       PERCENT_RANK() OVER (ORDER BY b.value) AS percentile
+		FROM base b
+		WHERE b.value IS NOT NULL
+	)`
+
+func (c CityModel) RankCities(q RankingQuery) (rankings []*CityRanking, metadata RankingMetadata, retErr error) {
+	if !slices.Contains(CityRankingIndices, q.Index) {
+		return nil, RankingMetadata{}, fmt.Errorf("unsupported ranking index %q", q.Index)
+	}
+
+	where, args := cityFilterClause(q.Filters)
+	base := fmt.Sprintf(`
+		SELECT c.geoname_id, c.city, c.country_code, ctr.country, c.population, nic.%s AS value
+		FROM numbeo_city_indices nic
+		JOIN cities c ON c.geoname_id = nic.geoname_id
+		LEFT JOIN countries ctr ON ctr.country_code = c.country_code
+		%s`, q.Index, where)
+	with := fmt.Sprintf(rankingSelect, base, q.direction())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	metadata = RankingMetadata{Index: q.Index, Order: q.Order}
+	err := c.DB.QueryRowContext(ctx, with+`
+		SELECT COUNT(value), COUNT(*) - COUNT(value) FROM base;`, args...).Scan(&metadata.RankedCount, &metadata.UnrankedCount)
+	if err != nil {
+		return nil, RankingMetadata{}, err
+	}
+
+	query := with + fmt.Sprintf(`
+		SELECT r.rank, r.geoname_id, r.city, r.country_code, COALESCE(r.country, ''), r.population, r.value, r.percentile
+		FROM ranked r
+		ORDER BY r.rank, r.geoname_id
+		LIMIT $%d;`, len(args)+1)
+
+	rows, err := c.DB.QueryContext(ctx, query, append(args, q.Limit)...)
+	if err != nil {
+		return nil, RankingMetadata{}, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	rankings = []*CityRanking{}
+	for rows.Next() {
+		var r CityRanking
+		if err := rows.Scan(&r.Rank, &r.GeonameID, &r.Name, &r.CountryCode, &r.CountryName, &r.Population, &r.Value, &r.Percentile); err != nil {
+			return nil, RankingMetadata{}, err
+		}
+		r.Percentile = roundPercentile(r.Percentile)
+		rankings = append(rankings, &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, RankingMetadata{}, err
+	}
+
+	return rankings, metadata, nil
+}
+
+func (c CountryModel) RankCountries(q RankingQuery) (rankings []*CountryRanking, metadata RankingMetadata, retErr error) {
+	if !slices.Contains(CountryRankingIndices, q.Index) {
+		return nil, RankingMetadata{}, fmt.Errorf("unsupported ranking index %q", q.Index)
+	}
+
+	where, args := countryPopulationClause(q.Filters)
+	base := fmt.Sprintf(`
+		SELECT ctr.country_code, ctr.country, ctr.population, nci.%s AS value
+		FROM numbeo_country_indices nci
+		JOIN countries ctr ON ctr.country_code = nci.country_code
+		%s`, q.Index, where)
+	with := fmt.Sprintf(rankingSelect, base, q.direction())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	metadata = RankingMetadata{Index: q.Index, Order: q.Order}
+	err := c.DB.QueryRowContext(ctx, with+`
+		SELECT COUNT(value), COUNT(*) - COUNT(value) FROM base;`, args...).Scan(&metadata.RankedCount, &metadata.UnrankedCount)
+	if err != nil {
+		return nil, RankingMetadata{}, err
+	}
+
+	query := with + fmt.Sprintf(`
+		SELECT r.rank, r.country_code, r.country, r.population, r.value, r.percentile
+		FROM ranked r
+		ORDER BY r.rank, r.country_code
+		LIMIT $%d;`, len(args)+1)
+
+	rows, err := c.DB.QueryContext(ctx, query, append(args, q.Limit)...)
+	if err != nil {
+		return nil, RankingMetadata{}, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	rankings = []*CountryRanking{}
+	for rows.Next() {
+		var r CountryRanking
+		if err := rows.Scan(&r.Rank, &r.Code, &r.Name, &r.Population, &r.Value, &r.Percentile); err != nil {
+			return nil, RankingMetadata{}, err
+		}
+		r.Percentile = roundPercentile(r.Percentile)
+		rankings = append(rankings, &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, RankingMetadata{}, err
+	}
+
+	return rankings, metadata, nil
+}
+
+func countryPopulationClause(f Filters) (string, []any) {
+	where := "WHERE TRUE"
+	var args []any
+
+	if f.MinPopulation != nil {
+		args = append(args, *f.MinPopulation)
+		where += fmt.Sprintf(" AND ctr.population >= $%d", len(args))
+	}
+	if f.MaxPopulation != nil {
+		args = append(args, *f.MaxPopulation)
+		where += fmt.Sprintf(" AND ctr.population <= $%d", len(args))
+	}
+
+	return where, args
+}
+
+func roundPercentile(fraction float64) float64 {
+	return math.Round(fraction*1000) / 10
+}
@@ -0,0 +1,107 @@
+package data
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func TestRankingIndicesCoverNumbeoIndices(t *testing.T) {
+	assert.DeepEqual(t, CityRankingIndices, floatFieldNames(NumbeoCityIndices{}))
+	assert.DeepEqual(t, CountryRankingIndices, floatFieldNames(NumbeoCountryIndices{}))
+}
+
+func floatFieldNames(v any) []string {
+	typ := reflect.TypeOf(v)
+	names := []string{}
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if field.Type != reflect.TypeFor[*float64]() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestValidateRankingQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      RankingQuery
+		wantErrors map[string]string
+	}{
+		{
+			name:       "valid",
+			query:      RankingQuery{Index: "safety", Order: "desc", Limit: 20},
+			wantErrors: map[string]string{},
+		},
+		{
+			name:       "country only index",
+			query:      RankingQuery{Index: "avg_salary_usd", Order: "asc", Limit: 20},
+			wantErrors: map[string]string{"index": "must be one of the supported indices"},
+		},
+		{
+			name:       "invalid order and limit",
+			query:      RankingQuery{Index: "rent", Order: "up", Limit: MaxRankingLimit + 1},
+			wantErrors: map[string]string{"order": "must be asc or desc", "limit": "must be between 1 and 250"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateRankingQuery(v, tt.query, CityRankingIndices)
+			assert.DeepEqual(t, v.Errors, tt.wantErrors)
+		})
+	}
+}
+
+func TestRankCities(t *testing.T) {
+	db := newTestDB(t)
+	cities := CityModel{DB: db}
+
+	rankings, metadata, err := cities.RankCities(RankingQuery{Index: "safety", Order: "desc", Limit: 10})
+	assert.NilError(t, err)
+	assert.Equal(t, len(rankings) <= 10, true)
+	assert.Equal(t, metadata.RankedCount >= len(rankings), true)
+	for i := 1; i < len(rankings); i++ {
+		assert.Equal(t, rankings[i-1].Value >= rankings[i].Value, true)
+		assert.Equal(t, rankings[i-1].Rank <= rankings[i].Rank, true)
+	}
+	if len(rankings) > 0 {
+		assert.Equal(t, rankings[0].Rank, 1)
+		assert.Equal(t, rankings[0].Percentile >= rankings[len(rankings)-1].Percentile, true)
+	}
+
+	asc, ascMetadata, err := cities.RankCities(RankingQuery{Index: "safety", Order: "asc", Limit: 1})
+	assert.NilError(t, err)
+	assert.Equal(t, ascMetadata.RankedCount, metadata.RankedCount)
+	assert.Equal(t, ascMetadata.UnrankedCount, metadata.UnrankedCount)
+	if len(asc) > 0 {
+		assert.Equal(t, asc[0].Percentile, 0.0)
+	}
+
+	_, _, err = cities.RankCities(RankingQuery{Index: "safety; DROP TABLE cities", Order: "desc", Limit: 1})
+	assert.Equal(t, err != nil, true)
+}
+
+func TestRankCountries(t *testing.T) {
+	db := newTestDB(t)
+	countries := CountryModel{DB: db}
+
+	minPopulation := int64(10_000_000)
+	rankings, _, err := countries.RankCountries(RankingQuery{
+		Index:   "quality_of_life",
+		Order:   "desc",
+		Limit:   250,
+		Filters: Filters{MinPopulation: &minPopulation},
+	})
+	assert.NilError(t, err)
+	for _, r := range rankings {
+		assert.Equal(t, *r.Population >= minPopulation, true)
+	}
+}
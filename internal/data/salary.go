@@ -0,0 +1,109 @@
+package data
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrMissingCostOfLiving = errors.New("no cost of living index for the city or its country")
+
+// SalaryEquivalence converts Amount earned in From into the amount needed in To.
+// EquivalentAmount keeps the same cost of living, based on
+// cost_of_living_plus_rent. LocalSalaryAmount keeps the same standing relative
+// to local salaries, which also takes local_purchasing_power into account; it is
+// nil when either city lacks that index.
+type SalaryEquivalence struct {
+	Amount            float64    `json:"amount"`
+	Currency          string     `json:"currency"`
+	EquivalentAmount  float64    `json:"equivalent_amount"`
+	CostOfLivingRatio float64    `json:"cost_of_living_ratio"`
+	LocalSalaryAmount *float64   `json:"local_salary_amount"`
+	LocalSalaryRatio  *float64   `json:"local_salary_ratio"`
+	From              SalaryCity `json:"from"`
+	To                SalaryCity `json:"to"`
+}
+
+type SalaryCity struct {
+	GeonameID            int64        `json:"geoname_id"`
+	Name                 string       `json:"city"`
+	CountryCode          string       `json:"country_code"`
+	CountryName          string       `json:"country"`
+	CostOfLivingPlusRent SourcedIndex `json:"cost_of_living_plus_rent"`
+	LocalPurchasingPower SourcedIndex `json:"local_purchasing_power"`
+}
+
+// SourcedIndex is an index value together with the table it was read from
+// ("city" or "country") and the date of that data.
+type SourcedIndex struct {
+	Value      *float64 `json:"value"`
+	Source     string   `json:"source,omitempty"`
+	LastUpdate string   `json:"last_update,omitempty"`
+}
+
+// NewSalaryCity reads the indices of city, falling back to the indices of its
+// country for every value the city lacks. country may be nil.
+func NewSalaryCity(city *City, country *Country) SalaryCity {
+	salaryCity := SalaryCity{
+		GeonameID:   city.GeonameID,
+		Name:        city.Name,
+		CountryCode: city.CountryCode,
+		CountryName: city.CountryName,
+	}
+
+	var cityCost, cityPower, countryCost, countryPower SourcedIndex
+	if indices := city.NumbeoCityIndices; indices != nil {
+		cityCost = SourcedIndex{Value: indices.CostOfLivingPlusRent, Source: "city", LastUpdate: indices.LastUpdate}
+		cityPower = SourcedIndex{Value: indices.LocalPurchasingPower, Source: "city", LastUpdate: indices.LastUpdate}
+	}
+	if country != nil && country.NumbeoCountryIndices != nil {
+		indices := country.NumbeoCountryIndices
+		countryCost = SourcedIndex{Value: indices.CostOfLivingPlusRent, Source: "country", LastUpdate: indices.LastUpdate}
+		countryPower = SourcedIndex{Value: indices.LocalPurchasingPower, Source: "country", LastUpdate: indices.LastUpdate}
+	}
+
+	salaryCity.CostOfLivingPlusRent = firstSourcedIndex(cityCost, countryCost)
+	salaryCity.LocalPurchasingPower = firstSourcedIndex(cityPower, countryPower)
+
+	return salaryCity
+}
+
+func firstSourcedIndex(indices ...SourcedIndex) SourcedIndex {
+	for _, index := range indices {
+		if index.Value != nil {
+			return index
+		}
+	}
+	return SourcedIndex{}
+}
+
+// NewSalaryEquivalence returns ErrMissingCostOfLiving if from or to has no
+// cost_of_living_plus_rent value, or a zero one.
+func NewSalaryEquivalence(from, to SalaryCity, amount float64, currency string) (*SalaryEquivalence, error) {
+	fromCost, toCost := from.CostOfLivingPlusRent.Value, to.CostOfLivingPlusRent.Value
+	if fromCost == nil || toCost == nil || *fromCost == 0 {
+		return nil, ErrMissingCostOfLiving
+	}
+
+	costRatio := *toCost / *fromCost
+	equivalence := &SalaryEquivalence{
+		Amount:            amount,
+		Currency:          currency,
+		EquivalentAmount:  roundCents(amount * costRatio),
+		CostOfLivingRatio: math.Round(costRatio*10000) / 10000,
+		From:              from,
+		To:                to,
+	}
+
+	// Numbeo's purchasing power is the local salary relative to local prices, so
+	// the product of both indices tracks local salaries.
+	fromPower, toPower := from.LocalPurchasingPower.Value, to.LocalPurchasingPower.Value
+	if fromPower != nil && toPower != nil && *fromPower != 0 {
+		salaryRatio := costRatio * *toPower / *fromPower
+		localAmount := roundCents(amount * salaryRatio)
+		roundedRatio := math.Round(salaryRatio*10000) / 10000
+		equivalence.LocalSalaryAmount = &localAmount
+		equivalence.LocalSalaryRatio = &roundedRatio
+	}
+
+	return equivalence, nil
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+func TestNewSalaryCityFallsBackToCountry(t *testing.T) {
+	city := &City{
+		GeonameID:         2950159,
+		Name:              "Berlin",
+		CountryCode:       "DEU",
+		NumbeoCityIndices: &NumbeoCityIndices{CostOfLivingPlusRent: floatPtr(50), LastUpdate: "2025-01-10"},
+	}
+	country := &Country{
+		Code:                 "DEU",
+		NumbeoCountryIndices: &NumbeoCountryIndices{CostOfLivingPlusRent: floatPtr(45), LocalPurchasingPower: floatPtr(110), LastUpdate: "2024-12-01"},
+	}
+
+	salaryCity := NewSalaryCity(city, country)
+
+	assert.Equal(t, *salaryCity.CostOfLivingPlusRent.Value, 50.0)
+	assert.Equal(t, salaryCity.CostOfLivingPlusRent.Source, "city")
+	assert.Equal(t, salaryCity.CostOfLivingPlusRent.LastUpdate, "2025-01-10")
+	assert.Equal(t, *salaryCity.LocalPurchasingPower.Value, 110.0)
+	assert.Equal(t, salaryCity.LocalPurchasingPower.Source, "country")
+	assert.Equal(t, salaryCity.LocalPurchasingPower.LastUpdate, "2024-12-01")
+
+	empty := NewSalaryCity(&City{GeonameID: 1}, nil)
+	assert.Equal(t, empty.CostOfLivingPlusRent.Value == nil, true)
+	assert.Equal(t, empty.CostOfLivingPlusRent.Source, "")
+}
+
+func TestNewSalaryEquivalence(t *testing.T) {
+	from := SalaryCity{
+		CostOfLivingPlusRent: SourcedIndex{Value: floatPtr(50)},
+		LocalPurchasingPower: SourcedIndex{Value: floatPtr(100)},
+	}
+	to := SalaryCity{
+		CostOfLivingPlusRent: SourcedIndex{Value: floatPtr(75)},
+		LocalPurchasingPower: SourcedIndex{Value: floatPtr(80)},
+	}
+
+	equivalence, err := NewSalaryEquivalence(from, to, 4000, "EUR")
+	assert.NilError(t, err)
+	assert.Equal(t, equivalence.EquivalentAmount, 6000.0)
+	assert.Equal(t, equivalence.CostOfLivingRatio, 1.5)
+	assert.Equal(t, *equivalence.LocalSalaryAmount, 4800.0)
+	assert.Equal(t, *equivalence.LocalSalaryRatio, 1.2)
+
+	to.LocalPurchasingPower = SourcedIndex{}
+	equivalence, err = NewSalaryEquivalence(from, to, 4000, "EUR")
+	assert.NilError(t, err)
+	assert.Equal(t, equivalence.LocalSalaryAmount == nil, true)
+
+	to.CostOfLivingPlusRent = SourcedIndex{}
+	_, err = NewSalaryEquivalence(from, to, 4000, "EUR")
+	assert.Equal(t, errors.Is(err, ErrMissingCostOfLiving), true)
+}
@@ -0,0 +1,317 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+const MaxScoreWeight = 100
+
+// DefaultMinScoreCoverage is the coverage a score needs to be ranked among the
+// well-covered rows, see compareScores.
+const DefaultMinScoreCoverage = 0.5
+
+// ScoreWeight gives Index a share of the score. A negative weight rewards low
+// values, as for cost_of_living or pollution.
+type ScoreWeight struct {
+	Index  string
+	Weight float64
+}
+
+// WeightedScore is a weighted composite of Numbeo indices, from 0 to 100. Each
+// index is min-max normalized across every row of its table. A component
+// contributes |weight| * normalized value, or |weight| * (1 - normalized value)
+// for negative weights, and Score is the sum of contributions divided by the
+// absolute weights of the components that have a value. Components without a
+// value are skipped; Coverage is the share of the absolute weight that was
+// available, and Score is nil when Coverage is zero.
+type WeightedScore struct {
+	Score      *float64         `json:"score"`
+	Coverage   float64          `json:"coverage"`
+	Components []ScoreComponent `json:"components"`
+}
+
+type ScoreComponent struct {
+	Index        string   `json:"index"`
+	Weight       float64  `json:"weight"`
+	Value        *float64 `json:"value"`
+	Normalized   *float64 `json:"normalized"`
+	Contribution *float64 `json:"contribution"`
+}
+
+type CityScore struct {
+	GeonameID   int64  `json:"geoname_id"`
+	Name        string `json:"city"`
+	CountryCode string `json:"country_code"`
+	CountryName string `json:"country"`
+	WeightedScore
+}
+
+type CountryScore struct {
+	Code string `json:"country_code"`
+	Name string `json:"country"`
+	WeightedScore
+}
+
+type indexRange struct {
+	min, max *float64
+}
+
+func ValidateScoreWeights(v *validator.Validator, weights []ScoreWeight, indices []string) {
+	v.Check(len(weights) > 0, "weights", "must be provided")
+
+	seen := make(map[string]struct{}, len(weights))
+	for _, w := range weights {
+		v.Check(slices.Contains(indices, w.Index), "weights", fmt.Sprintf("unsupported index %q", w.Index))
+		v.Check(w.Weight != 0, "weights", "weights must not be zero")
+		v.Check(math.Abs(w.Weight) <= MaxScoreWeight, "weights", fmt.Sprintf("weights must be between -%d and %d", MaxScoreWeight, MaxScoreWeight))
+
+		_, duplicate := seen[w.Index]
+		v.Check(!duplicate, "weights", fmt.Sprintf("index %q is weighted more than once", w.Index))
+		seen[w.Index] = struct{}{}
+	}
+}
+
+func newWeightedScore(weights []ScoreWeight, values []*float64, ranges []indexRange) WeightedScore {
+	score := WeightedScore{Components: make([]ScoreComponent, 0, len(weights))}
+
+	var total, available, sum float64
+	for i, w := range weights {
+		component := ScoreComponent{Index: w.Index, Weight: w.Weight, Value: values[i]}
+		total += math.Abs(w.Weight)
+
+		if r := ranges[i]; values[i] != nil && r.min != nil && r.max != nil {
+			normalized := 1.0
+			if *r.max > *r.min {
+				normalized = (*values[i] - *r.min) / (*r.max - *r.min)
+			}
+			if w.Weight < 0 {
+				normalized = 1 - normalized
+			}
+			contribution := math.Abs(w.Weight) * normalized
+
+			available += math.Abs(w.Weight)
+			sum += contribution
+			component.Normalized = roundScore(normalized)
+			component.Contribution = roundScore(contribution)
+		}
+
+		score.Components = append(score.Components, component)
+	}
+
+	if total > 0 {
+		score.Coverage = *roundScore(available / total)
+	}
+	if available > 0 {
+		score.Score = roundScore(100 * sum / available)
+	}
+
+	return score
+}
+
+func roundScore(value float64) *float64 {
+	rounded := math.Round(value*10000) / 10000
+	return &rounded
+}
+
+// compareScores orders by score, highest first. A score renormalized from
+// fewer than minCoverage of the weights ranks after every score that reaches
+// it, so that a row with a single good index cannot top the list; unscored rows
+// come last.
+func compareScores(a, b WeightedScore, minCoverage float64) int {
+	if c := cmp.Compare(scoreTier(a, minCoverage), scoreTier(b, minCoverage)); c != 0 || a.Score == nil {
+		return c
+	}
+	return cmp.Compare(*b.Score, *a.Score)
+}
+
+func scoreTier(s WeightedScore, minCoverage float64) int {
+	switch {
+	case s.Score == nil:
+		return 2
+	case s.Coverage < minCoverage:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func scoreColumns(weights []ScoreWeight, alias string, indices []string) ([]string, error) {
+	columns := make([]string, 0, len(weights))
+	for _, w := range weights {
+		// Only names from indices are used as column names.
+		if !slices.Contains(indices, w.Index) {
+			return nil, fmt.Errorf("unsupported score index %q", w.Index)
+		}
+		columns = append(columns, alias+"."+w.Index)
+	}
+	return columns, nil
+}
+
+// indexRanges returns the minimum and maximum of every column across table.
+func indexRanges(ctx context.Context, db *sql.DB, table string, columns []string) ([]indexRange, error) {
+	aggregates := make([]string, 0, 2*len(columns))
+	for _, column := range columns {
+		aggregates = append(aggregates, "MIN("+column+")", "MAX("+column+")")
+	}
+
+	ranges := make([]indexRange, len(columns))
+	dest := make([]any, 0, 2*len(columns))
+	for i := range ranges {
+		dest = append(dest, &ranges[i].min, &ranges[i].max)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s;", strings.Join(aggregates, ", "), table)
+	if err := db.QueryRowContext(ctx, query).Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	return ranges, nil
+}
+
+// ScoreCities scores the cities with ids, or every city with Numbeo indices when
+// ids is empty, and returns up to limit of them, best first as ordered by
+// compareScores.
+func (c CityModel) ScoreCities(weights []ScoreWeight, ids []int64, limit int, minCoverage float64) (scores []*CityScore, retErr error) {
+	columns, err := scoreColumns(weights, "nic", CityRankingIndices)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ranges, err := indexRanges(ctx, c.DB, "numbeo_city_indices nic", columns)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT c.geoname_id, c.city, c.country_code, COALESCE(ctr.country, ''), %s
+		FROM cities c
+		LEFT JOIN numbeo_city_indices nic ON nic.geoname_id = c.geoname_id
+		LEFT JOIN countries ctr ON ctr.country_code = c.country_code
+		WHERE ($1::bigint[] IS NULL AND nic.geoname_id IS NOT NULL) OR c.geoname_id = ANY($1);`,
+		strings.Join(columns, ", "))
+
+	var idsArg any
+	if len(ids) > 0 {
+		idsArg = pq.Array(ids)
+	}
+
+	rows, err := c.DB.QueryContext(ctx, query, idsArg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	scores = []*CityScore{}
+	for rows.Next() {
+		var s CityScore
+		values := make([]*float64, len(columns))
+		dest := []any{&s.GeonameID, &s.Name, &s.CountryCode, &s.CountryName}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		s.WeightedScore = newWeightedScore(weights, values, ranges)
+		scores = append(scores, &s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(scores, func(a, b *CityScore) int {
+		return cmp.Or(compareScores(a.WeightedScore, b.WeightedScore, minCoverage), cmp.Compare(a.GeonameID, b.GeonameID))
+	})
+	if limit > 0 && len(scores) > limit {
+		scores = scores[:limit]
+	}
+
+	return scores, nil
+}
+
+// ScoreCountries scores the countries with codes, or every country with Numbeo
+// indices when codes is empty, and returns up to limit of them, best first as
+// ordered by compareScores.
+func (c CountryModel) ScoreCountries(weights []ScoreWeight, codes []string, limit int, minCoverage float64) (scores []*CountryScore, retErr error) {
+	columns, err := scoreColumns(weights, "nci", CountryRankingIndices)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ranges, err := indexRanges(ctx, c.DB, "numbeo_country_indices nci", columns)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT ctr.country_code, ctr.country, %s
+		FROM countries ctr
+		LEFT JOIN numbeo_country_indices nci ON nci.country_code = ctr.country_code
+		WHERE ($1::text[] IS NULL AND nci.country_code IS NOT NULL) OR ctr.country_code = ANY($1);`,
+		strings.Join(columns, ", "))
+
+	var codesArg any
+	if len(codes) > 0 {
+		codesArg = pq.Array(codes)
+	}
+
+	rows, err := c.DB.QueryContext(ctx, query, codesArg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	scores = []*CountryScore{}
+	for rows.Next() {
+		var s CountryScore
+		values := make([]*float64, len(columns))
+		dest := []any{&s.Code, &s.Name}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		s.WeightedScore = newWeightedScore(weights, values, ranges)
+		scores = append(scores, &s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(scores, func(a, b *CountryScore) int {
+		return cmp.Or(compareScores(a.WeightedScore, b.WeightedScore, minCoverage), cmp.Compare(a.Code, b.Code))
+	})
+	if limit > 0 && len(scores) > limit {
+		scores = scores[:limit]
+	}
+
+	return scores, nil
+}
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+func TestNewWeightedScore(t *testing.T) {
+	weights := []ScoreWeight{
+		{Index: "safety", Weight: 0.5},
+		{Index: "cost_of_living", Weight: -0.3},
+		{Index: "pollution", Weight: -0.2},
+	}
+	ranges := []indexRange{
+		{min: floatPtr(20), max: floatPtr(80)},
+		{min: floatPtr(20), max: floatPtr(120)},
+		{min: nil, max: nil},
+	}
+
+	score := newWeightedScore(weights, []*float64{floatPtr(65), floatPtr(45), floatPtr(30)}, ranges)
+
+	assert.Equal(t, *score.Components[0].Normalized, 0.75)
+	assert.Equal(t, *score.Components[0].Contribution, 0.375)
+	assert.Equal(t, *score.Components[1].Normalized, 0.75)
+	assert.Equal(t, *score.Components[1].Contribution, 0.225)
+	assert.Equal(t, score.Components[2].Contribution == nil, true)
+	assert.Equal(t, score.Coverage, 0.8)
+	assert.Equal(t, *score.Score, 75.0)
+
+	missing := newWeightedScore(weights, []*float64{nil, nil, nil}, ranges)
+	assert.Equal(t, missing.Coverage, 0.0)
+	assert.Equal(t, missing.Score == nil, true)
+}
+
+func TestNewWeightedScoreConstantIndex(t *testing.T) {
+	score := newWeightedScore(
+		[]ScoreWeight{{Index: "safety", Weight: 1}},
+		[]*float64{floatPtr(50)},
+		[]indexRange{{min: floatPtr(50), max: floatPtr(50)}},
+	)
+
+	assert.Equal(t, *score.Score, 100.0)
+}
+
+func TestCompareScores(t *testing.T) {
+	high := WeightedScore{Score: floatPtr(80), Coverage: 1}
+	low := WeightedScore{Score: floatPtr(20), Coverage: 0.6}
+	partial := WeightedScore{Score: floatPtr(100), Coverage: 0.2}
+	none := WeightedScore{}
+
+	assert.Equal(t, compareScores(high, low, 0.5), -1)
+	assert.Equal(t, compareScores(low, high, 0.5), 1)
+	assert.Equal(t, compareScores(none, low, 0.5), 1)
+	assert.Equal(t, compareScores(none, none, 0.5), 0)
+	assert.Equal(t, compareScores(partial, low, 0.5), 1)
+	assert.Equal(t, compareScores(partial, none, 0.5), -1)
+	assert.Equal(t, compareScores(partial, high, 0), -1)
+}
+
+func TestValidateScoreWeights(t *testing.T) {
+	tests := []struct {
+		name       string
+		weights    []ScoreWeight
+		wantErrors map[string]string
+	}{
+		{name: "valid", weights: []ScoreWeight{{Index: "safety", Weight: 0.4}, {Index: "rent", Weight: -0.6}}, wantErrors: map[string]string{}},
+		{name: "missing", weights: nil, wantErrors: map[string]string{"weights": "must be provided"}},
+		{name: "unsupported index", weights: []ScoreWeight{{Index: "tides", Weight: 1}}, wantErrors: map[string]string{"weights": `unsupported index "tides"`}},
+		{name: "zero weight", weights: []ScoreWeight{{Index: "safety", Weight: 0}}, wantErrors: map[string]string{"weights": "weights must not be zero"}},
+		{name: "duplicate index", weights: []ScoreWeight{{Index: "safety", Weight: 1}, {Index: "safety", Weight: 2}}, wantErrors: map[string]string{"weights": `index "safety" is weighted more than once`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateScoreWeights(v, tt.weights, CityRankingIndices)
+			assert.DeepEqual(t, v.Errors, tt.wantErrors)
+		})
+	}
+}
@@ -0,0 +1,625 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	SearchTypeCity    = "city"
+	SearchTypeCountry = "country"
+	SearchTypeState   = "state"
+)
+
+const (
+	searchMatchExact      = "exact"
+	searchMatchPrefix     = "prefix"
+	searchMatchWordPrefix = "word_prefix"
+	searchMatchFuzzy      = "fuzzy"
+)
+
+type SearchResult struct {
+	Type        string  `json:"type"`
+	Name        string  `json:"name"`
+	GeonameID   *int64  `json:"geoname_id,omitzero"`
+	StateCode   *string `json:"state_code,omitzero"`
+	CountryCode *string `json:"country_code,omitzero"`
+	Country     *string `json:"country,omitzero"`
+	Population  *int64  `json:"population"`
+	MatchedOn   string  `json:"matched_on"`
+	Match       string  `json:"match"`
+}
+
+type searchKey struct {
+	field     string
+	text      []rune
+	words     [][]rune
+	exactOnly bool
+}
+
+type searchEntry struct {
+	result SearchResult
+	keys   []searchKey
+}
+
+// searchToken is a key text or one of its later words, pointing back at the
+// entry and key it came from.
+type searchToken struct {
+	text  []rune
+	entry int
+	key   int
+	word  bool
+}
+
+type searchHit struct {
+	entry    *searchEntry
+	order    int
+	tier     int
+	distance int
+	field    string
+}
+
+// SearchIndex keeps its tokens sorted, so the prefix tiers and the fuzzy
+// candidates are found by binary search instead of a scan over every entry.
+type SearchIndex struct {
+	entries []searchEntry
+	tokens  []searchToken
+}
+
+func NewSearchIndex(cities []*City, countries []*Country, states []*State) *SearchIndex {
+	idx := &SearchIndex{
+		entries: make([]searchEntry, 0, len(cities)+len(countries)+len(states)),
+	}
+
+	for _, city := range cities {
+		geonameID := city.GeonameID
+		countryCode := city.CountryCode
+		idx.add(SearchResult{
+			Type:        SearchTypeCity,
+			Name:        city.Name,
+			GeonameID:   &geonameID,
+			StateCode:   city.StateCode,
+			CountryCode: &countryCode,
+			Country:     nonEmptyStringPtr(city.CountryName),
+			Population:  city.Population,
+		}, newSearchKey("name", city.Name, false))
+	}
+
+	for _, country := range countries {
+		countryCode := country.Code
+		keys := []searchKey{
+			newSearchKey("name", country.Name, false),
+			newSearchKey("country_code", country.Code, true),
+		}
+		if country.Alpha2Code != nil && *country.Alpha2Code != "" {
+			keys = append(keys, newSearchKey("alpha2_code", *country.Alpha2Code, true))
+		}
+		idx.add(SearchResult{
+			Type:        SearchTypeCountry,
+			Name:        country.Name,
+			CountryCode: &countryCode,
+			Population:  country.Population,
+		}, keys...)
+	}
+
+	for _, state := range states {
+		stateCode := state.Code
+		idx.add(SearchResult{
+			Type:        SearchTypeState,
+			Name:        state.Name,
+			StateCode:   &stateCode,
+			CountryCode: state.CountryCode,
+			Population:  state.Population,
+		}, newSearchKey("name", state.Name, false))
+	}
+
+	slices.SortFunc(idx.tokens, func(a, b searchToken) int {
+		return slices.Compare(a.text, b.text)
+	})
+
+	return idx
+}
+
+func (idx *SearchIndex) add(result SearchResult, keys ...searchKey) {
+	filtered := keys[:0]
+	for _, key := range keys {
+		if len(key.text) > 0 {
+			filtered = append(filtered, key)
+		}
+	}
+	if len(filtered) == 0 {
+		return
+	}
+
+	entry := len(idx.entries)
+	idx.entries = append(idx.entries, searchEntry{result: result, keys: filtered})
+	for i, key := range filtered {
+		idx.tokens = append(idx.tokens, searchToken{text: key.text, entry: entry, key: i})
+		for _, word := range key.words {
+			idx.tokens = append(idx.tokens, searchToken{text: word, entry: entry, key: i, word: true})
+		}
+	}
+}
+
+// Search returns up to limit entries whose names start with the query, ignoring
+// case and accents. Typos are tolerated for queries of four or more characters,
+// as long as the first character is right. Results are ordered by match quality
+// first and population second.
+func (idx *SearchIndex) Search(query string, types IncludeSet, limit int) []SearchResult {
+	q := []rune(NormalizeSearchText(query))
+	if len(q) == 0 || limit <= 0 {
+		return []SearchResult{}
+	}
+	maxEdits := searchMaxEdits(len(q))
+
+	best := make(map[int]searchHit)
+	record := func(token searchToken, tier, distance int) {
+		entry := &idx.entries[token.entry]
+		if len(types) > 0 && !types.Has(entry.result.Type) {
+			return
+		}
+		hit, ok := best[token.entry]
+		if ok && (hit.tier < tier || (hit.tier == tier && hit.distance <= distance)) {
+			return
+		}
+		best[token.entry] = searchHit{entry: entry, order: token.entry, tier: tier, distance: distance, field: entry.keys[token.key].field}
+	}
+
+	// Every token that starts with q is an exact, prefix or word prefix hit.
+	for _, token := range idx.tokenRange(q) {
+		switch {
+		case len(token.text) == len(q) && !token.word:
+			record(token, 0, 0)
+		case idx.entries[token.entry].keys[token.key].exactOnly:
+		case token.word:
+			record(token, 2, 0)
+		default:
+			record(token, 1, 0)
+		}
+	}
+
+	if maxEdits > 0 {
+		var buf []int
+		for _, token := range idx.tokenRange(q[:1]) {
+			if idx.entries[token.entry].keys[token.key].exactOnly || len(token.text) < len(q)-maxEdits {
+				continue
+			}
+			if hasRunePrefix(token.text, q) {
+				continue
+			}
+			if distance := prefixEditDistance(q, token.text, maxEdits, &buf); distance <= maxEdits {
+				record(token, 3, distance)
+			}
+		}
+	}
+
+	hits := slices.Collect(maps.Values(best))
+	slices.SortFunc(hits, compareSearchHits)
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	results := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		result := hit.entry.result
+		result.MatchedOn = hit.field
+		result.Match = searchMatchNames[hit.tier]
+		results = append(results, result)
+	}
+
+	return results
+}
+
+var searchMatchNames = []string{searchMatchExact, searchMatchPrefix, searchMatchWordPrefix, searchMatchFuzzy}
+
+// tokenRange returns the sorted tokens that start with prefix.
+func (idx *SearchIndex) tokenRange(prefix []rune) []searchToken {
+	start, _ := slices.BinarySearchFunc(idx.tokens, prefix, func(token searchToken, prefix []rune) int {
+		return slices.Compare(token.text, prefix)
+	})
+	end := start
+	for end < len(idx.tokens) && hasRunePrefix(idx.tokens[end].text, prefix) {
+		end++
+	}
+	return idx.tokens[start:end]
+}
+
+func compareSearchHits(a, b searchHit) int {
+	if a.tier != b.tier {
+		return a.tier - b.tier
+	}
+	if a.distance != b.distance {
+		return a.distance - b.distance
+	}
+
+	pa, pb := a.entry.result.Population, b.entry.result.Population
+	switch {
+	case pa != nil && pb == nil:
+		return -1
+	case pa == nil && pb != nil:
+		return 1
+	case pa != nil && pb != nil && *pa != *pb:
+		if *pa > *pb {
+			return -1
+		}
+		return 1
+	}
+
+	if c := strings.Compare(a.entry.result.Name, b.entry.result.Name); c != 0 {
+		return c
+	}
+	return a.order - b.order
+}
+
+func searchMaxEdits(queryLen int) int {
+	switch {
+	case queryLen < 4:
+		return 0
+	case queryLen < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// prefixEditDistance returns the smallest optimal string alignment distance
+// between q and any prefix of text, or maxEdits+1 as soon as that distance is
+// known to exceed maxEdits. Prefixes longer than len(q)+maxEdits can't be
+// within reach, so only that many columns are computed. buf keeps the three
+// rows the recurrence needs between calls.
+func prefixEditDistance(q, text []rune, maxEdits int, buf *[]int) int {
+	text = text[:min(len(text), len(q)+maxEdits)]
+	cols := len(text) + 1
+	if cap(*buf) < 3*cols {
+		*buf = make([]int, 3*cols)
+	}
+	rows := (*buf)[:3*cols]
+	prev2, prev, cur := rows[:cols], rows[cols:2*cols], rows[2*cols:]
+
+	for j := range cols {
+		prev[j] = j
+	}
+
+	prevMin := 0
+	for i := 1; i <= len(q); i++ {
+		cur[0] = i
+		curMin := i
+		for j := 1; j < cols; j++ {
+			cost := 1
+			if q[i-1] == text[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && q[i-1] == text[j-2] && q[i-2] == text[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			curMin = min(curMin, cur[j])
+		}
+
+		// Later rows build on this row or, through a transposition, on the
+		// previous one plus an edit, so neither can get back under the limit.
+		if min(curMin, prevMin+1) > maxEdits {
+			return maxEdits + 1
+		}
+		prevMin = curMin
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return slices.Min(prev)
+}
+
+func hasRunePrefix(s, prefix []rune) bool {
+	return len(s) >= len(prefix) && slices.Equal(s[:len(prefix)], prefix)
+}
+
+func newSearchKey(field, value string, exactOnly bool) searchKey {
+	normalized := NormalizeSearchText(value)
+	key := searchKey{field: field, text: []rune(normalized), exactOnly: exactOnly}
+	if !exactOnly {
+		words := strings.Fields(normalized)
+		if len(words) > 1 {
+			for _, word := range words[1:] {
+				key.words = append(key.words, []rune(word))
+			}
+		}
+	}
+
+	return key
+}
+
+var searchFoldTable = func() map[rune]string {
+	groups := map[string]string{
+		"àáâãäåāăąǎ":  "a",
+		"æ":           "ae",
+		"çćĉċč":       "c",
+		"ďđð":         "d",
+		"èéêëēĕėęě":   "e",
+		"ĝğġģ":        "g",
+		"ĥħ":          "h",
+		"ìíîïĩīĭįıǐ":  "i",
+		"ĵ":           "j",
+		"ķ":           "k",
+		"ĺļľŀł":       "l",
+		"ñńņňŉ":       "n",
+		"òóôõöøōŏőǒ":  "o",
+		"œ":           "oe",
+		"ŕŗř":         "r",
+		"śŝşšș":       "s",
+		"ß":           "ss",
+		"ţťŧț":        "t",
+		"þ":           "th",
+		"ùúûüũūŭůűųǔ": "u",
+		"ŵ":           "w",
+		"ýÿŷ":         "y",
+		"źżž":         "z",
+	}
+
+	table := make(map[rune]string)
+	for chars, folded := range groups {
+		for _, r := range chars {
+			table[r] = folded
+		}
+	}
+	return table
+}()
+
+// NormalizeSearchText lowercases s, strips common Latin diacritics and
+// collapses punctuation and whitespace into single spaces.
+func NormalizeSearchText(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	pendingSpace := false
+	for _, r := range strings.ToLower(s) {
+		if folded, ok := searchFoldTable[r]; ok {
+			if pendingSpace && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			pendingSpace = false
+			b.WriteString(folded)
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingSpace && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			pendingSpace = false
+			b.WriteRune(r)
+			continue
+		}
+		if unicode.Is(unicode.Mn, r) || r == '\'' || r == '’' {
+			continue
+		}
+		pendingSpace = true
+	}
+
+	return b.String()
+}
+
+func nonEmptyStringPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// searchRetryInterval is how long a stale index keeps being served after a
+// failed reload before the next attempt.
+const searchRetryInterval = 30 * time.Second
+
+type searchCache struct {
+	mu      sync.Mutex
+	index   *SearchIndex
+	expires time.Time
+	loading *searchLoad
+}
+
+// searchLoad is a reload in progress. done is closed once index and err are
+// set.
+type searchLoad struct {
+	done  chan struct{}
+	index *SearchIndex
+	err   error
+}
+
+type SearchModel struct {
+	DB              *sql.DB
+	RefreshInterval time.Duration
+
+	cache *searchCache
+}
+
+func (m SearchModel) Search(ctx context.Context, query string, types IncludeSet, limit int) ([]SearchResult, error) {
+	idx, err := m.index(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.Search(query, types, limit), nil
+}
+
+// index returns the cached index, starting a reload once it has expired. Only
+// one reload runs at a time and the lock is never held while it does: a stale
+// index is served meanwhile, and callers without any index wait for the
+// reload or for their own context.
+func (m SearchModel) index(ctx context.Context) (*SearchIndex, error) {
+	if m.cache == nil {
+		return m.LoadIndex(ctx)
+	}
+
+	m.cache.mu.Lock()
+	idx := m.cache.index
+	if idx != nil && time.Now().Before(m.cache.expires) {
+		m.cache.mu.Unlock()
+		return idx, nil
+	}
+	load := m.cache.loading
+	if load == nil {
+		load = &searchLoad{done: make(chan struct{})}
+		m.cache.loading = load
+		// The reload is shared, so it keeps the request's values but must
+		// not be cancelled along with the request that started it.
+		go m.reload(context.WithoutCancel(ctx), load)
+	}
+	m.cache.mu.Unlock()
+
+	if idx != nil {
+		return idx, nil
+	}
+
+	select {
+	case <-load.done:
+		return load.index, load.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m SearchModel) reload(ctx context.Context, load *searchLoad) {
+	load.index, load.err = m.LoadIndex(ctx)
+
+	m.cache.mu.Lock()
+	defer m.cache.mu.Unlock()
+
+	m.cache.loading = nil
+	switch {
+	case load.err == nil:
+		m.cache.index = load.index
+		m.cache.expires = time.Now().Add(m.RefreshInterval)
+	case m.cache.index != nil:
+		m.cache.expires = time.Now().Add(searchRetryInterval)
+	}
+	close(load.done)
+}
+
+func (m SearchModel) LoadIndex(ctx context.Context) (*SearchIndex, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cities, err := m.loadCities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	countries, err := m.loadCountries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := m.loadStates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSearchIndex(cities, countries, states), nil
+}
+
+func (m SearchModel) loadCities(ctx context.Context) (cities []*City, retErr error) {
+	query := `
+		SELECT c.geoname_id, c.city, c.state_code, c.country_code,
+		       COALESCE(ctr.country, '') AS country, c.population
+		FROM cities c
+		LEFT JOIN countries ctr ON ctr.country_code = c.country_code;`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	cities = []*City{}
+	for rows.Next() {
+		var city City
+		if err := rows.Scan(
+			&city.GeonameID,
+			&city.Name,
+			&city.StateCode,
+			&city.CountryCode,
+			&city.CountryName,
+			&city.Population,
+		); err != nil {
+			return nil, err
+		}
+		cities = append(cities, &city)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cities, nil
+}
+
+func (m SearchModel) loadCountries(ctx context.Context) (countries []*Country, retErr error) {
+	query := `
+		SELECT country_code, alpha2_code, country, population
+		FROM countries;`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	countries = []*Country{}
+	for rows.Next() {
+		var country Country
+		if err := rows.Scan(&country.Code, &country.Alpha2Code, &country.Name, &country.Population); err != nil {
+			return nil, err
+		}
+		countries = append(countries, &country)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return countries, nil
+}
+
+func (m SearchModel) loadStates(ctx context.Context) (states []*State, retErr error) {
+	query := `
+		SELECT s.state_code, s.state_name, MIN(c.country_code), SUM(c.population)::bigint
+		FROM states s
+		LEFT JOIN cities c ON c.state_code = s.state_code
+		GROUP BY s.state_code, s.state_name;`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	states = []*State{}
+	for rows.Next() {
+		var state State
+		if err := rows.Scan(&state.Code, &state.Name, &state.CountryCode, &state.Population); err != nil {
+			return nil, err
+		}
+		states = append(states, &state)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
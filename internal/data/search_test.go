@@ -0,0 +1,198 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+func newTestSearchIndex() *SearchIndex {
+	population := func(n int64) *int64 { return &n }
+	alpha2 := func(s string) *string { return &s }
+	stateCode := "US-NY"
+	usa := "USA"
+
+	cities := []*City{
+		{GeonameID: 2988507, Name: "Paris", CountryCode: "FRA", CountryName: "France", Population: population(2138551)},
+		{GeonameID: 4717560, Name: "Paris", CountryCode: "USA", CountryName: "United States of America", Population: population(24171)},
+		{GeonameID: 3067696, Name: "Prague", CountryCode: "CZE", CountryName: "Czechia", Population: population(1165581)},
+		{GeonameID: 1850147, Name: "Tokyo", CountryCode: "JPN", CountryName: "Japan", Population: population(9733276)},
+		{GeonameID: 2867714, Name: "München", CountryCode: "DEU", CountryName: "Germany", Population: population(1260391)},
+		{GeonameID: 3117735, Name: "Madrid", CountryCode: "ESP", CountryName: "Spain", Population: population(3255944)},
+		{GeonameID: 5128581, Name: "New York", StateCode: &stateCode, CountryCode: "USA", CountryName: "United States of America", Population: population(8804190)},
+		{GeonameID: 3688689, Name: "Bogotá", CountryCode: "COL", CountryName: "Colombia", Population: population(7674366)},
+	}
+	countries := []*Country{
+		{Code: "USA", Alpha2Code: alpha2("US"), Name: "United States of America", Population: population(331002651)},
+		{Code: "FRA", Alpha2Code: alpha2("FR"), Name: "France", Population: population(65273511)},
+		{Code: "JPN", Alpha2Code: alpha2("JP"), Name: "Japan", Population: population(126476461)},
+	}
+	states := []*State{
+		{Code: stateCode, Name: "New York", CountryCode: &usa, Population: population(8804190)},
+	}
+
+	return NewSearchIndex(cities, countries, states)
+}
+
+func TestNormalizeSearchText(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "München", want: "munchen"},
+		{input: "  Bogotá,  D.C. ", want: "bogota d c"},
+		{input: "Kraków", want: "krakow"},
+		{input: "ŁÓDŹ", want: "lodz"},
+		{input: "Straße", want: "strasse"},
+		{input: "Cote d'Ivoire", want: "cote divoire"},
+		{input: "?!", want: ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, NormalizeSearchText(tt.input), tt.want)
+	}
+}
+
+func TestSearchIndexPrefixRankedByPopulation(t *testing.T) {
+	idx := newTestSearchIndex()
+
+	results := idx.Search("par", nil, 10)
+	assert.Equal(t, len(results), 2)
+	assert.Equal(t, *results[0].GeonameID, int64(2988507))
+	assert.Equal(t, *results[1].GeonameID, int64(4717560))
+	assert.Equal(t, results[0].Match, "prefix")
+}
+
+func TestSearchIndexIgnoresAccents(t *testing.T) {
+	idx := newTestSearchIndex()
+
+	results := idx.Search("munc", nil, 10)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Name, "München")
+
+	results = idx.Search("Bogotà", nil, 10)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Match, "exact")
+}
+
+func TestSearchIndexToleratesTypos(t *testing.T) {
+	idx := newTestSearchIndex()
+
+	results := idx.Search("tokoy", nil, 10)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Name, "Tokyo")
+	assert.Equal(t, results[0].Match, "fuzzy")
+
+	results = idx.Search("prauge", nil, 10)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Name, "Prague")
+
+	results = idx.Search("pxr", nil, 10)
+	assert.Equal(t, len(results), 0)
+
+	results = idx.Search("okyo", nil, 10)
+	assert.Equal(t, len(results), 0)
+}
+
+func TestPrefixEditDistance(t *testing.T) {
+	tests := []struct {
+		q, text  string
+		maxEdits int
+		want     int
+	}{
+		{q: "lodnon", text: "london", maxEdits: 1, want: 1},
+		{q: "prauge", text: "prague east", maxEdits: 1, want: 1},
+		{q: "tokoy", text: "tokyo", maxEdits: 1, want: 1},
+		{q: "amsterdma", text: "amsterdam", maxEdits: 2, want: 1},
+		{q: "munchen", text: "munchenstein", maxEdits: 1, want: 0},
+		{q: "abcd", text: "wxyz", maxEdits: 1, want: 2},
+		{q: "berlin", text: "be", maxEdits: 2, want: 3},
+	}
+
+	var buf []int
+	for _, tt := range tests {
+		assert.Equal(t, prefixEditDistance([]rune(tt.q), []rune(tt.text), tt.maxEdits, &buf), tt.want)
+	}
+}
+
+func TestSearchModelServesStaleIndexOnReloadFailure(t *testing.T) {
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	stale := newTestSearchIndex()
+	cache := &searchCache{index: stale, expires: time.Now().Add(-time.Minute)}
+	m := SearchModel{DB: db, RefreshInterval: time.Hour, cache: cache}
+
+	idx, err := m.index(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, idx, stale)
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		cache.mu.Lock()
+		loading, expires := cache.loading, cache.expires
+		cache.mu.Unlock()
+		if loading == nil {
+			assert.Equal(t, time.Until(expires) > 0, true)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("reload did not finish")
+		}
+	}
+
+	idx, err = m.index(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, idx, stale)
+	assert.Equal(t, cache.loading == nil, true)
+}
+
+func TestSearchModelReturnsLoadErrorWithoutIndex(t *testing.T) {
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	m := SearchModel{DB: db, RefreshInterval: time.Hour, cache: &searchCache{}}
+	_, err = m.Search(context.Background(), "paris", nil, 10)
+	assert.Equal(t, err != nil, true)
+}
+
+func TestSearchIndexCountryCodes(t *testing.T) {
+	idx := newTestSearchIndex()
+
+	results := idx.Search("us", NewIncludeSet(SearchTypeCountry), 10)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, *results[0].CountryCode, "USA")
+	assert.Equal(t, results[0].MatchedOn, "alpha2_code")
+
+	results = idx.Search("jpn", nil, 10)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Type, SearchTypeCountry)
+	assert.Equal(t, results[0].MatchedOn, "country_code")
+}
+
+func TestSearchIndexTypesAndLimit(t *testing.T) {
+	idx := newTestSearchIndex()
+
+	results := idx.Search("new york", nil, 10)
+	assert.Equal(t, len(results), 2)
+
+	results = idx.Search("new york", NewIncludeSet(SearchTypeState), 10)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Type, SearchTypeState)
+
+	results = idx.Search("york", nil, 10)
+	assert.Equal(t, len(results), 2)
+	assert.Equal(t, results[0].Match, "word_prefix")
+
+	results = idx.Search("p", nil, 1)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Name, "Paris")
+}
@@ -0,0 +1,141 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// CityFeatures are the city_features columns compared by SimilarCities. Each is
+// the z-score of a Numbeo index or of an annual avg_climate aggregate.
+var CityFeatures = []string{
+	"cost_of_living_plus_rent",
+	"local_purchasing_power",
+	"quality_of_life",
+	"property_price_to_income_ratio",
+	"traffic_commute_time",
+	"safety",
+	"health_care",
+	"pollution",
+	"climate",
+	"annual_high_temp",
+	"annual_low_temp",
+	"annual_rainfall",
+	"annual_humidity",
+	"annual_sunshine",
+	"annual_snowfall",
+}
+
+type SimilarityFilters struct {
+	ExcludeCountries []string
+	MaxCostRatio     *float64
+	Limit            int
+}
+
+// SimilarCity is a city ranked by its Euclidean Distance to the requested city
+// over the features both cities have, scaled up to the full feature count.
+// Cities sharing fewer than half of the features are not compared.
+type SimilarCity struct {
+	GeonameID      int64    `json:"geoname_id"`
+	Name           string   `json:"city"`
+	CountryCode    string   `json:"country_code"`
+	CountryName    string   `json:"country"`
+	Population     *int64   `json:"population"`
+	Distance       float64  `json:"distance"`
+	SharedFeatures int      `json:"shared_features"`
+	CostRatio      *float64 `json:"cost_ratio"`
+}
+
+// SimilarCities returns the cities closest to the city with id. It returns
+// ErrRecordNotFound if that city does not exist, and an empty list if it has no
+// features.
+func (c CityModel) SimilarCities(id int64, f SimilarityFilters) (cities []*SimilarCity, retErr error) {
+	var squares, shared []string
+	for _, feature := range CityFeatures {
+		column := "z_" + feature
+		squares = append(squares, fmt.Sprintf("COALESCE((o.%[1]s - t.%[1]s) ^ 2, 0)", column))
+		shared = append(shared, fmt.Sprintf("(o.%[1]s IS NOT NULL AND t.%[1]s IS NOT NULL)::int", column))
+	}
+
+	query := fmt.Sprintf(`
+		WITH candidates AS (
+			SELECT o.geoname_id,
+			       %s AS squares,
+			       %s AS shared,
+			       o.cost_index / NULLIF(t.cost_index, 0) AS cost_ratio
+			FROM city_features t
+			JOIN city_features o ON o.geoname_id <> t.geoname_id
+			WHERE t.geoname_id = $1
+			  AND ($2::text[] IS NULL OR NOT UPPER(o.country_code) = ANY($2))
+			  AND ($3::double precision IS NULL OR o.cost_index <= t.cost_index * $3)
+		)
+		SELECT c.geoname_id, c.city, c.country_code, COALESCE(ctr.country, ''), c.population,
+		       SQRT(cd.squares * $4 / cd.shared) AS distance, cd.shared, cd.cost_ratio
+		FROM candidates cd
+		JOIN cities c ON c.geoname_id = cd.geoname_id
+		LEFT JOIN countries ctr ON ctr.country_code = c.country_code
+		WHERE cd.shared * 2 >= $4
+		ORDER BY distance, c.geoname_id
+		LIMIT $5;`,
+		strings.Join(squares, "\n\t\t\t\t\t+ "), strings.Join(shared, "\n\t\t\t\t\t+ "))
+
+	var excluded any
+	if len(f.ExcludeCountries) > 0 {
+		excluded = pq.Array(f.ExcludeCountries)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := c.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM cities WHERE geoname_id = $1);`, id).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+
+	rows, err := c.DB.QueryContext(ctx, query, id, excluded, f.MaxCostRatio, len(CityFeatures), f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	cities = []*SimilarCity{}
+	for rows.Next() {
+		var city SimilarCity
+		if err := rows.Scan(&city.GeonameID, &city.Name, &city.CountryCode, &city.CountryName, &city.Population, &city.Distance, &city.SharedFeatures, &city.CostRatio); err != nil {
+			return nil, err
+		}
+		city.Distance = math.Round(city.Distance*10000) / 10000
+		if city.CostRatio != nil {
+			*city.CostRatio = math.Round(*city.CostRatio*10000) / 10000
+		}
+		cities = append(cities, &city)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cities, nil
+}
+
+// RefreshFeatures recomputes the city_features view. Readers keep seeing the
+// previous vectors until the refresh completes.
+func (c CityModel) RefreshFeatures() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	_, err := c.DB.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY city_features;`)
+	return err
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type State struct {
+	Code        string  `json:"state_code"`
+	Name        string  `json:"state_name"`
+	Category    *string `json:"category,omitzero"`
+	CountryCode *string `json:"country_code,omitzero"`
+	Population  *int64  `json:"population,omitzero"`
+	CityCount   *int    `json:"city_count,omitzero"`
+	Cities      []*City `json:"cities,omitzero"`
+}
+
+type StateModel struct {
+	DB *sql.DB
+}
+
+// States have no country column of their own, so country_code, population and
+// city_count are derived from the cities that reference the state.
+const stateSelect = `
+	SELECT s.state_code, s.state_name, s.category, MIN(c.country_code),
+	       SUM(c.population)::bigint, COUNT(c.geoname_id)::int
+	FROM states s
+	LEFT JOIN cities c ON c.state_code = s.state_code`
+
+func (s StateModel) ListStates(countryCode string) (states []*State, retErr error) {
+	query := stateSelect + `
+		GROUP BY s.state_code, s.state_name, s.category
+		HAVING $1 = '' OR LOWER(MIN(c.country_code)) = LOWER($1)
+		ORDER BY s.state_code;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, countryCode)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	states = []*State{}
+	for rows.Next() {
+		var state State
+		if err := rows.Scan(
+			&state.Code,
+			&state.Name,
+			&state.Category,
+			&state.CountryCode,
+			&state.Population,
+			&state.CityCount,
+		); err != nil {
+			return nil, err
+		}
+		states = append(states, &state)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if countryCode != "" && len(states) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return states, nil
+}
+
+func (s StateModel) GetState(code string) (*State, error) {
+	query := stateSelect + `
+		WHERE UPPER(s.state_code) = UPPER($1)
+		GROUP BY s.state_code, s.state_name, s.category;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var state State
+	err := s.DB.QueryRowContext(ctx, query, code).Scan(
+		&state.Code,
+		&state.Name,
+		&state.Category,
+		&state.CountryCode,
+		&state.Population,
+		&state.CityCount,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	state.Cities, err = s.listStateCities(ctx, state.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func (s StateModel) listStateCities(ctx context.Context, code string) (cities []*City, retErr error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM cities c
+		LEFT JOIN countries ctr ON ctr.country_code = c.country_code
+		WHERE c.state_code = $1
+		ORDER BY c.population DESC NULLS LAST, c.geoname_id;`, cityColumns)
+
+	rows, err := s.DB.QueryContext(ctx, query, code)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	cities = []*City{}
+	for rows.Next() {
+		var city City
+		if err := rows.Scan(city.scanDest()...); err != nil {
+			return nil, err
+		}
+		cities = append(cities, &city)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cities, nil
+}
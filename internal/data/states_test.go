@@ -0,0 +1,55 @@
+package data
+
+import (
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+func TestListStates(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	states, err := models.States.ListStates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(states) > 0, true)
+	assert.Equal(t, states[0].Code != "", true)
+	assert.Equal(t, states[0].Name != "", true)
+
+	states, err = models.States.ListStates("usa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(states) > 0, true)
+	for _, state := range states {
+		assert.Equal(t, *state.CountryCode, "USA")
+	}
+
+	_, err = models.States.ListStates("XXX")
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestGetState(t *testing.T) {
+	db := newTestDB(t)
+	models := NewModels(db)
+
+	state, err := models.States.GetState("ny")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, state.Code, "NY")
+	assert.Equal(t, state.Name != "", true)
+	assert.Equal(t, len(state.Cities), *state.CityCount)
+	assert.Equal(t, len(state.Cities) > 0, true)
+	assert.Equal(t, *state.Cities[0].StateCode, "NY")
+
+	_, err = models.States.GetState("ZZZ")
+	assert.Equal(t, err, ErrRecordNotFound)
+}
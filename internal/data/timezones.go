@@ -0,0 +1,202 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Working hours, in local time, used by NewWorkingHoursOverlap.
+const (
+	WorkdayStartHour = 9
+	WorkdayEndHour   = 18
+)
+
+var ErrUnknownTimezone = errors.New("unknown timezone")
+
+// LocalTime describes the wall clock of a timezone at a given instant.
+type LocalTime struct {
+	Time             string `json:"local_time"`
+	UTCOffset        string `json:"utc_offset"`
+	UTCOffsetSeconds int    `json:"utc_offset_seconds"`
+	Abbreviation     string `json:"abbreviation"`
+	IsDST            bool   `json:"is_dst"`
+}
+
+// locations caches the loaded timezones by name, since time.LoadLocation reads
+// the tz database on every call. Unknown names are not cached.
+var locations sync.Map
+
+func loadLocation(timezone string) (*time.Location, error) {
+	if loc, ok := locations.Load(timezone); ok {
+		return loc.(*time.Location), nil
+	}
+	if timezone == "" {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTimezone, timezone)
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTimezone, timezone)
+	}
+	locations.Store(timezone, loc)
+	return loc, nil
+}
+
+func NewLocalTime(timezone string, at time.Time) (*LocalTime, error) {
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	local := at.In(loc)
+	_, offset := local.Zone()
+
+	return &LocalTime{
+		Time:             local.Format(time.RFC3339),
+		UTCOffset:        local.Format("-07:00"),
+		UTCOffsetSeconds: offset,
+		Abbreviation:     local.Format("MST"),
+		IsDST:            local.IsDST(),
+	}, nil
+}
+
+// AttachLocalTimes sets the Time block of every city whose timezone is known.
+func AttachLocalTimes(cities []*City, at time.Time) {
+	for _, city := range cities {
+		city.Time, _ = NewLocalTime(city.Timezone, at)
+	}
+}
+
+// WorkingHoursOverlap lists the intervals in which every city is within its
+// local working hours. The first city is the reference: its working day on Date
+// is intersected with the working days of the other cities on the previous, same
+// and next local dates, so that cities on opposite sides of the date line can
+// still overlap.
+type WorkingHoursOverlap struct {
+	Date         string          `json:"date"`
+	WorkdayStart string          `json:"workday_start"`
+	WorkdayEnd   string          `json:"workday_end"`
+	Cities       []OverlapCity   `json:"cities"`
+	Windows      []OverlapWindow `json:"windows"`
+	TotalMinutes int             `json:"total_minutes"`
+}
+
+// OverlapCity describes a city on the reference date, at local noon.
+type OverlapCity struct {
+	GeonameID int64  `json:"geoname_id"`
+	Name      string `json:"city"`
+	Timezone  string `json:"timezone"`
+	UTCOffset string `json:"utc_offset"`
+	IsDST     bool   `json:"is_dst"`
+}
+
+type OverlapWindow struct {
+	StartUTC        time.Time       `json:"start_utc"`
+	EndUTC          time.Time       `json:"end_utc"`
+	DurationMinutes int             `json:"duration_minutes"`
+	Local           []OverlapPeriod `json:"local"`
+}
+
+type OverlapPeriod struct {
+	GeonameID int64  `json:"geoname_id"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+}
+
+type timeWindow struct {
+	start, end time.Time
+}
+
+// NewWorkingHoursOverlap returns an error wrapping ErrUnknownTimezone if a city
+// has a timezone missing from the tz database.
+func NewWorkingHoursOverlap(cities []*City, date time.Time) (*WorkingHoursOverlap, error) {
+	overlap := &WorkingHoursOverlap{
+		Date:         date.Format(time.DateOnly),
+		WorkdayStart: fmt.Sprintf("%02d:00", WorkdayStartHour),
+		WorkdayEnd:   fmt.Sprintf("%02d:00", WorkdayEndHour),
+		Cities:       make([]OverlapCity, 0, len(cities)),
+		Windows:      []OverlapWindow{},
+	}
+
+	locations := make([]*time.Location, 0, len(cities))
+	var windows []timeWindow
+	for i, city := range cities {
+		loc, err := loadLocation(city.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("city %d: %w", city.GeonameID, err)
+		}
+		locations = append(locations, loc)
+
+		noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, loc)
+		overlap.Cities = append(overlap.Cities, OverlapCity{
+			GeonameID: city.GeonameID,
+			Name:      city.Name,
+			Timezone:  city.Timezone,
+			UTCOffset: noon.Format("-07:00"),
+			IsDST:     noon.IsDST(),
+		})
+
+		if i == 0 {
+			windows = []timeWindow{workday(date, loc, 0)}
+			continue
+		}
+		windows = intersectWindows(windows, []timeWindow{
+			workday(date, loc, -1),
+			workday(date, loc, 0),
+			workday(date, loc, 1),
+		})
+	}
+
+	for _, w := range windows {
+		window := OverlapWindow{
+			StartUTC:        w.start.UTC(),
+			EndUTC:          w.end.UTC(),
+			DurationMinutes: int(w.end.Sub(w.start).Minutes()),
+			Local:           make([]OverlapPeriod, 0, len(cities)),
+		}
+		for i, city := range cities {
+			window.Local = append(window.Local, OverlapPeriod{
+				GeonameID: city.GeonameID,
+				Start:     w.start.In(locations[i]).Format(time.RFC3339),
+				End:       w.end.In(locations[i]).Format(time.RFC3339),
+			})
+		}
+		overlap.Windows = append(overlap.Windows, window)
+		overlap.TotalMinutes += window.DurationMinutes
+	}
+
+	return overlap, nil
+}
+
+func workday(date time.Time, loc *time.Location, dayOffset int) timeWindow {
+	year, month, day := date.Date()
+	return timeWindow{
+		start: time.Date(year, month, day+dayOffset, WorkdayStartHour, 0, 0, 0, loc),
+		end:   time.Date(year, month, day+dayOffset, WorkdayEndHour, 0, 0, 0, loc),
+	}
+}
+
+// intersectWindows intersects two sorted lists of disjoint windows.
+func intersectWindows(a, b []timeWindow) []timeWindow {
+	var result []timeWindow
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start, end := a[i].start, a[i].end
+		if b[j].start.After(start) {
+			start = b[j].start
+		}
+		if b[j].end.Before(end) {
+			end = b[j].end
+		}
+		if start.Before(end) {
+			result = append(result, timeWindow{start: start, end: end})
+		}
+
+		if a[i].end.Before(b[j].end) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
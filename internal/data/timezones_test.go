@@ -0,0 +1,88 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+func TestNewLocalTime(t *testing.T) {
+	at := time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC)
+
+	local, err := NewLocalTime("Europe/Berlin", at)
+	assert.NilError(t, err)
+	assert.Equal(t, local.Time, "2026-07-01T12:00:00+02:00")
+	assert.Equal(t, local.UTCOffset, "+02:00")
+	assert.Equal(t, local.UTCOffsetSeconds, 7200)
+	assert.Equal(t, local.Abbreviation, "CEST")
+	assert.Equal(t, local.IsDST, true)
+
+	local, err = NewLocalTime("Europe/Berlin", at.AddDate(0, 6, 0))
+	assert.NilError(t, err)
+	assert.Equal(t, local.UTCOffset, "+01:00")
+	assert.Equal(t, local.IsDST, false)
+
+	_, err = NewLocalTime("Mars/Olympus_Mons", at)
+	assert.Equal(t, errors.Is(err, ErrUnknownTimezone), true)
+}
+
+func TestLoadLocationCache(t *testing.T) {
+	loc, err := loadLocation("Asia/Tokyo")
+	assert.NilError(t, err)
+
+	cached, err := loadLocation("Asia/Tokyo")
+	assert.NilError(t, err)
+	assert.Equal(t, cached, loc)
+
+	_, err = loadLocation("Mars/Olympus_Mons")
+	assert.Equal(t, errors.Is(err, ErrUnknownTimezone), true)
+	_, ok := locations.Load("Mars/Olympus_Mons")
+	assert.Equal(t, ok, false)
+}
+
+func TestNewWorkingHoursOverlap(t *testing.T) {
+	date := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	berlin := &City{GeonameID: 2950159, Name: "Berlin", Timezone: "Europe/Berlin"}
+	newYork := &City{GeonameID: 5128581, Name: "New York", Timezone: "America/New_York"}
+	tokyo := &City{GeonameID: 1850147, Name: "Tokyo", Timezone: "Asia/Tokyo"}
+	sanFrancisco := &City{GeonameID: 5391959, Name: "San Francisco", Timezone: "America/Los_Angeles"}
+	auckland := &City{GeonameID: 2193733, Name: "Auckland", Timezone: "Pacific/Auckland"}
+
+	overlap, err := NewWorkingHoursOverlap([]*City{berlin, newYork}, date)
+	assert.NilError(t, err)
+	assert.Equal(t, overlap.Date, "2026-07-01")
+	assert.Equal(t, overlap.Cities[1].UTCOffset, "-04:00")
+	assert.Equal(t, overlap.Cities[1].IsDST, true)
+	assert.Equal(t, len(overlap.Windows), 1)
+	assert.Equal(t, overlap.Windows[0].StartUTC, time.Date(2026, 7, 1, 13, 0, 0, 0, time.UTC))
+	assert.Equal(t, overlap.Windows[0].EndUTC, time.Date(2026, 7, 1, 16, 0, 0, 0, time.UTC))
+	assert.Equal(t, overlap.TotalMinutes, 180)
+	assert.Equal(t, overlap.Windows[0].Local[1].Start, "2026-07-01T09:00:00-04:00")
+
+	overlap, err = NewWorkingHoursOverlap([]*City{tokyo, sanFrancisco}, date)
+	assert.NilError(t, err)
+	assert.Equal(t, overlap.TotalMinutes, 60)
+	assert.Equal(t, overlap.Windows[0].Local[0].Start, "2026-07-01T09:00:00+09:00")
+	assert.Equal(t, overlap.Windows[0].Local[1].Start, "2026-06-30T17:00:00-07:00")
+
+	overlap, err = NewWorkingHoursOverlap([]*City{berlin, newYork, auckland}, date)
+	assert.NilError(t, err)
+	assert.Equal(t, len(overlap.Windows), 0)
+	assert.Equal(t, overlap.TotalMinutes, 0)
+
+	_, err = NewWorkingHoursOverlap([]*City{berlin, {GeonameID: 1, Timezone: "Nowhere"}}, date)
+	assert.Equal(t, errors.Is(err, ErrUnknownTimezone), true)
+}
+
+func TestIntersectWindows(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2026, 1, 1, hour, 0, 0, 0, time.UTC) }
+
+	got := intersectWindows(
+		[]timeWindow{{at(0), at(4)}, {at(6), at(10)}},
+		[]timeWindow{{at(2), at(7)}, {at(9), at(12)}},
+	)
+
+	assert.DeepEqual(t, got, []timeWindow{{at(2), at(4)}, {at(6), at(7)}, {at(9), at(10)}})
+}
@@ -78,6 +78,27 @@ var supportedCurrencyCodes = func() []string {
 	return codes
 }()
 
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// SupportedCurrencies returns the supported currency codes in sorted order.
+func SupportedCurrencies() []string {
+	return slices.Clone(supportedCurrencyCodes)
+}
+
+func IsSupported(code string) bool {
+	_, ok := supportedCurrencies[code]
+	return ok
+}
+
+// Rate returns the number of code units per one unit of the base currency.
+func (r Response) Rate(code string) (float64, error) {
+	info, ok := r.Currencies[code]
+	if !ok || info.Rate <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, code)
+	}
+	return info.Rate, nil
+}
+
 func NewService(logger *slog.Logger, appID string) *Service {
 	s := &Service{
 		logger: logger,
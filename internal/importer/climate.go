@@ -0,0 +1,358 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/denis-k2/relohelper-go/internal/data"
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+// ClimateMonth is an avg_climate row. Metrics is keyed by the names in
+// data.ClimateMetrics; missing metrics are nil.
+type ClimateMonth struct {
+	line    int
+	Month   int
+	Metrics map[string]*float64
+}
+
+// ClimateCity holds the twelve months of a city, ordered by month.
+type ClimateCity struct {
+	line      int
+	GeonameID int64
+	Months    []ClimateMonth
+}
+
+// ParseClimateCSV reads a CSV with the columns geoname_id and month followed
+// by any of the climate metrics, one row per city and month. See
+// parseClimateRecords for how invalid rows are reported.
+func ParseClimateCSV(r io.Reader, report *Report) ([]ClimateCity, error) {
+	records, err := readCSV(r, []string{"geoname_id", "month"})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseClimateRecords(records, report), nil
+}
+
+// ParseClimateJSON reads a JSON array of objects with the same keys as the
+// columns of ParseClimateCSV. Null values are treated as missing. Lines in the
+// report point at the start of each object.
+func ParseClimateJSON(r io.Reader, report *Report) ([]ClimateCity, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(content))
+	token, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("body must be a JSON array: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("body must be a JSON array")
+	}
+
+	var records []csvRecord
+	for dec.More() {
+		line := lineAt(content, dec.InputOffset())
+
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		record, ok := jsonRecord(raw, line)
+		if !ok {
+			report.reject(line, "must be a JSON object")
+			continue
+		}
+		records = append(records, record)
+	}
+
+	_, err = dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseClimateRecords(records, report), nil
+}
+
+// lineAt returns the line of the first value at or after offset.
+func lineAt(content []byte, offset int64) int {
+	for offset < int64(len(content)) && strings.ContainsRune(" \t\r\n,", rune(content[offset])) {
+		offset++
+	}
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+// jsonRecord turns a JSON object into a csvRecord, so both formats share the
+// field parsers. Numbers keep their literal form and null becomes empty.
+func jsonRecord(raw json.RawMessage, line int) (csvRecord, bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var object map[string]any
+	if err := dec.Decode(&object); err != nil || object == nil {
+		return csvRecord{}, false
+	}
+
+	record := csvRecord{line: line, values: make(map[string]string, len(object))}
+	for key, value := range object {
+		switch value := value.(type) {
+		case nil:
+			record.values[strings.ToLower(key)] = ""
+		case json.Number:
+			record.values[strings.ToLower(key)] = value.String()
+		case string:
+			record.values[strings.ToLower(key)] = value
+		default:
+			record.values[strings.ToLower(key)] = fmt.Sprint(value)
+		}
+	}
+
+	return record, true
+}
+
+// parseClimateRecords validates every row and groups the rows by city. Invalid
+// and repeated rows are rejected on their own line. A city is only kept when
+// it has exactly the months 1 to 12 and none of its rows was rejected;
+// otherwise it is rejected once, on the line of its first remaining row.
+func parseClimateRecords(records []csvRecord, report *Report) []ClimateCity {
+	type cityRows struct {
+		city    ClimateCity
+		seen    map[int]int
+		invalid int
+	}
+
+	var order []int64
+	groups := make(map[int64]*cityRows)
+	group := func(id int64) *cityRows {
+		rows, ok := groups[id]
+		if !ok {
+			rows = &cityRows{city: ClimateCity{GeonameID: id}, seen: make(map[int]int)}
+			groups[id] = rows
+			order = append(order, id)
+		}
+		return rows
+	}
+
+	for _, record := range records {
+		v := validator.New()
+		geonameID := parseInt64Field(v, record, "geoname_id")
+		month := ClimateMonth{
+			line:    record.line,
+			Month:   int(parseInt64Field(v, record, "month")),
+			Metrics: make(map[string]*float64, len(data.ClimateMetrics)),
+		}
+		for _, name := range data.ClimateMetrics {
+			month.Metrics[name] = parseFloatField(v, record, name)
+		}
+		ValidateClimateMonth(v, geonameID, month)
+
+		if _, ok := v.Errors["geoname_id"]; ok {
+			report.rejectErrors(record.line, v.Errors)
+			continue
+		}
+
+		rows := group(geonameID)
+		if !v.Valid() {
+			report.rejectErrors(record.line, v.Errors)
+			rows.invalid++
+			continue
+		}
+		if first, ok := rows.seen[month.Month]; ok {
+			report.reject(record.line, fmt.Sprintf("month: duplicate of line %d", first))
+			rows.invalid++
+			continue
+		}
+		rows.seen[month.Month] = record.line
+
+		if rows.city.line == 0 {
+			rows.city.line = record.line
+		}
+		rows.city.Months = append(rows.city.Months, month)
+	}
+
+	cities := make([]ClimateCity, 0, len(order))
+	for _, id := range order {
+		rows := groups[id]
+		if len(rows.city.Months) == 0 {
+			continue
+		}
+
+		if rows.invalid > 0 {
+			report.reject(rows.city.line, fmt.Sprintf("geoname_id: city %d left out because %d of its rows were rejected", id, rows.invalid))
+			continue
+		}
+
+		var missing []string
+		for month := 1; month <= 12; month++ {
+			if _, ok := rows.seen[month]; !ok {
+				missing = append(missing, fmt.Sprint(month))
+			}
+		}
+		if len(missing) > 0 {
+			report.reject(rows.city.line, fmt.Sprintf("month: city %d must have months 1 to 12, missing %s", id, strings.Join(missing, ", ")))
+			continue
+		}
+
+		slices.SortFunc(rows.city.Months, func(a, b ClimateMonth) int {
+			return a.Month - b.Month
+		})
+		cities = append(cities, rows.city)
+	}
+
+	return cities
+}
+
+// ValidateClimateMonth applies the checks of the admin climate API to a row,
+// reporting metric errors under their column names.
+func ValidateClimateMonth(v *validator.Validator, geonameID int64, month ClimateMonth) {
+	v.Check(geonameID > 0, "geoname_id", "must be a positive integer")
+
+	record := data.ClimateMonthRecord{Month: month.Month, Metrics: month.Metrics}
+	recordValidator := validator.New()
+	data.ValidateClimateMonthRecord(recordValidator, &record)
+	for key, message := range recordValidator.Errors {
+		v.AddError(strings.TrimPrefix(key, "metrics."), message)
+	}
+
+	v.Check(slices.ContainsFunc(data.ClimateMetrics, func(name string) bool {
+		return month.Metrics[name] != nil
+	}), "metrics", "at least one metric must be provided")
+}
+
+// ImportClimate upserts the months of every city in a single transaction. Each
+// city is written under its own savepoint, so a city is either loaded in full
+// or left out: a city that does not exist or fails to write is rejected while
+// the others go ahead. Stored months outside 1 to 12 are deleted, leaving each
+// loaded city with exactly twelve rows. With dryRun the transaction is rolled
+// back.
+func ImportClimate(db *sql.DB, cities []ClimateCity, updatedBy string, dryRun bool, report *Report) (retErr error) {
+	report.DryRun = dryRun
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	ids := make([]int64, 0, len(cities))
+	for _, city := range cities {
+		ids = append(ids, city.GeonameID)
+	}
+	known, err := knownCities(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+
+	query := climateUpsertQuery()
+	for _, city := range cities {
+		if !known[city.GeonameID] {
+			report.reject(city.line, fmt.Sprintf("geoname_id: city %d does not exist", city.GeonameID))
+			continue
+		}
+
+		var cityReport Report
+		err := importClimateCity(ctx, tx, query, city, updatedBy, &cityReport)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			report.reject(city.line, fmt.Sprintf("geoname_id: city %d left out: %v", city.GeonameID, err))
+			continue
+		}
+		report.Inserted += cityReport.Inserted
+		report.Updated += cityReport.Updated
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	return tx.Commit()
+}
+
+// importClimateCity writes the months of city, rolling back to the savepoint
+// taken before the first write on error.
+func importClimateCity(ctx context.Context, tx *sql.Tx, query string, city ClimateCity, updatedBy string, report *Report) (retErr error) {
+	_, err := tx.ExecContext(ctx, `SAVEPOINT climate_city;`)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr == nil {
+			_, retErr = tx.ExecContext(ctx, `RELEASE SAVEPOINT climate_city;`)
+			return
+		}
+		if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT climate_city;`); err != nil {
+			retErr = errors.Join(retErr, err)
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM avg_climate WHERE geoname_id = $1 AND month NOT BETWEEN 1 AND 12;`, city.GeonameID)
+	if err != nil {
+		return err
+	}
+
+	for _, month := range city.Months {
+		args := make([]any, 0, len(data.ClimateMetrics)+3)
+		args = append(args, city.GeonameID, month.Month)
+		for _, name := range data.ClimateMetrics {
+			args = append(args, month.Metrics[name])
+		}
+		args = append(args, updatedBy)
+
+		var inserted bool
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&inserted)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", month.line, err)
+		}
+		report.count(inserted)
+	}
+
+	return nil
+}
+
+// climateUpsertQuery builds the avg_climate upsert. The placeholders are
+// geoname_id, month, the metrics in data.ClimateMetrics order and updated_by.
+func climateUpsertQuery() string {
+	placeholders := make([]string, 0, len(data.ClimateMetrics)+2)
+	updates := make([]string, 0, len(data.ClimateMetrics))
+	for i := range len(data.ClimateMetrics) + 2 {
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+	}
+	for _, name := range data.ClimateMetrics {
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", name, name))
+	}
+
+	return fmt.Sprintf(`
+		INSERT INTO avg_climate (geoname_id, month, %s, updated_date, updated_by)
+		VALUES (%s, CURRENT_DATE, $%d)
+		ON CONFLICT (geoname_id, month) DO UPDATE
+		SET %s,
+		    updated_date = EXCLUDED.updated_date,
+		    updated_by = EXCLUDED.updated_by,
+		    version = avg_climate.version + 1
+		RETURNING xmax = 0;`,
+		strings.Join(data.ClimateMetrics, ", "),
+		strings.Join(placeholders, ", "), len(placeholders)+1,
+		strings.Join(updates, ", "))
+}
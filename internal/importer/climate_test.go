@@ -0,0 +1,179 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+// climateRows returns a row for each month of a city with a humidity value.
+func climateRows(id int64, months ...int) []string {
+	rows := make([]string, 0, len(months))
+	for _, month := range months {
+		rows = append(rows, fmt.Sprintf("%d,%d,%d.5,%d,70", id, month, month+10, month))
+	}
+	return rows
+}
+
+func allMonths() []int {
+	return []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+}
+
+func TestParseClimateCSV(t *testing.T) {
+	lines := []string{"geoname_id,month,high_temp,low_temp,humidity"}
+	lines = append(lines, climateRows(2643743, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1)...) // lines 2-13
+	lines = append(lines, climateRows(5128581, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11)...)     // lines 14-24
+	lines = append(lines, climateRows(2988507, allMonths()...)...)                        // lines 25-36
+	lines = append(lines,
+		"2988507,3,20,10,70", // line 37
+		"2950159,1,5,10,120", // line 38
+		"2950159,13,,,",      // line 39
+		"0,1,5,2,50",         // line 40
+		"2950159,x,5,2,50",   // line 41
+	)
+
+	var report Report
+	cities, err := ParseClimateCSV(strings.NewReader(strings.Join(lines, "\n")), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(cities), 1)
+	assert.Equal(t, cities[0].GeonameID, int64(2643743))
+	assert.Equal(t, len(cities[0].Months), 12)
+	assert.Equal(t, cities[0].Months[0].Month, 1)
+	assert.Equal(t, cities[0].Months[0].line, 13)
+	assert.Equal(t, *cities[0].Months[0].Metrics["high_temp"], 11.5)
+	assert.Equal(t, cities[0].Months[0].Metrics["sea_temp"] == nil, true)
+
+	assert.DeepEqual(t, report.Rejected, []Rejection{
+		{Line: 37, Reason: "month: duplicate of line 27"},
+		{Line: 38, Reason: "humidity: must be between 0 and 100; low_temp: must not be greater than high_temp"},
+		{Line: 39, Reason: "metrics: at least one metric must be provided; month: must be between 1 and 12"},
+		{Line: 40, Reason: "geoname_id: must be a positive integer"},
+		{Line: 41, Reason: "month: must be an integer"},
+		{Line: 14, Reason: "month: city 5128581 must have months 1 to 12, missing 12"},
+		{Line: 25, Reason: "geoname_id: city 2988507 left out because 1 of its rows were rejected"},
+	})
+}
+
+func TestParseClimateJSON(t *testing.T) {
+	var objects []string
+	for _, month := range allMonths() {
+		objects = append(objects, fmt.Sprintf(`  {"geoname_id": 2643743, "month": %d, "High_Temp": %d, "uv_index": null}`, month, month+10))
+	}
+	objects = append(objects,
+		`  "London"`,
+		`  {"geoname_id": 5128581, "month": 1, "uv_index": -1}`,
+	)
+	body := "[\n" + strings.Join(objects, ",\n") + "\n]"
+
+	var report Report
+	cities, err := ParseClimateJSON(strings.NewReader(body), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(cities), 1)
+	assert.Equal(t, cities[0].line, 2)
+	assert.Equal(t, *cities[0].Months[11].Metrics["high_temp"], 22.0)
+	assert.Equal(t, cities[0].Months[11].Metrics["uv_index"] == nil, true)
+
+	assert.DeepEqual(t, report.Rejected, []Rejection{
+		{Line: 14, Reason: "must be a JSON object"},
+		{Line: 15, Reason: "uv_index: must be between 0 and 20"},
+	})
+}
+
+func TestParseClimateJSONNotArray(t *testing.T) {
+	var report Report
+	_, err := ParseClimateJSON(strings.NewReader(`{"geoname_id": 1}`), &report)
+	assert.Equal(t, err.Error(), "body must be a JSON array")
+}
+
+func TestClimateUpsertQuery(t *testing.T) {
+	query := strings.Join(strings.Fields(climateUpsertQuery()), " ")
+	assert.Equal(t, strings.HasPrefix(query, "INSERT INTO avg_climate (geoname_id, month, high_temp, low_temp, pressure,"), true)
+	assert.Equal(t, strings.Contains(query, "VALUES ($1, $2, $3,"), true)
+	assert.Equal(t, strings.Contains(query, "$18, CURRENT_DATE, $19)"), true)
+	assert.Equal(t, strings.Contains(query, "SET high_temp = EXCLUDED.high_temp,"), true)
+	assert.Equal(t, strings.HasSuffix(query, "version = avg_climate.version + 1 RETURNING xmax = 0;"), true)
+}
+
+func TestImportClimate(t *testing.T) {
+	db := newTestDB(t)
+
+	insertTestCity(t, db, 999999301)
+	insertTestCity(t, db, 999999302)
+	deleteTestCities(t, db, 999999303)
+	_, err := db.Exec(`
+		INSERT INTO avg_climate (geoname_id, month, high_temp)
+		VALUES (999999301, 13, 1), (999999302, 0, 2), (999999302, 1, -3)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []string{"geoname_id,month,high_temp,low_temp,humidity"}
+	lines = append(lines, climateRows(999999301, allMonths()...)...) // lines 2-13
+	lines = append(lines, climateRows(999999302, allMonths()...)...) // lines 14-25
+	lines = append(lines, climateRows(999999303, allMonths()...)...) // lines 26-37
+
+	var parseReport Report
+	cities, err := ParseClimateCSV(strings.NewReader(strings.Join(lines, "\n")), &parseReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(parseReport.Rejected), 0)
+
+	// The last month of the second city doesn't fit the smallint column, so its
+	// write fails after the first eleven months went through.
+	cities[1].Months[11].Month = 40000
+
+	months := func(id int64) int {
+		return countRows(t, db, `SELECT COUNT(*) FROM avg_climate WHERE geoname_id = $1`, id)
+	}
+	checkRejected := func(report Report) {
+		t.Helper()
+		assert.Equal(t, len(report.Rejected), 2)
+		assert.Equal(t, report.Rejected[0].Line, 14)
+		assert.StringContains(t, report.Rejected[0].Reason, "geoname_id: city 999999302 left out: line 25:")
+		assert.Equal(t, report.Rejected[1], Rejection{Line: 26, Reason: "geoname_id: city 999999303 does not exist"})
+	}
+
+	var report Report
+	err = ImportClimate(db, cities, "test", true, &report)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Inserted, 12)
+	checkRejected(report)
+	assert.Equal(t, months(999999301), 1)
+
+	report = Report{}
+	err = ImportClimate(db, cities, "test", false, &report)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Inserted, 12)
+	assert.Equal(t, report.Updated, 0)
+	checkRejected(report)
+
+	// The first city has exactly its twelve months, the stray month 13 is gone.
+	assert.Equal(t, months(999999301), 12)
+	assert.Equal(t, countRows(t, db, `
+		SELECT COUNT(*) FROM avg_climate
+		WHERE geoname_id = 999999301 AND month BETWEEN 1 AND 12 AND updated_by = 'test'`), 12)
+
+	// The second city was rolled back as a whole, keeping its old rows.
+	assert.Equal(t, months(999999302), 2)
+	assert.Equal(t, countRows(t, db, `
+		SELECT COUNT(*) FROM avg_climate
+		WHERE geoname_id = 999999302 AND month = 1 AND high_temp = -3`), 1)
+
+	report = Report{}
+	err = ImportClimate(db, cities[:1], "reimport", false, &report)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Inserted, 0)
+	assert.Equal(t, report.Updated, 12)
+	assert.Equal(t, countRows(t, db, `
+		SELECT COUNT(*) FROM avg_climate
+		WHERE geoname_id = 999999301 AND version = 2 AND updated_by = 'reimport'`), 12)
+}
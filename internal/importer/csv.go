@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+// csvRecord is a CSV line with its values keyed by header name.
+type csvRecord struct {
+	line   int
+	values map[string]string
+}
+
+func (r csvRecord) get(column string) string {
+	return strings.TrimSpace(r.values[column])
+}
+
+// readCSV reads a CSV file with a header line that contains at least the
+// required columns. Header names are matched case-insensitively; unknown
+// columns are ignored.
+func readCSV(r io.Reader, required []string) ([]csvRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("missing header line")
+		}
+		return nil, err
+	}
+
+	columns := make([]string, len(header))
+	present := make(map[string]bool, len(header))
+	for i, name := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		present[columns[i]] = true
+	}
+	for _, name := range required {
+		if !present[name] {
+			return nil, fmt.Errorf("header is missing column %q", name)
+		}
+	}
+
+	var records []csvRecord
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		record := csvRecord{line: line, values: make(map[string]string, len(columns))}
+		for i, value := range fields {
+			if i < len(columns) {
+				record.values[columns[i]] = value
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// parseInt64Field returns 0 for an empty value; validation of required values is
+// left to the caller.
+func parseInt64Field(v *validator.Validator, record csvRecord, column string) int64 {
+	raw := record.get(column)
+	if raw == "" {
+		return 0
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	v.Check(err == nil, column, "must be an integer")
+	return value
+}
+
+// parseFloatField returns nil for an empty value.
+func parseFloatField(v *validator.Validator, record csvRecord, column string) *float64 {
+	raw := record.get(column)
+	if raw == "" {
+		return nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		v.AddError(column, "must be a number")
+		return nil
+	}
+	return &value
+}
+
+// parseDateField returns nil for an empty value.
+func parseDateField(v *validator.Validator, record csvRecord, column string) *time.Time {
+	raw := record.get(column)
+	if raw == "" {
+		return nil
+	}
+	value, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		v.AddError(column, "must have the form YYYY-MM-DD")
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,332 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+// GeoNames dumps are tab-separated without a header. These are the columns of
+// citiesNNNN.txt used by the importer.
+const (
+	geoNamesID         = 0
+	geoNamesName       = 1
+	geoNamesLatitude   = 4
+	geoNamesLongitude  = 5
+	geoNamesCountry    = 8
+	geoNamesAdmin1     = 10
+	geoNamesPopulation = 14
+	geoNamesTimezone   = 17
+	geoNamesColumns    = 19
+)
+
+// GeoNamesCity is a line of citiesNNNN.txt. Population is nil when GeoNames
+// reports zero, which stands for unknown.
+type GeoNamesCity struct {
+	line       int
+	GeonameID  int64
+	Name       string
+	Country    string
+	Admin1     string
+	Population *int64
+	Latitude   float64
+	Longitude  float64
+	Timezone   string
+}
+
+// GeoNamesState is a line of admin1CodesASCII.txt.
+type GeoNamesState struct {
+	line    int
+	Country string
+	Code    string
+	Name    string
+}
+
+// readTSV calls fn with the fields and line number of every non-empty line.
+func readTSV(r io.Reader, fn func(fields []string, line int)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		fn(strings.Split(text, "\t"), line)
+	}
+
+	return scanner.Err()
+}
+
+// ParseGeoNamesCities reads a GeoNames citiesNNNN.txt dump. Invalid lines are
+// recorded in report and left out.
+func ParseGeoNamesCities(r io.Reader, report *Report) ([]GeoNamesCity, error) {
+	var cities []GeoNamesCity
+	seen := make(map[int64]int)
+
+	err := readTSV(r, func(fields []string, line int) {
+		if len(fields) != geoNamesColumns {
+			report.reject(line, fmt.Sprintf("expected %d columns, got %d", geoNamesColumns, len(fields)))
+			return
+		}
+
+		v := validator.New()
+		city := GeoNamesCity{
+			line:     line,
+			Name:     strings.TrimSpace(fields[geoNamesName]),
+			Country:  strings.ToUpper(strings.TrimSpace(fields[geoNamesCountry])),
+			Admin1:   strings.TrimSpace(fields[geoNamesAdmin1]),
+			Timezone: strings.TrimSpace(fields[geoNamesTimezone]),
+		}
+
+		var err error
+		city.GeonameID, err = strconv.ParseInt(strings.TrimSpace(fields[geoNamesID]), 10, 64)
+		v.Check(err == nil, "geoname_id", "must be an integer")
+		city.Latitude, err = strconv.ParseFloat(strings.TrimSpace(fields[geoNamesLatitude]), 64)
+		v.Check(err == nil, "latitude", "must be a number")
+		city.Longitude, err = strconv.ParseFloat(strings.TrimSpace(fields[geoNamesLongitude]), 64)
+		v.Check(err == nil, "longitude", "must be a number")
+
+		if raw := strings.TrimSpace(fields[geoNamesPopulation]); raw != "" {
+			population, err := strconv.ParseInt(raw, 10, 64)
+			v.Check(err == nil, "population", "must be an integer")
+			if population != 0 {
+				city.Population = &population
+			}
+		}
+
+		ValidateGeoNamesCity(v, city)
+		if !v.Valid() {
+			report.rejectErrors(line, v.Errors)
+			return
+		}
+
+		if first, ok := seen[city.GeonameID]; ok {
+			report.reject(line, fmt.Sprintf("duplicate of line %d", first))
+			return
+		}
+		seen[city.GeonameID] = line
+
+		cities = append(cities, city)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cities, nil
+}
+
+func ValidateGeoNamesCity(v *validator.Validator, city GeoNamesCity) {
+	v.Check(city.GeonameID > 0, "geoname_id", "must be a positive integer")
+	v.Check(city.Name != "", "city", "must be provided")
+	v.Check(len(city.Country) == 2, "country_code", "must be an ISO 3166-1 alpha-2 code")
+	v.Check(city.Population == nil || *city.Population > 0, "population", "must not be negative")
+	v.Check(city.Latitude >= -90 && city.Latitude <= 90, "latitude", "must be between -90 and 90")
+	v.Check(city.Longitude >= -180 && city.Longitude <= 180, "longitude", "must be between -180 and 180")
+
+	v.Check(city.Timezone != "", "timezone", "must be provided")
+	_, err := time.LoadLocation(city.Timezone)
+	v.Check(err == nil, "timezone", "must be a valid IANA timezone")
+}
+
+// ParseGeoNamesStates reads a GeoNames admin1CodesASCII.txt dump and keeps the
+// admin1 divisions of countries, given as ISO alpha-2 codes. The states table
+// has no country column, so only countries whose admin1 codes are unique
+// across the table, such as US postal codes, should be imported.
+func ParseGeoNamesStates(r io.Reader, countries []string, report *Report) ([]GeoNamesState, error) {
+	wanted := make(map[string]bool, len(countries))
+	for _, country := range countries {
+		wanted[strings.ToUpper(country)] = true
+	}
+
+	var states []GeoNamesState
+	err := readTSV(r, func(fields []string, line int) {
+		if len(fields) < 2 {
+			report.reject(line, fmt.Sprintf("expected at least 2 columns, got %d", len(fields)))
+			return
+		}
+
+		country, code, ok := strings.Cut(strings.TrimSpace(fields[0]), ".")
+		if !ok || country == "" || code == "" {
+			report.reject(line, fmt.Sprintf("code %q must have the form CC.ADMIN1", fields[0]))
+			return
+		}
+		if !wanted[strings.ToUpper(country)] {
+			return
+		}
+
+		state := GeoNamesState{
+			line:    line,
+			Country: strings.ToUpper(country),
+			Code:    code,
+			Name:    strings.TrimSpace(fields[1]),
+		}
+
+		v := validator.New()
+		v.Check(len(state.Code) <= 10, "state_code", "must not be more than 10 bytes long")
+		v.Check(state.Name != "", "state_name", "must be provided")
+		if !v.Valid() {
+			report.rejectErrors(line, v.Errors)
+			return
+		}
+
+		states = append(states, state)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
+
+// ImportGeoNames upserts states and cities in a single transaction. New cities
+// are inserted in full; existing cities only get their population, coordinates
+// and timezone refreshed, so names and states curated in the database are kept.
+//
+// Cities whose country is missing from countries are rejected. Admin1 codes of
+// the imported state countries that are missing from states are left out and
+// recorded as warnings. With dryRun the transaction is rolled back.
+func ImportGeoNames(db *sql.DB, states []GeoNamesState, cities []GeoNamesCity, updatedBy string, dryRun bool, stateReport, cityReport *Report) (retErr error) {
+	stateReport.DryRun = dryRun
+	cityReport.DryRun = dryRun
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	stateCountries := make(map[string]bool)
+	for _, state := range states {
+		stateCountries[state.Country] = true
+
+		inserted, err := upsertState(ctx, tx, state)
+		if err != nil {
+			return fmt.Errorf("admin1 line %d: %w", state.line, err)
+		}
+		stateReport.count(inserted)
+	}
+
+	countries, err := queryStrings(ctx, tx, `SELECT UPPER(alpha2_code), country_code FROM countries WHERE alpha2_code IS NOT NULL;`)
+	if err != nil {
+		return err
+	}
+	stateCodes, err := queryStrings(ctx, tx, `SELECT state_code, state_code FROM states;`)
+	if err != nil {
+		return err
+	}
+
+	for _, city := range cities {
+		countryCode, ok := countries[city.Country]
+		if !ok {
+			cityReport.reject(city.line, fmt.Sprintf("country_code: no country with ISO alpha-2 code %q", city.Country))
+			continue
+		}
+
+		var stateCode *string
+		if stateCountries[city.Country] && city.Admin1 != "" {
+			if code, ok := stateCodes[city.Admin1]; ok {
+				stateCode = &code
+			} else {
+				cityReport.warn(city.line, fmt.Sprintf("state_code: no state %q, left out", city.Admin1))
+			}
+		}
+
+		inserted, err := upsertGeoNamesCity(ctx, tx, city, countryCode, stateCode, updatedBy)
+		if err != nil {
+			return fmt.Errorf("cities line %d: %w", city.line, err)
+		}
+		cityReport.count(inserted)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	return tx.Commit()
+}
+
+// queryStrings returns the rows of a two-column query as a map from the first
+// column to the second.
+func queryStrings(ctx context.Context, tx *sql.Tx, query string) (values map[string]string, retErr error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	values = make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+
+	return values, rows.Err()
+}
+
+func upsertState(ctx context.Context, tx *sql.Tx, state GeoNamesState) (bool, error) {
+	query := `
+		INSERT INTO states (state_code, state_name)
+		VALUES ($1, $2)
+		ON CONFLICT (state_code) DO UPDATE
+		SET state_name = EXCLUDED.state_name
+		RETURNING xmax = 0;`
+
+	var inserted bool
+	err := tx.QueryRowContext(ctx, query, state.Code, state.Name).Scan(&inserted)
+	return inserted, err
+}
+
+func upsertGeoNamesCity(ctx context.Context, tx *sql.Tx, city GeoNamesCity, countryCode string, stateCode *string, updatedBy string) (bool, error) {
+	query := `
+		INSERT INTO cities (geoname_id, city, state_code, country_code, population, latitude, longitude,
+		                    timezone, updated_date, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_DATE, $9)
+		ON CONFLICT (geoname_id) DO UPDATE
+		SET population = COALESCE(EXCLUDED.population, cities.population),
+		    latitude = EXCLUDED.latitude,
+		    longitude = EXCLUDED.longitude,
+		    timezone = EXCLUDED.timezone,
+		    updated_date = EXCLUDED.updated_date,
+		    updated_by = EXCLUDED.updated_by,
+		    version = cities.version + 1
+		RETURNING xmax = 0;`
+
+	args := []any{
+		city.GeonameID,
+		city.Name,
+		stateCode,
+		countryCode,
+		city.Population,
+		city.Latitude,
+		city.Longitude,
+		city.Timezone,
+		updatedBy,
+	}
+
+	var inserted bool
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&inserted)
+	return inserted, err
+}
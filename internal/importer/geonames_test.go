@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+func geoNamesLine(id, name, lat, lon, country, admin1, population, timezone string) string {
+	fields := make([]string, geoNamesColumns)
+	fields[geoNamesID] = id
+	fields[geoNamesName] = name
+	fields[geoNamesLatitude] = lat
+	fields[geoNamesLongitude] = lon
+	fields[geoNamesCountry] = country
+	fields[geoNamesAdmin1] = admin1
+	fields[geoNamesPopulation] = population
+	fields[geoNamesTimezone] = timezone
+	return strings.Join(fields, "\t")
+}
+
+func TestParseGeoNamesCities(t *testing.T) {
+	dump := strings.Join([]string{
+		geoNamesLine("5128581", "New York City", "40.71427", "-74.00597", "US", "NY", "8804190", "America/New_York"),
+		geoNamesLine("2643743", "London", "51.50853", "-0.12574", "GB", "ENG", "0", "Europe/London"),
+		"",
+		"5128581\tNew York City",
+		geoNamesLine("5128581", "New York City", "40.71427", "-74.00597", "US", "NY", "8804190", "America/New_York"),
+		geoNamesLine("x", "", "91", "-74", "USA", "", "-5", "Mars/Olympus"),
+	}, "\n")
+
+	var report Report
+	cities, err := ParseGeoNamesCities(strings.NewReader(dump), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(cities), 2)
+	assert.Equal(t, cities[0].GeonameID, int64(5128581))
+	assert.Equal(t, cities[0].Admin1, "NY")
+	assert.Equal(t, *cities[0].Population, int64(8804190))
+	assert.Equal(t, cities[1].Country, "GB")
+	assert.Equal(t, cities[1].Population == nil, true)
+
+	assert.DeepEqual(t, report.Rejected, []Rejection{
+		{Line: 4, Reason: "expected 19 columns, got 2"},
+		{Line: 5, Reason: "duplicate of line 1"},
+		{Line: 6, Reason: "city: must be provided; country_code: must be an ISO 3166-1 alpha-2 code; " +
+			"geoname_id: must be an integer; latitude: must be between -90 and 90; " +
+			"population: must not be negative; timezone: must be a valid IANA timezone"},
+	})
+}
+
+func TestParseGeoNamesStates(t *testing.T) {
+	dump := strings.Join([]string{
+		"US.NY\tNew York\tNew York\t5128638",
+		"GB.ENG\tEngland\tEngland\t6269131",
+		"us.CA\tCalifornia\tCalifornia\t5332921",
+		"US\tUnited States",
+		"US.TOOLONGCODE\tSomewhere",
+		"US.WA",
+	}, "\n")
+
+	var report Report
+	states, err := ParseGeoNamesStates(strings.NewReader(dump), []string{"us"}, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.DeepEqual(t, states, []GeoNamesState{
+		{line: 1, Country: "US", Code: "NY", Name: "New York"},
+		{line: 3, Country: "US", Code: "CA", Name: "California"},
+	})
+	assert.DeepEqual(t, report.Rejected, []Rejection{
+		{Line: 4, Reason: `code "US" must have the form CC.ADMIN1`},
+		{Line: 5, Reason: "state_code: must not be more than 10 bytes long"},
+		{Line: 6, Reason: "expected at least 2 columns, got 1"},
+	})
+}
+
+func TestReportPrintWarnings(t *testing.T) {
+	report := Report{Inserted: 1}
+	report.warn(4, `state_code: no state "ZZ", left out`)
+	report.reject(2, "country_code: no country with ISO alpha-2 code \"XK\"")
+
+	var out bytes.Buffer
+	err := report.Print(&out, "cities")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, out.String(), "cities: 1 inserted, 0 updated, 1 rejected, 1 warnings\n"+
+		"line 2: country_code: no country with ISO alpha-2 code \"XK\"\n"+
+		"line 4: warning: state_code: no state \"ZZ\", left out\n")
+}
+
+func TestImportGeoNames(t *testing.T) {
+	db := newTestDB(t)
+
+	// Registered first, so it runs after the cities that refer to the state.
+	deleteState := func() {
+		if _, err := db.Exec(`DELETE FROM states WHERE state_code = 'Q9'`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(deleteState)
+	deleteTestCities(t, db, 999999201, 999999202, 999999203, 999999204)
+	deleteState()
+
+	parse := func(population string) ([]GeoNamesState, []GeoNamesCity) {
+		t.Helper()
+		var report Report
+		states, err := ParseGeoNamesStates(strings.NewReader("US.Q9\tTest State\tTest State\t1\nGB.Q9\tOther\tOther\t2"), []string{"US"}, &report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dump := strings.Join([]string{
+			geoNamesLine("999999201", "Testville", "40.5", "-73.9", "US", "Q9", population, "America/New_York"),
+			geoNamesLine("999999202", "Nowhere", "10", "10", "ZZ", "", "100", "UTC"),
+			geoNamesLine("999999203", "Orphan Springs", "41", "-74", "US", "Q8", "200", "America/New_York"),
+			geoNamesLine("999999204", "Testbury", "51.5", "-0.1", "GB", "Q9", "300", "Europe/London"),
+		}, "\n")
+		cities, err := ParseGeoNamesCities(strings.NewReader(dump), &report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(report.Rejected), 0)
+		return states, cities
+	}
+	testCities := func() int {
+		return countRows(t, db, `SELECT COUNT(*) FROM cities WHERE geoname_id BETWEEN 999999201 AND 999999204`)
+	}
+
+	var stateReport, cityReport Report
+	states, cities := parse("5000")
+	err := ImportGeoNames(db, states, cities, "test", true, &stateReport, &cityReport)
+	assert.NilError(t, err)
+	assert.Equal(t, stateReport.Inserted, 1)
+	assert.Equal(t, cityReport.Inserted, 3)
+	assert.Equal(t, testCities(), 0)
+	assert.Equal(t, countRows(t, db, `SELECT COUNT(*) FROM states WHERE state_code = 'Q9'`), 0)
+
+	stateReport, cityReport = Report{}, Report{}
+	err = ImportGeoNames(db, states, cities, "test", false, &stateReport, &cityReport)
+	assert.NilError(t, err)
+	assert.Equal(t, stateReport.Inserted, 1)
+	assert.Equal(t, cityReport.Inserted, 3)
+	assert.Equal(t, cityReport.Updated, 0)
+	assert.DeepEqual(t, cityReport.Rejected, []Rejection{{Line: 2, Reason: `country_code: no country with ISO alpha-2 code "ZZ"`}})
+	assert.DeepEqual(t, cityReport.Warnings, []Rejection{{Line: 3, Reason: `state_code: no state "Q8", left out`}})
+	assert.Equal(t, testCities(), 3)
+
+	type cityRow struct {
+		countryCode string
+		stateCode   *string
+		population  *int64
+		updatedBy   string
+		version     int
+	}
+	getCity := func(id int64) cityRow {
+		t.Helper()
+		var row cityRow
+		err := db.QueryRow(`
+			SELECT country_code, state_code, population, updated_by, version
+			FROM cities
+			WHERE geoname_id = $1`, id).Scan(&row.countryCode, &row.stateCode, &row.population, &row.updatedBy, &row.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return row
+	}
+
+	city := getCity(999999201)
+	assert.Equal(t, city.countryCode, "USA")
+	assert.Equal(t, *city.stateCode, "Q9")
+	assert.Equal(t, *city.population, int64(5000))
+	assert.Equal(t, city.updatedBy, "test")
+	assert.Equal(t, city.version, 1)
+	assert.Equal(t, getCity(999999203).stateCode == nil, true)
+	assert.Equal(t, getCity(999999204).countryCode, "GBR")
+	assert.Equal(t, getCity(999999204).stateCode == nil, true)
+
+	// GeoNames reports an unknown population as 0, which keeps the stored one.
+	stateReport, cityReport = Report{}, Report{}
+	states, cities = parse("0")
+	err = ImportGeoNames(db, states, cities, "reimport", false, &stateReport, &cityReport)
+	assert.NilError(t, err)
+	assert.Equal(t, stateReport.Updated, 1)
+	assert.Equal(t, cityReport.Inserted, 0)
+	assert.Equal(t, cityReport.Updated, 3)
+
+	city = getCity(999999201)
+	assert.Equal(t, *city.population, int64(5000))
+	assert.Equal(t, city.updatedBy, "reimport")
+	assert.Equal(t, city.version, 2)
+}
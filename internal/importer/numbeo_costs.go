@@ -0,0 +1,230 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/denis-k2/relohelper-go/internal/validator"
+)
+
+var numbeoCostColumns = []string{"geoname_id", "category", "param", "cost", "range_lower", "range_upper", "last_update"}
+
+// NumbeoCost is a numbeo_city_costs row keyed by category and param names.
+type NumbeoCost struct {
+	line       int
+	GeonameID  int64
+	Category   string
+	Param      string
+	Cost       *float64
+	RangeLower *float64
+	RangeUpper *float64
+	LastUpdate *time.Time
+}
+
+// ParseNumbeoCosts reads a CSV with the columns geoname_id, category, param,
+// cost, range_lower, range_upper and last_update. Invalid and repeated rows
+// are recorded in report and left out.
+func ParseNumbeoCosts(r io.Reader, report *Report) ([]NumbeoCost, error) {
+	records, err := readCSV(r, numbeoCostColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	costs := make([]NumbeoCost, 0, len(records))
+	seen := make(map[[3]string]int, len(records))
+	for _, record := range records {
+		v := validator.New()
+		cost := NumbeoCost{
+			line:       record.line,
+			GeonameID:  parseInt64Field(v, record, "geoname_id"),
+			Category:   record.get("category"),
+			Param:      record.get("param"),
+			Cost:       parseFloatField(v, record, "cost"),
+			RangeLower: parseFloatField(v, record, "range_lower"),
+			RangeUpper: parseFloatField(v, record, "range_upper"),
+			LastUpdate: parseDateField(v, record, "last_update"),
+		}
+		ValidateNumbeoCost(v, cost)
+		if !v.Valid() {
+			report.rejectErrors(record.line, v.Errors)
+			continue
+		}
+
+		key := [3]string{strconv.FormatInt(cost.GeonameID, 10), cost.Category, cost.Param}
+		if line, ok := seen[key]; ok {
+			report.reject(record.line, fmt.Sprintf("duplicate of line %d", line))
+			continue
+		}
+		seen[key] = record.line
+
+		costs = append(costs, cost)
+	}
+
+	return costs, nil
+}
+
+func ValidateNumbeoCost(v *validator.Validator, cost NumbeoCost) {
+	v.Check(cost.GeonameID > 0, "geoname_id", "must be a positive integer")
+
+	v.Check(cost.Category != "", "category", "must be provided")
+	v.Check(len(cost.Category) <= 100, "category", "must not be more than 100 bytes long")
+	v.Check(cost.Param != "", "param", "must be provided")
+	v.Check(len(cost.Param) <= 255, "param", "must not be more than 255 bytes long")
+
+	v.Check(cost.Cost == nil || *cost.Cost >= 0, "cost", "must not be negative")
+	v.Check(cost.RangeLower == nil || *cost.RangeLower >= 0, "range_lower", "must not be negative")
+	v.Check(cost.RangeLower == nil || cost.RangeUpper == nil || *cost.RangeLower <= *cost.RangeUpper,
+		"range_upper", "must not be less than range_lower")
+}
+
+// ImportNumbeoCosts upserts costs in a single transaction, creating missing
+// categories and params. Rows for unknown cities are rejected. With dryRun the
+// transaction is rolled back, so the report shows what the import would do.
+func ImportNumbeoCosts(db *sql.DB, costs []NumbeoCost, updatedBy string, dryRun bool, report *Report) (retErr error) {
+	report.DryRun = dryRun
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	ids := make([]int64, 0, len(costs))
+	for _, cost := range costs {
+		ids = append(ids, cost.GeonameID)
+	}
+	known, err := knownCities(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+
+	paramIDs := make(map[[2]string]int)
+	for _, cost := range costs {
+		if !known[cost.GeonameID] {
+			report.reject(cost.line, fmt.Sprintf("geoname_id: city %d does not exist", cost.GeonameID))
+			continue
+		}
+
+		key := [2]string{cost.Category, cost.Param}
+		paramID, ok := paramIDs[key]
+		if !ok {
+			paramID, err = ensureCostParam(ctx, tx, cost.Category, cost.Param)
+			if err != nil {
+				return err
+			}
+			paramIDs[key] = paramID
+		}
+
+		inserted, err := upsertNumbeoCost(ctx, tx, cost, paramID, updatedBy)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", cost.line, err)
+		}
+		report.count(inserted)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	return tx.Commit()
+}
+
+// knownCities returns the ids that exist in the cities table.
+func knownCities(ctx context.Context, tx *sql.Tx, ids []int64) (known map[int64]bool, retErr error) {
+	rows, err := tx.QueryContext(ctx, `SELECT geoname_id FROM cities WHERE geoname_id = ANY($1);`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	known = make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		known[id] = true
+	}
+
+	return known, rows.Err()
+}
+
+// ensureCostParam returns the param_id of param in category, creating both
+// when missing.
+func ensureCostParam(ctx context.Context, tx *sql.Tx, category, param string) (int, error) {
+	query := `
+		WITH inserted AS (
+			INSERT INTO numbeo_cost_categories (category)
+			VALUES ($1)
+			ON CONFLICT (category) DO NOTHING
+			RETURNING category_id
+		)
+		SELECT category_id FROM inserted
+		UNION ALL
+		SELECT category_id FROM numbeo_cost_categories WHERE category = $1
+		LIMIT 1;`
+
+	var categoryID int
+	err := tx.QueryRowContext(ctx, query, category).Scan(&categoryID)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `
+		WITH inserted AS (
+			INSERT INTO numbeo_cost_params (category_id, param)
+			VALUES ($1, $2)
+			ON CONFLICT (category_id, param) DO NOTHING
+			RETURNING param_id
+		)
+		SELECT param_id FROM inserted
+		UNION ALL
+		SELECT param_id FROM numbeo_cost_params WHERE category_id = $1 AND param = $2
+		LIMIT 1;`
+
+	var paramID int
+	err = tx.QueryRowContext(ctx, query, categoryID, param).Scan(&paramID)
+	return paramID, err
+}
+
+// upsertNumbeoCost reports whether the row was inserted rather than updated.
+func upsertNumbeoCost(ctx context.Context, tx *sql.Tx, cost NumbeoCost, paramID int, updatedBy string) (bool, error) {
+	query := `
+		INSERT INTO numbeo_city_costs (geoname_id, param_id, cost, range, last_update, updated_date, updated_by)
+		VALUES (
+			$1, $2, $3,
+			CASE WHEN $4::numeric IS NULL AND $5::numeric IS NULL THEN NULL ELSE numrange($4::numeric, $5::numeric, '[]') END,
+			$6, CURRENT_DATE, $7
+		)
+		ON CONFLICT (geoname_id, param_id) DO UPDATE
+		SET cost = EXCLUDED.cost,
+		    range = EXCLUDED.range,
+		    last_update = EXCLUDED.last_update,
+		    updated_date = EXCLUDED.updated_date,
+		    updated_by = EXCLUDED.updated_by
+		RETURNING xmax = 0;`
+
+	args := []any{cost.GeonameID, paramID, cost.Cost, cost.RangeLower, cost.RangeUpper, cost.LastUpdate, updatedBy}
+
+	var inserted bool
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&inserted)
+	return inserted, err
+}
@@ -0,0 +1,170 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/denis-k2/relohelper-go/internal/assert"
+)
+
+func TestParseNumbeoCosts(t *testing.T) {
+	csv := strings.Join([]string{
+		"geoname_id,category,param,cost,range_lower,range_upper,last_update",
+		"2643743,Restaurants,\"Meal, Inexpensive Restaurant\",20,15,30,2026-03-01",
+		"2643743,Markets,Milk (regular),(1 liter),,,",
+		"2643743,Restaurants,\"Meal, Inexpensive Restaurant\",21,,,",
+		"0,,Milk,-1,5,4,01.03.2026",
+		"5128581,Markets,Eggs,4.5,,,",
+	}, "\n")
+
+	var report Report
+	costs, err := ParseNumbeoCosts(strings.NewReader(csv), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(costs), 2)
+	assert.Equal(t, costs[0].Param, "Meal, Inexpensive Restaurant")
+	assert.Equal(t, *costs[0].RangeUpper, 30.0)
+	assert.Equal(t, costs[0].LastUpdate.Format("2006-01-02"), "2026-03-01")
+	assert.Equal(t, costs[1].GeonameID, int64(5128581))
+	assert.Equal(t, costs[1].RangeLower == nil, true)
+
+	assert.DeepEqual(t, report.Rejected, []Rejection{
+		{Line: 3, Reason: "cost: must be a number"},
+		{Line: 4, Reason: "duplicate of line 2"},
+		{Line: 5, Reason: "category: must be provided; cost: must not be negative; geoname_id: must be a positive integer; " +
+			"last_update: must have the form YYYY-MM-DD; range_upper: must not be less than range_lower"},
+	})
+}
+
+func TestParseNumbeoCostsMissingColumn(t *testing.T) {
+	var report Report
+	_, err := ParseNumbeoCosts(strings.NewReader("geoname_id,category,param\n1,a,b\n"), &report)
+	assert.Equal(t, err.Error(), `header is missing column "cost"`)
+}
+
+func TestReportPrint(t *testing.T) {
+	report := Report{Inserted: 3, Updated: 1, DryRun: true}
+	report.reject(7, "geoname_id: city 1 does not exist")
+	report.reject(2, "cost: must be a number")
+
+	var out bytes.Buffer
+	err := report.Print(&out, "numbeo-costs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, out.String(), "numbeo-costs: 3 inserted, 1 updated, 2 rejected (dry run, nothing was written)\n"+
+		"line 2: cost: must be a number\n"+
+		"line 7: geoname_id: city 1 does not exist\n")
+}
+
+func TestImportNumbeoCosts(t *testing.T) {
+	db := newTestDB(t)
+
+	const (
+		cityID   = 999999101
+		category = "Importer Test Category"
+	)
+	deleteCategory := func() {
+		for _, query := range []string{
+			`DELETE FROM numbeo_cost_params WHERE category_id IN (SELECT category_id FROM numbeo_cost_categories WHERE category = $1)`,
+			`DELETE FROM numbeo_cost_categories WHERE category = $1`,
+		} {
+			if _, err := db.Exec(query, category); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Registered first, so it runs after the city and its costs are gone.
+	t.Cleanup(deleteCategory)
+	insertTestCity(t, db, cityID)
+	deleteCategory()
+
+	var existingCategory, existingParam string
+	err := db.QueryRow(`
+		SELECT c.category, p.param
+		FROM numbeo_cost_params p
+		JOIN numbeo_cost_categories c ON c.category_id = p.category_id
+		ORDER BY p.param_id
+		LIMIT 1`).Scan(&existingCategory, &existingParam)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parse := func(cost string) []NumbeoCost {
+		t.Helper()
+		csv := strings.Join([]string{
+			"geoname_id,category,param,cost,range_lower,range_upper,last_update",
+			fmt.Sprintf("%d,%s,%s,%s,1,9,2026-03-01", cityID, csvQuote(existingCategory), csvQuote(existingParam), cost),
+			fmt.Sprintf("%d,%s,New Param,%s,,,", cityID, category, cost),
+			fmt.Sprintf("999999199,%s,New Param,%s,,,", category, cost),
+		}, "\n")
+
+		var report Report
+		costs, err := ParseNumbeoCosts(strings.NewReader(csv), &report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(report.Rejected), 0)
+		return costs
+	}
+	cityCosts := func() int {
+		return countRows(t, db, `SELECT COUNT(*) FROM numbeo_city_costs WHERE geoname_id = $1`, cityID)
+	}
+	categories := func() int {
+		return countRows(t, db, `SELECT COUNT(*) FROM numbeo_cost_categories WHERE category = $1`, category)
+	}
+
+	var report Report
+	err = ImportNumbeoCosts(db, parse("5"), "test", true, &report)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Inserted, 2)
+	assert.DeepEqual(t, report.Rejected, []Rejection{{Line: 4, Reason: "geoname_id: city 999999199 does not exist"}})
+	assert.Equal(t, cityCosts(), 0)
+	assert.Equal(t, categories(), 0)
+
+	report = Report{}
+	err = ImportNumbeoCosts(db, parse("5"), "test", false, &report)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Inserted, 2)
+	assert.Equal(t, report.Updated, 0)
+	assert.Equal(t, len(report.Rejected), 1)
+	assert.Equal(t, cityCosts(), 2)
+	assert.Equal(t, categories(), 1)
+	assert.Equal(t, countRows(t, db, `
+		SELECT COUNT(*)
+		FROM numbeo_cost_params p
+		JOIN numbeo_cost_categories c ON c.category_id = p.category_id
+		WHERE c.category = $1 AND p.param = 'New Param'`, category), 1)
+
+	report = Report{}
+	err = ImportNumbeoCosts(db, parse("7.5"), "test", false, &report)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Inserted, 0)
+	assert.Equal(t, report.Updated, 2)
+	assert.Equal(t, cityCosts(), 2)
+	assert.Equal(t, categories(), 1)
+
+	var (
+		cost                    float64
+		lower, upper, updatedBy string
+	)
+	err = db.QueryRow(`
+		SELECT ncc.cost, lower(ncc.range)::text, upper(ncc.range)::text, ncc.updated_by
+		FROM numbeo_city_costs ncc
+		JOIN numbeo_cost_params p ON p.param_id = ncc.param_id
+		WHERE ncc.geoname_id = $1 AND p.param = $2`, cityID, existingParam).Scan(&cost, &lower, &upper, &updatedBy)
+	assert.NilError(t, err)
+	assert.Equal(t, cost, 7.5)
+	assert.Equal(t, lower, "1")
+	assert.Equal(t, upper, "9")
+	assert.Equal(t, updatedBy, "test")
+}
+
+func csvQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
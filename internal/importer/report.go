@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Report counts the rows of an import. Inserted and Updated only count rows
+// that passed validation. Warnings lists rows that were written with a value
+// left out.
+type Report struct {
+	Inserted int
+	Updated  int
+	Rejected []Rejection
+	Warnings []Rejection
+	DryRun   bool
+}
+
+// Rejection explains what happened to a line of the input file. Line counts
+// from 1, including any header line.
+type Rejection struct {
+	Line   int
+	Reason string
+}
+
+func (r *Report) reject(line int, reason string) {
+	r.Rejected = append(r.Rejected, Rejection{Line: line, Reason: reason})
+}
+
+func (r *Report) warn(line int, reason string) {
+	r.Warnings = append(r.Warnings, Rejection{Line: line, Reason: reason})
+}
+
+func (r *Report) count(inserted bool) {
+	if inserted {
+		r.Inserted++
+	} else {
+		r.Updated++
+	}
+}
+
+// rejectErrors rejects line with the validator errors, sorted by key.
+func (r *Report) rejectErrors(line int, errors map[string]string) {
+	reasons := make([]string, 0, len(errors))
+	for _, key := range slices.Sorted(maps.Keys(errors)) {
+		reasons = append(reasons, key+": "+errors[key])
+	}
+	r.reject(line, strings.Join(reasons, "; "))
+}
+
+// Print writes a summary line followed by one line per rejected row and per
+// warning, in file order.
+func (r *Report) Print(w io.Writer, name string) error {
+	byLine := func(a, b Rejection) int {
+		return cmp.Compare(a.Line, b.Line)
+	}
+	slices.SortStableFunc(r.Rejected, byLine)
+	slices.SortStableFunc(r.Warnings, byLine)
+
+	summary := fmt.Sprintf("%s: %d inserted, %d updated, %d rejected", name, r.Inserted, r.Updated, len(r.Rejected))
+	if len(r.Warnings) > 0 {
+		summary += fmt.Sprintf(", %d warnings", len(r.Warnings))
+	}
+	if r.DryRun {
+		summary += " (dry run, nothing was written)"
+	}
+
+	if _, err := fmt.Fprintln(w, summary); err != nil {
+		return err
+	}
+	for _, rejection := range r.Rejected {
+		if _, err := fmt.Fprintf(w, "line %d: %s\n", rejection.Line, rejection.Reason); err != nil {
+			return err
+		}
+	}
+	for _, warning := range r.Warnings {
+		if _, err := fmt.Fprintf(w, "line %d: warning: %s\n", warning.Line, warning.Reason); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package importer
+
+import (
+	"database/sql"
+	"flag"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+var testDBdsn = flag.String("db-dsn", os.Getenv("RELOHELPER_TEST_DB_DSN"), "PostgreSQL DSN for testing")
+
+// Stub flag to allow passing cmd flag during testing.
+var _ = flag.String("env", "", "Environment flag for testing")
+
+// newTestDB opens the test database and applies the version columns that the
+// importers write.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("postgres", *testDBdsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	script, err := os.ReadFile("../../migrations/000008_add_domain_versions.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(string(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// deleteTestCities removes the cities and every row that refers to them, now
+// and when the test ends.
+func deleteTestCities(t *testing.T, db *sql.DB, ids ...int64) {
+	t.Helper()
+
+	cleanup := func() {
+		for _, table := range []string{"avg_climate", "numbeo_city_costs", "numbeo_city_indices", "cities"} {
+			for _, id := range ids {
+				if _, err := db.Exec("DELETE FROM "+table+" WHERE geoname_id = $1", id); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+}
+
+// insertTestCity adds a city in the United States, removing it when the test
+// ends.
+func insertTestCity(t *testing.T, db *sql.DB, id int64) {
+	t.Helper()
+
+	deleteTestCities(t, db, id)
+	_, err := db.Exec(`
+		INSERT INTO cities (geoname_id, city, country_code, population, latitude, longitude, timezone)
+		VALUES ($1, 'Testville', 'USA', 1000, 40.5, -73.9, 'America/New_York')`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countRows(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow(query, args...).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS public.idx_cities_latitude_longitude;
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_cities_latitude_longitude
+ON public.cities (latitude, longitude);
@@ -0,0 +1 @@
+DROP MATERIALIZED VIEW IF EXISTS public.city_features;
@@ -0,0 +1,60 @@
+-- Standardized feature vectors for the similar cities endpoint. Every z_ column
+-- is a z-score across all cities, so features with different units weigh the
+-- same. Refresh after importing Numbeo indices or climate data.
+CREATE MATERIALIZED VIEW IF NOT EXISTS public.city_features AS
+WITH climate AS (
+    SELECT geoname_id,
+           AVG(high_temp) AS high_temp,
+           AVG(low_temp) AS low_temp,
+           AVG(rainfall) * 12 AS rainfall,
+           AVG(humidity) AS humidity,
+           AVG(sunshine) * 12 AS sunshine,
+           AVG(snowfall) * 12 AS snowfall
+    FROM public.avg_climate
+    GROUP BY geoname_id
+),
+raw AS (
+    SELECT c.geoname_id,
+           c.country_code,
+           nic.cost_of_living_plus_rent::double precision AS cost_of_living_plus_rent,
+           nic.local_purchasing_power::double precision AS local_purchasing_power,
+           nic.quality_of_life::double precision AS quality_of_life,
+           nic.property_price_to_income_ratio::double precision AS property_price_to_income_ratio,
+           nic.traffic_commute_time::double precision AS traffic_commute_time,
+           nic.safety::double precision AS safety,
+           nic.health_care::double precision AS health_care,
+           nic.pollution::double precision AS pollution,
+           nic.climate::double precision AS climate,
+           cl.high_temp::double precision AS annual_high_temp,
+           cl.low_temp::double precision AS annual_low_temp,
+           cl.rainfall::double precision AS annual_rainfall,
+           cl.humidity::double precision AS annual_humidity,
+           cl.sunshine::double precision AS annual_sunshine,
+           cl.snowfall::double precision AS annual_snowfall
+    FROM public.cities c
+    LEFT JOIN public.numbeo_city_indices nic ON nic.geoname_id = c.geoname_id
+    LEFT JOIN climate cl ON cl.geoname_id = c.geoname_id
+    WHERE nic.geoname_id IS NOT NULL OR cl.geoname_id IS NOT NULL
+)
+SELECT geoname_id,
+       country_code,
+       cost_of_living_plus_rent AS cost_index,
+       (cost_of_living_plus_rent - AVG(cost_of_living_plus_rent) OVER ()) / NULLIF(STDDEV_POP(cost_of_living_plus_rent) OVER (), 0) AS z_cost_of_living_plus_rent,
+       (local_purchasing_power - AVG(local_purchasing_power) OVER ()) / NULLIF(STDDEV_POP(local_purchasing_power) OVER (), 0) AS z_local_purchasing_power,
+       (quality_of_life - AVG(quality_of_life) OVER ()) / NULLIF(STDDEV_POP(quality_of_life) OVER (), 0) AS z_quality_of_life,
+       (property_price_to_income_ratio - AVG(property_price_to_income_ratio) OVER ()) / NULLIF(STDDEV_POP(property_price_to_income_ratio) OVER (), 0) AS z_property_price_to_income_ratio,
+       (traffic_commute_time - AVG(traffic_commute_time) OVER ()) / NULLIF(STDDEV_POP(traffic_commute_time) OVER (), 0) AS z_traffic_commute_time,
+       (safety - AVG(safety) OVER ()) / NULLIF(STDDEV_POP(safety) OVER (), 0) AS z_safety,
+       (health_care - AVG(health_care) OVER ()) / NULLIF(STDDEV_POP(health_care) OVER (), 0) AS z_health_care,
+       (pollution - AVG(pollution) OVER ()) / NULLIF(STDDEV_POP(pollution) OVER (), 0) AS z_pollution,
+       (climate - AVG(climate) OVER ()) / NULLIF(STDDEV_POP(climate) OVER (), 0) AS z_climate,
+       (annual_high_temp - AVG(annual_high_temp) OVER ()) / NULLIF(STDDEV_POP(annual_high_temp) OVER (), 0) AS z_annual_high_temp,
+       (annual_low_temp - AVG(annual_low_temp) OVER ()) / NULLIF(STDDEV_POP(annual_low_temp) OVER (), 0) AS z_annual_low_temp,
+       (annual_rainfall - AVG(annual_rainfall) OVER ()) / NULLIF(STDDEV_POP(annual_rainfall) OVER (), 0) AS z_annual_rainfall,
+       (annual_humidity - AVG(annual_humidity) OVER ()) / NULLIF(STDDEV_POP(annual_humidity) OVER (), 0) AS z_annual_humidity,
+       (annual_sunshine - AVG(annual_sunshine) OVER ()) / NULLIF(STDDEV_POP(annual_sunshine) OVER (), 0) AS z_annual_sunshine,
+       (annual_snowfall - AVG(annual_snowfall) OVER ()) / NULLIF(STDDEV_POP(annual_snowfall) OVER (), 0) AS z_annual_snowfall
+FROM raw;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_city_features_geoname_id
+ON public.city_features (geoname_id);
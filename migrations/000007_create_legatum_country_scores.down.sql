@@ -0,0 +1,86 @@
+CREATE TABLE IF NOT EXISTS public.legatum_country_indices (
+    country_code text,
+    area_group text,
+    pillar_name text,
+    rank_2007 bigint,
+    rank_2008 bigint,
+    rank_2009 bigint,
+    rank_2010 bigint,
+    rank_2011 bigint,
+    rank_2012 bigint,
+    rank_2013 bigint,
+    rank_2014 bigint,
+    rank_2015 bigint,
+    rank_2016 bigint,
+    rank_2017 bigint,
+    rank_2018 bigint,
+    rank_2019 bigint,
+    rank_2020 bigint,
+    rank_2021 bigint,
+    rank_2022 bigint,
+    rank_2023 bigint,
+    score_2007 double precision,
+    score_2008 double precision,
+    score_2009 double precision,
+    score_2010 double precision,
+    score_2011 double precision,
+    score_2012 double precision,
+    score_2013 double precision,
+    score_2014 double precision,
+    score_2015 double precision,
+    score_2016 double precision,
+    score_2017 double precision,
+    score_2018 double precision,
+    score_2019 double precision,
+    score_2020 double precision,
+    score_2021 double precision,
+    score_2022 double precision,
+    score_2023 double precision,
+    CONSTRAINT legatum_country_indices_pkey PRIMARY KEY (country_code, pillar_name),
+    CONSTRAINT legatum_country_indices_country_code_fkey FOREIGN KEY (country_code)
+        REFERENCES public.countries(country_code)
+);
+
+-- Editions outside 2007-2023 have no column and are lost.
+INSERT INTO public.legatum_country_indices
+SELECT country_code,
+       MAX(area_group),
+       pillar_name,
+       MAX(rank) FILTER (WHERE year = 2007),
+       MAX(rank) FILTER (WHERE year = 2008),
+       MAX(rank) FILTER (WHERE year = 2009),
+       MAX(rank) FILTER (WHERE year = 2010),
+       MAX(rank) FILTER (WHERE year = 2011),
+       MAX(rank) FILTER (WHERE year = 2012),
+       MAX(rank) FILTER (WHERE year = 2013),
+       MAX(rank) FILTER (WHERE year = 2014),
+       MAX(rank) FILTER (WHERE year = 2015),
+       MAX(rank) FILTER (WHERE year = 2016),
+       MAX(rank) FILTER (WHERE year = 2017),
+       MAX(rank) FILTER (WHERE year = 2018),
+       MAX(rank) FILTER (WHERE year = 2019),
+       MAX(rank) FILTER (WHERE year = 2020),
+       MAX(rank) FILTER (WHERE year = 2021),
+       MAX(rank) FILTER (WHERE year = 2022),
+       MAX(rank) FILTER (WHERE year = 2023),
+       MAX(score) FILTER (WHERE year = 2007),
+       MAX(score) FILTER (WHERE year = 2008),
+       MAX(score) FILTER (WHERE year = 2009),
+       MAX(score) FILTER (WHERE year = 2010),
+       MAX(score) FILTER (WHERE year = 2011),
+       MAX(score) FILTER (WHERE year = 2012),
+       MAX(score) FILTER (WHERE year = 2013),
+       MAX(score) FILTER (WHERE year = 2014),
+       MAX(score) FILTER (WHERE year = 2015),
+       MAX(score) FILTER (WHERE year = 2016),
+       MAX(score) FILTER (WHERE year = 2017),
+       MAX(score) FILTER (WHERE year = 2018),
+       MAX(score) FILTER (WHERE year = 2019),
+       MAX(score) FILTER (WHERE year = 2020),
+       MAX(score) FILTER (WHERE year = 2021),
+       MAX(score) FILTER (WHERE year = 2022),
+       MAX(score) FILTER (WHERE year = 2023)
+FROM public.legatum_country_scores
+GROUP BY country_code, pillar_name;
+
+DROP TABLE IF EXISTS public.legatum_country_scores;
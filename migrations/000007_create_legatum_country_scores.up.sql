@@ -0,0 +1,27 @@
+-- One row per country, pillar and Legatum edition, so that a new edition is a
+-- data load instead of a schema change.
+CREATE TABLE IF NOT EXISTS public.legatum_country_scores (
+    country_code text NOT NULL,
+    pillar_name text NOT NULL,
+    area_group text,
+    year smallint NOT NULL,
+    rank bigint,
+    score double precision,
+    CONSTRAINT legatum_country_scores_pkey PRIMARY KEY (country_code, pillar_name, year),
+    CONSTRAINT legatum_country_scores_country_code_fkey FOREIGN KEY (country_code)
+        REFERENCES public.countries(country_code)
+);
+
+INSERT INTO public.legatum_country_scores (country_code, pillar_name, area_group, year, rank, score)
+SELECT li.country_code,
+       li.pillar_name,
+       li.area_group,
+       y.year,
+       (to_jsonb(li) ->> ('rank_' || y.year))::bigint,
+       (to_jsonb(li) ->> ('score_' || y.year))::double precision
+FROM public.legatum_country_indices li
+CROSS JOIN generate_series(2007, 2023) AS y(year)
+WHERE to_jsonb(li) ->> ('rank_' || y.year) IS NOT NULL
+   OR to_jsonb(li) ->> ('score_' || y.year) IS NOT NULL;
+
+DROP TABLE public.legatum_country_indices;
@@ -0,0 +1,6 @@
+ALTER TABLE public.numbeo_city_costs ALTER COLUMN updated_by TYPE character varying(30) USING left(updated_by, 30);
+ALTER TABLE public.avg_climate ALTER COLUMN updated_by TYPE character varying(30) USING left(updated_by, 30);
+
+ALTER TABLE public.avg_climate DROP COLUMN IF EXISTS version;
+ALTER TABLE public.numbeo_city_indices DROP COLUMN IF EXISTS version;
+ALTER TABLE public.cities DROP COLUMN IF EXISTS version;
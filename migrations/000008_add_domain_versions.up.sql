@@ -0,0 +1,7 @@
+ALTER TABLE public.cities ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE public.numbeo_city_indices ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE public.avg_climate ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+
+-- updated_by holds the email of the admin user, which may exceed 30 characters.
+ALTER TABLE public.avg_climate ALTER COLUMN updated_by TYPE text;
+ALTER TABLE public.numbeo_city_costs ALTER COLUMN updated_by TYPE text;
@@ -135,19 +135,31 @@ function bindEvents() {
   );
 }
 
-async function loadInitialData() {
-  const exchangeRatesPromise = loadExchangeRates();
+async function fetchAllCities() {
+  const cities = [];
+  let cursor = "";
 
-  try {
-    const res = await fetch("/cities");
+  do {
+    const qs = new URLSearchParams();
+    qs.set("page_size", "500");
+    if (cursor) qs.set("cursor", cursor);
+
+    const res = await fetch(`/cities?${qs.toString()}`);
     if (!res.ok) throw new Error(`Failed to load cities: ${res.status}`);
 
     const data = await res.json();
-    state.allCities = Array.isArray(data.cities)
-      ? data.cities
-      : Array.isArray(data.data)
-        ? data.data
-        : [];
+    if (Array.isArray(data.cities)) cities.push(...data.cities);
+    cursor = data.metadata?.next_cursor || "";
+  } while (cursor);
+
+  return cities;
+}
+
+async function loadInitialData() {
+  const exchangeRatesPromise = loadExchangeRates();
+
+  try {
+    state.allCities = await fetchAllCities();
     state.countries = buildCountriesFromCities(state.allCities);
 
     renderCountries();